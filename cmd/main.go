@@ -1,7 +1,51 @@
 package main
 
-import "github.com/JuanJoCasamitjana/portfol.io/internal/base"
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/base"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+)
 
 func main() {
+	backup := flag.Bool("backup", false, "create a verified snapshot of the database and exit")
+	restore := flag.String("restore", "", "restore the database from the given snapshot and exit")
+	exportSite := flag.String("export-site", "", "export the portfolio of the given user as a static site and exit")
+	output := flag.String("output", "", "file of the exported site, <username>_site.zip by default")
+	siteURL := flag.String("site-url", "", "address where the exported site will be published")
+	locale := flag.String("locale", "en", "language of the exported site")
+	flag.Parse()
+	if *backup {
+		snapshot, err := database.CreateBackup()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("backup created: ", snapshot.Name)
+		os.RemoveAll(database.Replicas)
+		os.Exit(0)
+	}
+	if *restore != "" {
+		err := database.RestoreBackup(*restore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("database restored from: ", *restore)
+		os.RemoveAll(database.Replicas)
+		os.Exit(0)
+	}
+	if *exportSite != "" {
+		if *output == "" {
+			*output = *exportSite + "_site.zip"
+		}
+		err := base.ExportStaticSite(*exportSite, *output, *siteURL, *locale)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("site exported to: ", *output)
+		os.RemoveAll(database.Replicas)
+		os.Exit(0)
+	}
 	base.SetUpAndRunServer()
 }
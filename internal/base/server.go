@@ -6,12 +6,14 @@ import (
 	"html/template"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/handlers"
 	"github.com/JuanJoCasamitjana/portfol.io/internal/routes"
 	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
 	"github.com/gorilla/sessions"
@@ -72,6 +74,10 @@ func SetUpAndRunServer() {
 	e.Renderer = NewTemplates()
 	e.Static("/static", "web/static")
 	routes.SetUpRoutes(e)
+	stopJobs := make(chan struct{})
+	database.StartBackupScheduler(stopJobs)
+	database.StartScoreScheduler(stopJobs)
+	handlers.StartImportCleanup(stopJobs)
 	shutdown := make(chan struct{})
 	sysSignals := make(chan os.Signal, 1)
 	signal.Notify(sysSignals, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
@@ -85,6 +91,7 @@ func SetUpAndRunServer() {
 		utils.ShutDownSignal()
 	}()
 	<-shutdown
+	close(stopJobs)
 	defer cancel()
 	err := e.Shutdown(ctx)
 	if err != nil {
@@ -107,8 +114,33 @@ func (t *Templates) Render(w io.Writer, name string, data interface{}, c echo.Co
 func NewTemplates() *Templates {
 	funcMap := template.FuncMap{
 		"Translate": utils.Translate,
+		//Tag names may hold # and other characters that end a path
+		"PathEscape": url.PathEscape,
 	}
 	return &Templates{
 		templates: template.Must(template.New("").Funcs(funcMap).ParseGlob("./web/templates/*.html")),
 	}
 }
+
+// ExportStaticSite writes the portfolio of a user as a static site into a zip file, rendered with the templates of the server
+func ExportStaticSite(username, output, siteURL, locale string) error {
+	user, err := database.FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if siteURL == "" {
+		siteURL = utils.BaseURL + "/u/" + user.Username
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	options := handlers.StaticSiteOptions{Locale: locale, SiteURL: siteURL, LiveURL: utils.BaseURL}
+	err = handlers.WriteStaticSite(file, NewTemplates(), user, options)
+	if err != nil {
+		file.Close()
+		os.Remove(output)
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+// Visitor hashes are forgotten after a day, so the dedupe window can not be longer than that
+var ViewDedupeWindow = 30 * time.Minute
+
+func init() {
+	godotenv.Load()
+	if minutes, err := strconv.Atoi(os.Getenv("VIEW_DEDUPE_MINUTES")); err == nil && minutes > 0 {
+		ViewDedupeWindow = min(time.Duration(minutes)*time.Minute, 24*time.Hour)
+	}
+}
+
+type DayCount struct {
+	Day   string
+	Count int64
+}
+
+type PostViews struct {
+	ID        uint64
+	Title     string
+	Slug      string
+	OwnerID   uint64
+	OwnerType string
+	Views     int64
+}
+
+type ReferrerViews struct {
+	Referrer string
+	Views    int64
+}
+
+type TagVotesReceived struct {
+	TagVotes
+	Recent int64
+}
+
+// RecordView saves the view unless the same visitor already saw the same page within the dedupe window
+func RecordView(view *model.View) error {
+	since := DB.NowFunc().Add(-ViewDedupeWindow)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.View{}).Where("visitor = ? AND post_id = ? AND author = ? AND created_at >= ?",
+			view.Visitor, view.PostID, view.Author, since).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+		return tx.Create(view).Error
+	})
+}
+
+// ForgetViewVisitors drops the visitor hashes once they can no longer be used to dedupe
+func ForgetViewVisitors() error {
+	before := DB.NowFunc().Add(-24 * time.Hour)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&model.View{}).Where("visitor <> '' AND created_at < ?", before).Update("visitor", "").Error
+	})
+}
+
+func CountViewsOfAuthorPerDay(author string, since time.Time) ([]DayCount, error) {
+	var days []DayCount
+	err := DB.Model(&model.View{}).Select("substr(created_at, 1, 10) AS day, COUNT(*) AS count").
+		Where("author = ? AND created_at >= ?", author, since).Group("day").Order("day").Scan(&days).Error
+	return days, err
+}
+
+func CountProfileViewsOfAuthor(author string, since time.Time) (int64, error) {
+	var count int64
+	err := DB.Model(&model.View{}).Where("author = ? AND post_id = 0 AND created_at >= ?", author, since).Count(&count).Error
+	return count, err
+}
+
+func FindTopPostsOfAuthorByViews(author string, since time.Time, limit int) ([]PostViews, error) {
+	var posts []PostViews
+	err := DB.Table("posts").Select("posts.id, posts.title, posts.slug, posts.owner_id, posts.owner_type, COUNT(views.id) AS views").
+		Joins("JOIN views ON views.post_id = posts.id").
+		Where("posts.author = ? AND views.created_at >= ?", author, since).
+		Group("posts.id, posts.title, posts.slug, posts.owner_id, posts.owner_type").Order("views DESC, posts.title").Limit(limit).Scan(&posts).Error
+	return posts, err
+}
+
+// CountReferrersOfAuthor groups the views by the site they came from, direct visits have an empty referrer
+func CountReferrersOfAuthor(author string, since time.Time, limit int) ([]ReferrerViews, error) {
+	var referrers []ReferrerViews
+	err := DB.Model(&model.View{}).Select("referrer, COUNT(*) AS views").
+		Where("author = ? AND created_at >= ?", author, since).Group("referrer").
+		Order("views DESC, referrer").Limit(limit).Scan(&referrers).Error
+	return referrers, err
+}
+
+func CountFollowersOfUser(username string) (int64, error) {
+	var count int64
+	err := DB.Table("follows").Where("username = ?", username).Count(&count).Error
+	return count, err
+}
+
+// CountFollowerChangesPerDay returns the net amount of followers gained each day
+func CountFollowerChangesPerDay(username string, since time.Time) ([]DayCount, error) {
+	var days []DayCount
+	err := DB.Model(&model.FollowEvent{}).Select("substr(created_at, 1, 10) AS day, SUM(delta) AS count").
+		Where("username = ? AND created_at >= ?", username, since).Group("day").Order("day").Scan(&days).Error
+	return days, err
+}
+
+// CountTagVotesReceivedByAuthor adds up the votes on the posts of the author by tag, Recent only counts the ones since the date
+func CountTagVotesReceivedByAuthor(author string, since time.Time, limit int) ([]TagVotesReceived, error) {
+	var tags []TagVotesReceived
+	err := DB.Table("post_votes").
+		Select("tags.id, tags.name, COUNT(votes.id) AS votes, SUM(CASE WHEN votes.created_at >= ? THEN 1 ELSE 0 END) AS recent", since).
+		Joins("JOIN votes ON votes.id = post_votes.vote_id").Joins("JOIN tags ON tags.id = votes.tag_id").
+		Joins("JOIN posts ON posts.id = post_votes.post_id").
+		Where("posts.author = ?", author).Group("tags.id, tags.name").
+		Order("votes DESC, tags.name").Limit(limit).Scan(&tags).Error
+	return tags, err
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrArticleConflict = errors.New("the article was changed since it was opened")
+
+// UpdateArticleContent saves the edit only if the article is still at version, otherwise someone saved another
+// edit in between and ErrArticleConflict is returned
+func UpdateArticleContent(article *model.Article, version uint64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Article{}).Where("id = ? AND version = ?", article.ID, version).
+			UpdateColumn("version", version+1)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrArticleConflict
+		}
+		article.Version = version + 1
+		return tx.Model(article).Updates(article).Error
+	})
+}
+
+// SaveArticleAutosave replaces the previous autosave of the user for the same article
+func SaveArticleAutosave(autosave *model.ArticleAutosave) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var previous model.ArticleAutosave
+		err := tx.Where("article_id = ? AND owner = ?", autosave.ArticleID, autosave.Owner).First(&previous).Error
+		if err == nil {
+			autosave.ID = previous.ID
+			autosave.CreatedAt = previous.CreatedAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Save(autosave).Error
+	})
+}
+
+func FindArticleAutosave(articleID uint64, owner string) (model.ArticleAutosave, error) {
+	var autosave model.ArticleAutosave
+	err := DB.Where("article_id = ? AND owner = ?", articleID, owner).First(&autosave).Error
+	return autosave, err
+}
+
+func DeleteArticleAutosave(articleID uint64, owner string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("article_id = ? AND owner = ?", articleID, owner).Delete(&model.ArticleAutosave{}).Error
+	})
+}
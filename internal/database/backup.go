@@ -0,0 +1,370 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database/sqlite"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+const backupPrefix = "portfolio_"
+const backupExt = ".db"
+
+var (
+	BackupDir          = "./backups"
+	BackupRetention    = 7
+	BackupInterval     = 24 * time.Hour
+	ErrInvalidBackup   = errors.New("invalid backup name")
+	ErrBackupCorrupted = errors.New("backup failed the integrity check")
+	//Without a local file there is nothing VACUUM INTO can copy, the remote database keeps its own backups
+	ErrBackupUnsupported = errors.New("snapshots need a local or replicated database")
+)
+
+type Backup struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+func init() {
+	godotenv.Load()
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		BackupDir = dir
+	}
+	if retention, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION")); err == nil && retention > 0 {
+		BackupRetention = retention
+	}
+	//Interval is expressed in hours, 0 disables the scheduled backups
+	if hours, err := strconv.Atoi(os.Getenv("BACKUP_INTERVAL")); err == nil && hours >= 0 {
+		BackupInterval = time.Duration(hours) * time.Hour
+	}
+}
+
+// CreateBackup writes a verified snapshot of the database to BackupDir
+func CreateBackup() (Backup, error) {
+	err := os.MkdirAll(BackupDir, 0775)
+	if err != nil {
+		return Backup{}, err
+	}
+	name := NewBackupName()
+	err = WriteSnapshot(filepath.Join(BackupDir, name))
+	if err != nil {
+		return Backup{}, err
+	}
+	return FindBackup(name)
+}
+
+// WriteSnapshot writes a consistent copy of the database to path using VACUUM INTO and verifies it.
+// An embedded replica is synced with the remote database first and the snapshot is taken from its local file,
+// statements sent through DB could run on the remote database instead.
+func WriteSnapshot(path string) error {
+	if IsRemote {
+		return ErrBackupUnsupported
+	}
+	source := DB
+	if ReplicaPath != "" {
+		_, err := Connector.Sync()
+		if err != nil {
+			return err
+		}
+		replica, err := openLocalFile(ReplicaPath)
+		if err != nil {
+			return err
+		}
+		defer closeLocalFile(replica)
+		source = replica
+	}
+	err := source.Exec("VACUUM INTO ?", path).Error
+	if err != nil {
+		return err
+	}
+	err = VerifyBackup(path)
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// openLocalFile opens a database file on its own connection, apart from DB
+func openLocalFile(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.New(sqlite.Config{DriverName: "libsql", DSN: "file:" + path}), &gorm.Config{
+		Logger: DB.Logger,
+	})
+}
+
+func closeLocalFile(db *gorm.DB) {
+	if conn, err := db.DB(); err == nil {
+		conn.Close()
+	}
+}
+
+// VerifyBackup opens the snapshot on its own and runs an integrity check on it
+func VerifyBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	snapshot, err := openLocalFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeLocalFile(snapshot)
+	var results []string
+	err = snapshot.Raw("PRAGMA integrity_check").Scan(&results).Error
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return ErrBackupCorrupted
+	}
+	return nil
+}
+
+func NewBackupName() string {
+	return backupPrefix + strconv.FormatInt(time.Now().UnixNano(), 10) + backupExt
+}
+
+// BackupPath resolves a backup name to its path, rejecting anything outside of BackupDir
+func BackupPath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupExt) {
+		return "", ErrInvalidBackup
+	}
+	return filepath.Join(BackupDir, name), nil
+}
+
+func FindBackup(name string) (Backup, error) {
+	path, err := BackupPath(name)
+	if err != nil {
+		return Backup{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	return Backup{Name: name, Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+// ListBackups returns the available snapshots, newest first
+func ListBackups() ([]Backup, error) {
+	entries, err := os.ReadDir(BackupDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		backup, err := FindBackup(entry.Name())
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// PruneBackups removes the oldest snapshots so that only keep of them remain
+func PruneBackups(keep int) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		err = os.Remove(filepath.Join(BackupDir, backups[i].Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreBackup replaces the content of every table with the content of the snapshot.
+// The snapshot is verified first and the rows are written through DB in a single transaction, so they reach the remote
+// database of a replica and a failure leaves the database untouched. The AUTOINCREMENT counters are restored too.
+func RestoreBackup(path string) error {
+	if IsRemote {
+		return ErrBackupUnsupported
+	}
+	err := VerifyBackup(path)
+	if err != nil {
+		return err
+	}
+	snapshot, err := openLocalFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeLocalFile(snapshot)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error
+		if err != nil {
+			return err
+		}
+		var tables []string
+		err = tx.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").
+			Scan(&tables).Error
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			err = restoreTable(tx, snapshot, table)
+			if err != nil {
+				return fmt.Errorf("restoring %s: %w", table, err)
+			}
+		}
+		return restoreSequences(tx, snapshot)
+	})
+	if err != nil || ReplicaPath == "" {
+		return err
+	}
+	//The local copy catches up with the restored remote database
+	_, err = Connector.Sync()
+	return err
+}
+
+// restoreBatchSize is the number of rows written by each INSERT of a restore
+const restoreBatchSize = 200
+
+// restoreTable copies the rows of the snapshot as SQL literals, quote() keeps every value with its storage class
+func restoreTable(tx, snapshot *gorm.DB, table string) error {
+	var snapshotColumns []string
+	err := snapshot.Raw("SELECT name FROM pragma_table_info(?)", table).Scan(&snapshotColumns).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Exec(fmt.Sprintf("DELETE FROM %q", table)).Error
+	if err != nil {
+		return err
+	}
+	//The table did not exist when the snapshot was taken
+	if len(snapshotColumns) == 0 {
+		return nil
+	}
+	var liveColumns []string
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", table).Scan(&liveColumns).Error
+	if err != nil {
+		return err
+	}
+	//Only copy the columns both schemas share, newer columns keep their defaults
+	var columns, quoted []string
+	for _, column := range liveColumns {
+		for _, snapshotColumn := range snapshotColumns {
+			if column == snapshotColumn {
+				columns = append(columns, fmt.Sprintf("%q", column))
+				quoted = append(quoted, fmt.Sprintf("quote(%q)", column))
+				break
+			}
+		}
+	}
+	rows, err := snapshot.Raw(fmt.Sprintf("SELECT %s FROM %q", strings.Join(quoted, " || ',' || "), table)).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	insert := fmt.Sprintf("INSERT INTO %q (%s) VALUES ", table, strings.Join(columns, ", "))
+	var values []string
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		err := tx.Exec(insert + "(" + strings.Join(values, "), (") + ")").Error
+		values = values[:0]
+		return err
+	}
+	for rows.Next() {
+		var row string
+		err = rows.Scan(&row)
+		if err != nil {
+			return err
+		}
+		values = append(values, row)
+		if len(values) == restoreBatchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// restoreSequences sets the AUTOINCREMENT counters to the ones of the snapshot, deleting the rows does not reset them
+func restoreSequences(tx, snapshot *gorm.DB) error {
+	var liveSequences, snapshotSequences int64
+	err := tx.Raw("SELECT count(*) FROM sqlite_master WHERE name = 'sqlite_sequence'").Scan(&liveSequences).Error
+	if err != nil || liveSequences == 0 {
+		return err
+	}
+	err = snapshot.Raw("SELECT count(*) FROM sqlite_master WHERE name = 'sqlite_sequence'").Scan(&snapshotSequences).Error
+	if err != nil {
+		return err
+	}
+	var sequences []struct {
+		Name string
+		Seq  int64
+	}
+	if snapshotSequences > 0 {
+		err = snapshot.Raw("SELECT name, seq FROM sqlite_sequence").Scan(&sequences).Error
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Exec("DELETE FROM sqlite_sequence").Error
+	if err != nil {
+		return err
+	}
+	for _, sequence := range sequences {
+		err = tx.Exec("INSERT INTO sqlite_sequence (name, seq) SELECT ?, ? WHERE EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)",
+			sequence.Name, sequence.Seq, sequence.Name).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartBackupScheduler takes a snapshot every BackupInterval and prunes the old ones
+func StartBackupScheduler(stop <-chan struct{}) {
+	if BackupInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(BackupInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				backup, err := CreateBackup()
+				if err != nil {
+					log.Println("scheduled backup failed: ", err)
+					continue
+				}
+				log.Println("scheduled backup created: ", backup.Name)
+				err = PruneBackups(BackupRetention)
+				if err != nil {
+					log.Println("error pruning backups: ", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"testing"
 	"time"
 
 	"github.com/JuanJoCasamitjana/portfol.io/internal/database/sqlite"
@@ -24,12 +25,64 @@ const ReplicasDirStr = "./replicas"
 
 var Replicas string
 
+// ReplicaPath is the local copy of the database when it runs as an embedded replica, empty otherwise
+var ReplicaPath string
+
+// IsRemote is set when every statement goes straight to the remote database and there is no local file
+var IsRemote bool
+
 func Remigrate() {
+	DB.SetupJoinTable(&model.Section{}, "Posts", &model.SectionPost{})
 	DB.AutoMigrate(&model.User{}, &model.Article{}, &model.Project{}, &model.Image{}, &model.Gallery{},
-		&model.Post{}, &model.Section{}, &model.FollowList{}, &model.Report{}, &model.Tag{})
+		&model.Post{}, &model.Section{}, &model.FollowList{}, &model.Report{}, &model.Tag{}, &model.DataExport{},
+		&model.ImageVariant{}, &model.Comment{}, &model.Reaction{}, &model.SavedPost{}, &model.PostScore{},
+		&model.View{}, &model.FollowEvent{}, &model.Portfolio{}, &model.FeaturedPost{}, &model.SectionAlias{}, &model.CoAuthor{},
+		&model.PreviewLink{}, &model.PreviewFeedback{}, &model.ArticleAutosave{},
+		&model.Block{}, &model.Mute{}, &model.Migration{})
+}
+
+// autoMigrate creates the tables of every model and adds the columns they are missing
+func autoMigrate() error {
+	err := DB.SetupJoinTable(&model.Section{}, "Posts", &model.SectionPost{})
+	if err != nil {
+		return err
+	}
+	return DB.AutoMigrate(&model.User{}, &model.Article{}, &model.Project{}, &model.Image{}, &model.Gallery{},
+		&model.Post{}, &model.Section{}, &model.FollowList{}, &model.Report{}, &model.Tag{}, &model.Vote{},
+		&model.DataExport{}, &model.ImageVariant{}, &model.Comment{}, &model.Reaction{}, &model.SavedPost{}, &model.PostScore{},
+		&model.View{}, &model.FollowEvent{}, &model.Portfolio{}, &model.FeaturedPost{}, &model.SectionAlias{}, &model.CoAuthor{},
+		&model.PreviewLink{}, &model.PreviewFeedback{}, &model.ArticleAutosave{},
+		&model.Block{}, &model.Mute{}, &model.Migration{})
+}
+
+// OpenLocal replaces DB with a local SQLite file and creates its tables. Tests use it to run on a database of
+// their own, foreign keys are checked as the remote database does.
+func OpenLocal(path string) error {
+	db, err := gorm.Open(sqlite.New(sqlite.Config{DriverName: "libsql", DSN: "file:" + path}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+	//The pragma only applies to its connection, so there is a single one
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	err = db.Exec("PRAGMA foreign_keys = ON").Error
+	if err != nil {
+		return err
+	}
+	DB = db
+	return autoMigrate()
 }
 
 func init() {
+	//Tests open their own database with OpenLocal, they must never reach the configured one
+	if testing.Testing() {
+		return
+	}
 	_, err := os.Stat(ReplicasDirStr)
 	if os.IsNotExist(err) {
 		err = os.Mkdir(ReplicasDirStr, 0775)
@@ -81,9 +134,12 @@ func init() {
 	dialectorFinal := sqlite.Open(DBname)
 	if tursoDBUrl != "" {
 		dialectorFinal = tursoDialector
+		IsRemote = true
 	}
 	if replicaConnectorCreated {
 		dialectorFinal = tursoReplicaDialector
+		ReplicaPath = dbPath
+		IsRemote = false
 	}
 	DB, err = gorm.Open(dialectorFinal, &gorm.Config{
 		Logger:                 newLogger,
@@ -92,11 +148,43 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = DB.AutoMigrate(&model.User{}, &model.Article{}, &model.Project{}, &model.Image{}, &model.Gallery{},
-		&model.Post{}, &model.Section{}, &model.FollowList{}, &model.Report{}, &model.Tag{}, &model.Vote{})
+	err = autoMigrate()
 	if err != nil {
 		log.Fatal(err)
 	}
+	//Older versions could leave a vote out of post_votes
+	err = SyncPostVotes()
+	if err != nil {
+		log.Println("Error syncing post votes:", err)
+	}
+	err = NormalizeTags()
+	if err != nil {
+		log.Println("Error normalizing tags:", err)
+	}
+	err = SyncSlugs()
+	if err != nil {
+		log.Println("Error syncing slugs:", err)
+	}
+	err = UniqueSlugs()
+	if err != nil {
+		log.Println("Error making slugs unique:", err)
+	}
+	err = SyncVisibility()
+	if err != nil {
+		log.Println("Error syncing visibility:", err)
+	}
+	err = DropMisplacedUserConstraints()
+	if err != nil {
+		log.Println("Error dropping misplaced user constraints:", err)
+	}
+	err = FailPendingDataExports(model.EXPORT_KIND_DATA)
+	if err != nil {
+		log.Println("Error failing pending data exports:", err)
+	}
+	err = FailPendingDataExports(model.EXPORT_KIND_SITE)
+	if err != nil {
+		log.Println("Error failing pending site exports:", err)
+	}
 	godotenv.Load()
 	ADMIN_USERNAME := os.Getenv("ADMIN_USERNAME")
 	ADMIN_PASSWORD := os.Getenv("ADMIN_PASSWORD")
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// testDBErr tells why the tests that need a database are skipped
+var testDBErr error
+
+func TestMain(m *testing.M) {
+	//libsql writes UTC times ending in Z and only reads them back with a numeric offset
+	time.Local = time.FixedZone("test", 2*60*60)
+	dir, err := os.MkdirTemp("", "portfolio-database-*")
+	if err == nil {
+		err = OpenLocal(filepath.Join(dir, "test.db"))
+	}
+	if err != nil {
+		log.Println("the tests that need a database will be skipped: ", err)
+		testDBErr = err
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// rollbackDB points DB to a transaction of the test database that is rolled back when the test ends,
+// so tests leave no rows behind
+func rollbackDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	if testDBErr != nil {
+		t.Skip("no test database: ", testDBErr)
+	}
+	previous := DB
+	tx := DB.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		DB = previous
+	})
+	return tx
+}
+
+// createUsers stores the users with their follow lists, the rows that posts, votes and follows point to
+func createUsers(t *testing.T, tx *gorm.DB, usernames ...string) {
+	t.Helper()
+	for _, username := range usernames {
+		user := model.User{Username: username, FollowList: model.FollowList{Owner: username}}
+		if err := tx.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// createDraft stores a draft article of author, which also adds it to posts, and returns its post
+func createDraft(t *testing.T, tx *gorm.DB, author, title string) model.Post {
+	t.Helper()
+	article := model.Article{BasePost: model.BasePost{Title: title, Author: author, Visibility: model.VISIBILITY_DRAFT}}
+	if err := tx.Create(&article).Error; err != nil {
+		t.Fatal(err)
+	}
+	var post model.Post
+	if err := tx.Where("owner_type = ? AND owner_id = ?", "article", article.ID).First(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
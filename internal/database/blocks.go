@@ -0,0 +1,129 @@
+package database
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// blockedWith is the subquery of the users the viewer blocked or was blocked by, it takes the viewer twice
+const blockedWith = "(SELECT username FROM blocks WHERE owner = ? UNION SELECT owner FROM blocks WHERE username = ?)"
+
+// notBlocked leaves out the posts of table written or co-written by someone the viewer blocked or was blocked by,
+// the posts the viewer wrote or co-wrote stay
+func notBlocked(viewer, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == "" {
+			return db
+		}
+		return db.Where("("+ownWriting(table)+" OR NOT ("+table+".author IN "+blockedWith+" OR "+postIDColumn(table)+
+			" IN (SELECT post_id FROM co_authors WHERE accepted = true AND username IN "+blockedWith+")))",
+			viewer, viewer, viewer, viewer, viewer, viewer)
+	}
+}
+
+// notMuted leaves out the posts of table written by the users the viewer muted
+func notMuted(viewer, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == "" {
+			return db
+		}
+		return db.Where(table+".author NOT IN (SELECT username FROM mutes WHERE owner = ?)", viewer)
+	}
+}
+
+// BlockUser blocks username for owner, the follows between both of them are removed
+func BlockUser(owner, username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		blocked, err := hasBlocked(tx, owner, username)
+		if err != nil || blocked {
+			return err
+		}
+		err = tx.Create(&model.Block{Owner: owner, Username: username}).Error
+		if err != nil {
+			return err
+		}
+		for _, pair := range [][2]string{{owner, username}, {username, owner}} {
+			following, err := followsUser(tx, pair[0], pair[1])
+			if err != nil {
+				return err
+			}
+			if !following {
+				continue
+			}
+			err = tx.Exec("DELETE FROM follows WHERE owner = ? AND username = ?", pair[0], pair[1]).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&model.FollowEvent{Username: pair[1], Delta: -1}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func UnblockUser(owner, username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("owner = ? AND username = ?", owner, username).Delete(&model.Block{}).Error
+	})
+}
+
+func hasBlocked(tx *gorm.DB, owner, username string) (bool, error) {
+	var count int64
+	err := tx.Model(&model.Block{}).Where("owner = ? AND username = ?", owner, username).Count(&count).Error
+	return count > 0, err
+}
+
+// HasBlocked tells whether owner blocked username, only owner can undo it
+func HasBlocked(owner, username string) (bool, error) {
+	return hasBlocked(DB, owner, username)
+}
+
+// IsBlockedBetween tells whether any of the two users blocked the other
+func IsBlockedBetween(a, b string) (bool, error) {
+	var count int64
+	err := DB.Model(&model.Block{}).Where("(owner = ? AND username = ?) OR (owner = ? AND username = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlockedWithWriterOf tells whether the viewer blocked or was blocked by the author or an accepted co-author of the
+// article, gallery or project
+func IsBlockedWithWriterOf(viewer, ownerType string, ownerID uint64) (bool, error) {
+	var count int64
+	err := DB.Model(&model.Post{}).Where("owner_type = ? AND owner_id = ? AND (author IN "+blockedWith+
+		" OR id IN (SELECT post_id FROM co_authors WHERE accepted = true AND username IN "+blockedWith+"))",
+		ownerType, ownerID, viewer, viewer, viewer, viewer).Count(&count).Error
+	return count > 0, err
+}
+
+// FindUsernamesBlockedWith returns the users the viewer blocked or was blocked by
+func FindUsernamesBlockedWith(viewer string) ([]string, error) {
+	var usernames []string
+	err := DB.Raw(blockedWith, viewer, viewer).Scan(&usernames).Error
+	return usernames, err
+}
+
+func MuteUser(owner, username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.Mute{}).Where("owner = ? AND username = ?", owner, username).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+		return tx.Create(&model.Mute{Owner: owner, Username: username}).Error
+	})
+}
+
+func UnmuteUser(owner, username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("owner = ? AND username = ?", owner, username).Delete(&model.Mute{}).Error
+	})
+}
+
+func HasMuted(owner, username string) (bool, error) {
+	var count int64
+	err := DB.Model(&model.Mute{}).Where("owner = ? AND username = ?", owner, username).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+func listedAndNotMuted(viewer, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(listedFor(viewer, table), notMuted(viewer, table))
+	}
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	params := []struct {
+		name     string
+		blocks   [][2]string
+		mutes    [][2]string
+		viewer   string
+		scope    func(viewer, table string) func(*gorm.DB) *gorm.DB
+		expected []string
+	}{
+		{"blocked_by_writer", [][2]string{{"writer", "fan"}}, nil, "fan", listedFor, nil},
+		{"blocked_writer", [][2]string{{"fan", "writer"}}, nil, "fan", reachableBy, nil},
+		{"blocked_co_author", [][2]string{{"stranger", "fan"}}, nil, "fan", listedFor, []string{"followers", "public"}},
+		{"blocked_by_co_author", [][2]string{{"writer", "stranger"}}, nil, "stranger", reachableBy, []string{"co-followers", "co-private"}},
+		{"own_posts_stay", [][2]string{{"writer", "stranger"}}, nil, "writer", listedFor,
+			[]string{"co-followers", "co-private", "followers", "private", "public", "unlisted"}},
+		{"other_users_block", [][2]string{{"writer", "fan"}}, nil, "nobody", reachableBy, []string{"public", "unlisted"}},
+		{"muted_writer", nil, [][2]string{{"fan", "writer"}}, "fan", listedAndNotMuted, []string{"co-followers"}},
+		{"muted_still_reachable", nil, [][2]string{{"fan", "writer"}}, "fan", reachableBy,
+			[]string{"co-followers", "followers", "public", "unlisted"}},
+		{"anonymous", [][2]string{{"writer", "fan"}}, [][2]string{{"fan", "writer"}}, "", listedAndNotMuted, []string{"public"}},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			tx := rollbackDB(t)
+			createVisibilityPosts(t, tx)
+			for _, block := range p.blocks {
+				if err := tx.Create(&model.Block{Owner: block[0], Username: block[1]}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, mute := range p.mutes {
+				if err := tx.Create(&model.Mute{Owner: mute[0], Username: mute[1]}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			titles := titlesIn(t, tx, p.scope, p.viewer)
+			if !slices.Equal(titles, p.expected) {
+				t.Errorf("expected %v, got %v", p.expected, titles)
+			}
+		})
+	}
+}
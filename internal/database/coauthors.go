@@ -0,0 +1,134 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrTooManyCoAuthors = errors.New("the post can not have more co-authors")
+
+// postIDColumn returns the expression holding the id of the post of each row of table, co-authors point to posts
+func postIDColumn(table string) string {
+	switch table {
+	case "articles":
+		return "(SELECT id FROM posts WHERE posts.owner_type = 'article' AND posts.owner_id = articles.id)"
+	case "galleries":
+		return "(SELECT id FROM posts WHERE posts.owner_type = 'gallery' AND posts.owner_id = galleries.id)"
+	case "projects":
+		return "(SELECT id FROM posts WHERE posts.owner_type = 'project' AND posts.owner_id = projects.id)"
+	}
+	return table + ".id"
+}
+
+// writtenBy keeps the posts of table written by the user, alone or as an accepted co-author
+func writtenBy(username, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(ownWriting(table), username, username)
+	}
+}
+
+func FindCoAuthorsOfPost(postID uint64) ([]model.CoAuthor, error) {
+	var coAuthors []model.CoAuthor
+	err := DB.Where("post_id = ?", postID).Order("created_at, id").Find(&coAuthors).Error
+	return coAuthors, err
+}
+
+// FindCoAuthorNamesOfPosts returns the accepted co-authors of each post, in the order they were invited
+func FindCoAuthorNamesOfPosts(postIDs []uint64) (map[uint64][]string, error) {
+	names := make(map[uint64][]string)
+	if len(postIDs) == 0 {
+		return names, nil
+	}
+	var coAuthors []model.CoAuthor
+	err := DB.Where("post_id IN ? AND accepted = true", postIDs).Order("created_at, id").Find(&coAuthors).Error
+	for _, coAuthor := range coAuthors {
+		names[coAuthor.PostID] = append(names[coAuthor.PostID], coAuthor.Username)
+	}
+	return names, err
+}
+
+func FindCoAuthorByID(id uint64) (model.CoAuthor, error) {
+	var coAuthor model.CoAuthor
+	err := DB.First(&coAuthor, id).Error
+	return coAuthor, err
+}
+
+func FindCoAuthor(postID uint64, username string) (model.CoAuthor, error) {
+	var coAuthor model.CoAuthor
+	err := DB.Where("post_id = ? AND username = ?", postID, username).First(&coAuthor).Error
+	return coAuthor, err
+}
+
+// FindCoAuthorOfOwner looks the user up among the co-authors of the article, gallery or project
+func FindCoAuthorOfOwner(username, ownerType string, ownerID uint64) (model.CoAuthor, error) {
+	var coAuthor model.CoAuthor
+	err := DB.Joins("JOIN posts ON posts.id = co_authors.post_id").
+		Where("posts.owner_type = ? AND posts.owner_id = ? AND co_authors.username = ?", ownerType, ownerID, username).
+		First(&coAuthor).Error
+	return coAuthor, err
+}
+
+// InviteCoAuthor stores the invitation, the user is not a co-author until it is accepted.
+// The limit is checked by the insert itself so two invitations at once can not go over it.
+func InviteCoAuthor(coAuthor *model.CoAuthor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		now := tx.NowFunc()
+		result := tx.Exec(`INSERT INTO co_authors (post_id, username, role, accepted, invited_by, created_at, updated_at)
+			SELECT ?, ?, ?, false, ?, ?, ? WHERE (SELECT COUNT(*) FROM co_authors WHERE post_id = ?) < ?`,
+			coAuthor.PostID, coAuthor.Username, coAuthor.Role, coAuthor.InvitedBy, now, now, coAuthor.PostID, model.COAUTHORS_MAX)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTooManyCoAuthors
+		}
+		return tx.Where("post_id = ? AND username = ?", coAuthor.PostID, coAuthor.Username).First(coAuthor).Error
+	})
+}
+
+// AcceptCoAuthorInvitation goes through the hooks, the followers of the new co-author are told about the post
+func AcceptCoAuthorInvitation(coAuthor *model.CoAuthor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		coAuthor.Accepted = true
+		return tx.Model(coAuthor).Select("accepted").Updates(coAuthor).Error
+	})
+}
+
+func UpdateCoAuthorRole(coAuthor *model.CoAuthor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(coAuthor).UpdateColumn("role", coAuthor.Role).Error
+	})
+}
+
+// DeleteCoAuthor is used to decline an invitation, to leave a post and to remove someone from it.
+// The post leaves the sections and the portfolio of the co-author too.
+func DeleteCoAuthor(coAuthor *model.CoAuthor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("post_id = ? AND section_id IN (SELECT id FROM sections WHERE owner = ?)", coAuthor.PostID, coAuthor.Username).
+			Delete(&model.SectionPost{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("post_id = ? AND owner = ?", coAuthor.PostID, coAuthor.Username).Delete(&model.FeaturedPost{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(coAuthor).Error
+	})
+}
+
+// FindPendingInvitations returns the invitations the user has not answered yet, the newest first
+func FindPendingInvitations(username string) ([]model.CoAuthor, error) {
+	var invitations []model.CoAuthor
+	err := DB.Preload("Post").Where("username = ? AND accepted = false", username).
+		Order("created_at desc, id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func CountPendingInvitations(username string) (int64, error) {
+	var count int64
+	err := DB.Model(&model.CoAuthor{}).Where("username = ? AND accepted = false", username).Count(&count).Error
+	return count, err
+}
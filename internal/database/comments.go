@@ -0,0 +1,68 @@
+package database
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateComment(comment *model.Comment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(comment).Error
+	})
+}
+
+func FindCommentByID(id uint64) (model.Comment, error) {
+	var comment model.Comment
+	err := DB.Preload("Post").First(&comment, id).Error
+	return comment, err
+}
+
+// FindCommentsOfPost returns every comment of the post oldest first, the threads are built by the caller
+func FindCommentsOfPost(postID uint64) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := DB.Where("post_id = ?", postID).Preload("User").Order("created_at, id").Find(&comments).Error
+	return comments, err
+}
+
+func CountPendingCommentsOfPost(postID uint64) (int64, error) {
+	var count int64
+	err := DB.Model(&model.Comment{}).Where("post_id = ? AND approved = ?", postID, false).Count(&count).Error
+	return count, err
+}
+
+func ApproveComment(comment *model.Comment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(comment).Update("approved", true).Error
+	})
+}
+
+// DeleteComment deletes the comment with all of its replies
+func DeleteComment(comment *model.Comment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return deleteCommentTrees(tx, []uint64{comment.ID})
+	})
+}
+
+func UpdatePostCommentsMode(post *model.Post, mode string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(post).UpdateColumn("comments_mode", mode).Error
+	})
+}
+
+// deleteCommentTrees deletes the given comments and every reply below them
+func deleteCommentTrees(tx *gorm.DB, roots []uint64) error {
+	ids := roots
+	for level := roots; len(level) > 0; {
+		var replies []uint64
+		err := tx.Model(&model.Comment{}).Where("parent_id IN ?", level).Pluck("id", &replies).Error
+		if err != nil {
+			return err
+		}
+		ids = append(ids, replies...)
+		level = replies
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", ids).Delete(&model.Comment{}).Error
+}
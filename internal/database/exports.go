@@ -0,0 +1,57 @@
+package database
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// VoteCast is a vote of a user together with the post it was cast on
+type VoteCast struct {
+	Tag      string
+	PostType string
+	PostID   uint64
+}
+
+func CreateDataExport(export *model.DataExport) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(export).Error
+	})
+}
+
+func UpdateDataExport(export *model.DataExport) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Save(export).Error
+	})
+}
+
+// FailPendingDataExports marks the exports of a kind that are still pending as failed. They are built in the
+// background, so the ones pending when the application starts were interrupted and would block new requests.
+func FailPendingDataExports(kind string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&model.DataExport{}).Where("status = ? AND kind = ?", model.EXPORT_PENDING, kind).
+			Update("status", model.EXPORT_FAILED).Error
+	})
+}
+
+func FindLatestDataExportByOwner(username, kind string) (model.DataExport, error) {
+	var export model.DataExport
+	err := DB.Where("owner = ? AND kind = ?", username, kind).Order("created_at desc").First(&export).Error
+	return export, err
+}
+
+func FindDataExportsByOwner(username string) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := DB.Where("owner = ?", username).Find(&exports).Error
+	return exports, err
+}
+
+func FindVotesCastByUser(username string) ([]VoteCast, error) {
+	var votes []VoteCast
+	err := DB.Raw(`SELECT tags.name AS tag, 'article' AS post_type, article_votes.article_id AS post_id FROM votes
+		JOIN tags ON tags.id = votes.tag_id JOIN article_votes ON article_votes.vote_id = votes.id WHERE votes.voter = ?
+		UNION ALL
+		SELECT tags.name AS tag, 'gallery' AS post_type, gallery_votes.gallery_id AS post_id FROM votes
+		JOIN tags ON tags.id = votes.tag_id JOIN gallery_votes ON gallery_votes.vote_id = votes.id WHERE votes.voter = ?`,
+		username, username).Scan(&votes).Error
+	return votes, err
+}
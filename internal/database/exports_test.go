@@ -0,0 +1,38 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+)
+
+func TestFailPendingDataExports(t *testing.T) {
+	tx := rollbackDB(t)
+	createUsers(t, tx, "exporter")
+	exports := []model.DataExport{
+		{Owner: "exporter", Kind: model.EXPORT_KIND_DATA, Status: model.EXPORT_PENDING},
+		{Owner: "exporter", Kind: model.EXPORT_KIND_DATA, Status: model.EXPORT_READY},
+		{Owner: "exporter", Kind: model.EXPORT_KIND_SITE, Status: model.EXPORT_PENDING},
+	}
+	for i := range exports {
+		if err := tx.Create(&exports[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := FailPendingDataExports(model.EXPORT_KIND_DATA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{model.EXPORT_FAILED, model.EXPORT_READY, model.EXPORT_PENDING}
+	for i, export := range exports {
+		var stored model.DataExport
+		if err := tx.First(&stored, export.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != expected[i] {
+			t.Errorf("export %d: expected status %s, got %s", i, expected[i], stored.Status)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// ImportedPost is an imported article or gallery together with everything created along with it.
+// Tags are already normalized, Cover is the index of the cover in Images or -1.
+type ImportedPost struct {
+	Article  *model.Article
+	Gallery  *model.Gallery
+	Images   []model.Image
+	Cover    int
+	Tags     []string
+	Sections []string
+}
+
+// ImportPost creates the post, its images, the votes of the importer for its tags and the sections it goes to in a
+// single transaction, a failure leaves nothing behind. Banned tags are skipped.
+func ImportPost(imported *ImportedPost, username string) error {
+	var slug *string
+	if imported.Article != nil {
+		slug = &imported.Article.Slug
+	} else {
+		slug = &imported.Gallery.Slug
+	}
+	return retryOnSlugConflict(slug, func() error {
+		return importPost(imported, username)
+	})
+}
+
+func importPost(imported *ImportedPost, username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var post model.Post
+		if imported.Article != nil {
+			err := tx.Create(imported.Article).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("owner_id = ? AND owner_type = ?", imported.Article.ID, "article").First(&post).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			err := tx.Create(imported.Gallery).Error
+			if err != nil {
+				return err
+			}
+			for i := range imported.Images {
+				imported.Images[i].GalleryID = imported.Gallery.ID
+				err = createImage(tx, &imported.Images[i])
+				if err != nil {
+					return err
+				}
+				if i == imported.Cover {
+					err = tx.Model(imported.Gallery).UpdateColumn("cover_id", imported.Images[i].ID).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+			err = tx.Where("owner_id = ? AND owner_type = ?", imported.Gallery.ID, "gallery").First(&post).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := importTags(tx, post, imported.Tags, username)
+		if err != nil {
+			return err
+		}
+		for _, sectionName := range imported.Sections {
+			var section model.Section
+			err = tx.Where("owner = ? AND name = ?", username, sectionName).First(&section).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				section = model.Section{Name: sectionName, Owner: username}
+				err = createSection(tx, &section)
+			}
+			if err != nil {
+				return err
+			}
+			err = addPostsToSection(tx, &section, []uint64{post.ID})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// importTags votes the tags for the post, creating the ones that do not exist yet
+func importTags(tx *gorm.DB, post model.Post, names []string, username string) error {
+	voted := make(map[uint64]bool, len(names))
+	for _, name := range names {
+		tag, err := resolveTag(tx, name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tag = model.Tag{Name: name}
+			err = tx.Create(&tag).Error
+		}
+		if err != nil {
+			return err
+		}
+		//Two names may stand for the same tag once aliases are resolved
+		if tag.Banned || voted[tag.ID] {
+			continue
+		}
+		voted[tag.ID] = true
+		err = voteTagForPost(tx, post, &model.Vote{TagID: tag.ID, Voter: username})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
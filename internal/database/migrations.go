@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// runOnce applies the data migration unless it was applied before, the migration and its marker are written
+// in the same transaction so a failed one is tried again on the next start
+func runOnce(name string, migrate func(tx *gorm.DB) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var migration model.Migration
+		err := tx.Where("name = ?", name).First(&migration).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		err = migrate(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.Migration{Name: name}).Error
+	})
+}
+
+// Foreign keys that older versions put on users by mistake, they pointed to tables that are not unique by
+// username so every insert of a user failed once the database checked them
+var misplacedUserConstraints = []string{"fk_reactions_user", "fk_saved_posts_user", "fk_co_authors_user"}
+
+// DropMisplacedUserConstraints removes those foreign keys from users. SQLite rebuilds the table to drop them,
+// the foreign keys are not checked meanwhile because the tables pointing to users would fail while it is replaced.
+func DropMisplacedUserConstraints() error {
+	var names []string
+	for _, name := range misplacedUserConstraints {
+		if DB.Migrator().HasConstraint(&model.User{}, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	//The pragma only applies to its connection and outside of transactions
+	return DB.Connection(func(conn *gorm.DB) error {
+		var enabled bool
+		err := conn.Raw("PRAGMA foreign_keys").Scan(&enabled).Error
+		if err != nil {
+			return err
+		}
+		if enabled {
+			err = conn.Exec("PRAGMA foreign_keys = OFF").Error
+			if err != nil {
+				return err
+			}
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+		}
+		for _, name := range names {
+			err = conn.Migrator().DropConstraint(&model.User{}, name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTooManyFeaturedPosts = errors.New("too many featured posts")
+	ErrDomainTaken          = errors.New("the domain is used by another portfolio")
+)
+
+// FindPortfolioByOwner returns the portfolio of the user, or the default one if it was never customized
+func FindPortfolioByOwner(username string) (model.Portfolio, error) {
+	var portfolio model.Portfolio
+	err := DB.Where("owner = ?", username).First(&portfolio).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Portfolio{Owner: username, Theme: model.THEME_CLASSIC}, nil
+	}
+	return portfolio, err
+}
+
+func FindPortfolioByDomain(domain string) (model.Portfolio, error) {
+	var portfolio model.Portfolio
+	err := DB.Where("domain = ? AND domain <> '' AND domain_verified = true", domain).First(&portfolio).Error
+	return portfolio, err
+}
+
+// SavePortfolio refuses domains another portfolio has verified, unverified ones can be claimed by anyone
+func SavePortfolio(portfolio *model.Portfolio) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := checkDomainFree(tx, portfolio)
+		if err != nil {
+			return err
+		}
+		return tx.Save(portfolio).Error
+	})
+}
+
+// VerifyPortfolioDomain marks the domain as proven, the first portfolio to verify a domain keeps it
+func VerifyPortfolioDomain(portfolio *model.Portfolio) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := checkDomainFree(tx, portfolio)
+		if err != nil {
+			return err
+		}
+		portfolio.DomainVerified = true
+		return tx.Model(portfolio).UpdateColumn("domain_verified", true).Error
+	})
+}
+
+func checkDomainFree(tx *gorm.DB, portfolio *model.Portfolio) error {
+	if portfolio.Domain == "" {
+		return nil
+	}
+	var count int64
+	err := tx.Model(&model.Portfolio{}).Where("domain = ? AND owner <> ? AND domain_verified = true", portfolio.Domain, portfolio.Owner).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDomainTaken
+	}
+	return nil
+}
+
+// FindFeaturedPosts returns the public posts pinned by the user in the order they were pinned
+func FindFeaturedPosts(username string) ([]model.Post, error) {
+	var posts []model.Post
+	err := DB.Joins("JOIN featured_posts ON featured_posts.post_id = posts.id").
+		Where("featured_posts.owner = ? AND posts.visibility = ?", username, model.VISIBILITY_PUBLIC).
+		Order("featured_posts.position, featured_posts.id").Find(&posts).Error
+	return posts, err
+}
+
+func FindFeaturedPostIDs(username string) ([]uint64, error) {
+	var ids []uint64
+	err := DB.Model(&model.FeaturedPost{}).Where("owner = ?", username).Pluck("post_id", &ids).Error
+	return ids, err
+}
+
+// ToggleFeaturedPost pins the post or unpins it if it already was, returning whether it ended up pinned
+func ToggleFeaturedPost(username string, postID uint64) (bool, error) {
+	featured := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("owner = ? AND post_id = ?", username, postID).Delete(&model.FeaturedPost{})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		var count int64
+		err := tx.Model(&model.FeaturedPost{}).Where("owner = ?", username).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= model.FEATURED_POSTS_MAX {
+			return ErrTooManyFeaturedPosts
+		}
+		featured = true
+		return tx.Create(&model.FeaturedPost{Owner: username, PostID: postID, Position: int(count) + 1}).Error
+	})
+	return featured, err
+}
+
+// MoveSection swaps the section with the one before (offset -1) or after it (offset 1) and numbers them again
+func MoveSection(username, name string, offset int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var sections []model.Section
+		err := tx.Where("owner = ?", username).Order("position, id").Find(&sections).Error
+		if err != nil {
+			return err
+		}
+		for i := range sections {
+			if sections[i].Name != name {
+				continue
+			}
+			if j := i + offset; j >= 0 && j < len(sections) {
+				sections[i], sections[j] = sections[j], sections[i]
+			}
+			break
+		}
+		for i := range sections {
+			err = tx.Model(&sections[i]).UpdateColumn("position", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+)
+
+func TestMoveSection(t *testing.T) {
+	params := []struct {
+		name     string
+		section  string
+		offset   int
+		expected []string
+	}{
+		{"up", "second", -1, []string{"second", "first", "third"}},
+		{"down", "second", 1, []string{"first", "third", "second"}},
+		{"first_up", "first", -1, []string{"first", "second", "third"}},
+		{"last_down", "third", 1, []string{"first", "second", "third"}},
+		{"unknown", "missing", 1, []string{"first", "second", "third"}},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			tx := rollbackDB(t)
+			createUsers(t, tx, "mover", "other")
+			//Sections created before they had a position all share position 0 and are ordered by id
+			sections := []model.Section{
+				{Name: "first", Owner: "mover"},
+				{Name: "second", Owner: "mover"},
+				{Name: "third", Owner: "mover"},
+				{Name: "second", Owner: "other", Position: 7},
+			}
+			for i := range sections {
+				if err := tx.Create(&sections[i]).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := MoveSection("mover", p.section, p.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var moved []model.Section
+			tx.Where("owner = ?", "mover").Order("position").Find(&moved)
+			var names []string
+			for i, section := range moved {
+				names = append(names, section.Name)
+				if section.Position != i+1 {
+					t.Errorf("expected %s at position %d, got %d", section.Name, i+1, section.Position)
+				}
+			}
+			if !slices.Equal(names, p.expected) {
+				t.Errorf("expected %v, got %v", p.expected, names)
+			}
+			var other model.Section
+			tx.First(&other, sections[3].ID)
+			if other.Position != 7 {
+				t.Errorf("expected the section of another user to stay at 7, got %d", other.Position)
+			}
+		})
+	}
+}
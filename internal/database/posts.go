@@ -7,13 +7,15 @@ import (
 	"gorm.io/gorm"
 )
 
-func FindPostsPaginated(page, page_size int) ([]model.Post, error) {
+var ErrInvalidImageOrder = errors.New("the order does not match the images of the gallery")
+
+func FindPostsPaginated(viewer string, page, page_size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * page_size
 	var posts []model.Post
-	err := DB.Where("published = ?", true).Order("updated_at desc").Offset(offset).Limit(page_size).Find(&posts).Error
+	err := DB.Scopes(listedFor(viewer, "posts"), notMuted(viewer, "posts")).Order("updated_at desc").Offset(offset).Limit(page_size).Find(&posts).Error
 	return posts, err
 }
 
@@ -31,13 +33,15 @@ func FindProjectByID(id uint64) (model.Project, error) {
 
 func FindGalleryByID(id uint64) (model.Gallery, error) {
 	var gallery model.Gallery
-	err := DB.Preload("Images").Preload("Votes.Tag").First(&gallery, id).Error
+	err := DB.Preload("Images", orderedImages).Preload("Images.Variants").Preload("Votes.Tag").First(&gallery, id).Error
 	return gallery, err
 }
 
 func CreateArticle(article *model.Article) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(&model.Article{}).Create(article).Error
+	return retryOnSlugConflict(&article.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(&model.Article{}).Create(article).Error
+		})
 	})
 }
 
@@ -52,8 +56,10 @@ func FindAllArticlesByAuthorPaginated(author string, page, size int) ([]model.Ar
 }
 
 func UpdateArticle(article *model.Article) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(article).Updates(article).Error
+	return retryOnSlugConflict(&article.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(article).Updates(article).Error
+		})
 	})
 }
 
@@ -64,29 +70,101 @@ func DeleteArticle(article *model.Article) error {
 }
 
 func CreateGallery(gallery *model.Gallery) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(&model.Gallery{}).Create(gallery).Error
+	return retryOnSlugConflict(&gallery.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(&model.Gallery{}).Create(gallery).Error
+		})
 	})
 }
 
+// CreateImage places the image after the last one of its gallery
 func CreateImage(image *model.Image) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(&model.Image{}).Create(image).Error
+		return createImage(tx, image)
 	})
 }
 
-func UpdateGallery(gallery *model.Gallery) error {
+func createImage(tx *gorm.DB, image *model.Image) error {
+	err := tx.Model(&model.Image{}).Where("gallery_id = ?", image.GalleryID).
+		Select("COALESCE(MAX(position), -1) + 1").Scan(&image.Position).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&model.Image{}).Create(image).Error
+}
+
+// UpdateImage only saves the texts of the image, they can be emptied
+func UpdateImage(image *model.Image) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(image).Select("footer", "alt").Updates(image).Error
+	})
+}
+
+// ReorderGalleryImages sets the position of every image of the gallery to its index in ids
+func ReorderGalleryImages(galleryID uint64, ids []uint64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.Image{}).Where("gallery_id = ?", galleryID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count != int64(len(ids)) {
+			return ErrInvalidImageOrder
+		}
+		seen := make(map[uint64]bool, len(ids))
+		for position, id := range ids {
+			if seen[id] {
+				return ErrInvalidImageOrder
+			}
+			seen[id] = true
+			result := tx.Model(&model.Image{}).Where("id = ? AND gallery_id = ?", id, galleryID).
+				UpdateColumn("position", position)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return ErrInvalidImageOrder
+			}
+		}
+		return nil
+	})
+}
+
+// SetGalleryCover skips the hooks, choosing a cover is not an edit of the gallery
+func SetGalleryCover(gallery *model.Gallery, imageID uint64) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(gallery).Updates(gallery).Error
+		return tx.Model(gallery).UpdateColumn("cover_id", imageID).Error
+	})
+}
+
+func UpdateGallery(gallery *model.Gallery) error {
+	return retryOnSlugConflict(&gallery.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(gallery).Updates(gallery).Error
+		})
 	})
 }
 
 func DeleteImage(image *model.Image) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("image_id = ?", image.ID).Delete(&model.ImageVariant{}).Error
+		if err != nil {
+			return err
+		}
+		//The gallery goes back to its first image when the cover is removed
+		err = tx.Table("galleries").Where("id = ? AND cover_id = ?", image.GalleryID, image.ID).
+			UpdateColumn("cover_id", 0).Error
+		if err != nil {
+			return err
+		}
 		return tx.Model(image).Delete(image).Error
 	})
 }
 
+func orderedImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
 func FindImageByID(id uint64) (model.Image, error) {
 	var image model.Image
 	err := DB.First(&image, id).Error
@@ -99,7 +177,7 @@ func FindAllGalleriesByAuthorPaginated(author string, page, size int) ([]model.G
 	}
 	offset := (page - 1) * size
 	var galleries []model.Gallery
-	err := DB.Model(&model.Gallery{}).Where("author = ?", author).Order("updated_at desc").Offset(offset).Limit(size).Preload("Images").
+	err := DB.Model(&model.Gallery{}).Where("author = ?", author).Order("updated_at desc").Offset(offset).Limit(size).Preload("Images", orderedImages).
 		Find(&galleries).Error
 	return galleries, err
 }
@@ -116,9 +194,12 @@ func CreateTag(tag *model.Tag) error {
 	})
 }
 
+// FindTagLikeName looks for usable tags, a match on an alias returns the tag it stands for
 func FindTagLikeName(name string, limit int) ([]model.Tag, error) {
 	var tags []model.Tag
-	err := DB.Where("name LIKE ?", "%"+name+"%").Limit(limit).Find(&tags).Error
+	err := DB.Where("banned = false AND alias_of_id = 0").
+		Where(DB.Where("name LIKE ?", "%"+name+"%").Or("id IN (SELECT alias_of_id FROM tags WHERE name LIKE ?)", "%"+name+"%")).
+		Order("name").Limit(limit).Find(&tags).Error
 	return tags, err
 }
 
@@ -128,26 +209,28 @@ func DeleteGallery(gallery *model.Gallery) error {
 	})
 }
 
-func FindAllArticlesByTagPaginated(tag string, page, size int) ([]model.Article, error) {
+func FindAllArticlesByTagPaginated(viewer, tag string, page, size int) ([]model.Article, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * size
 	var articles []model.Article
-	err := DB.Model(&model.Article{}).Joins("JOIN article_tags ON articles.id = article_tags.article_id").
-		Joins("JOIN tags ON article_tags.tag_id = tags.id").Where("tags.name = ?", tag).Order("updated_at desc").
+	err := DB.Model(&model.Article{}).Joins("JOIN article_votes ON articles.id = article_votes.article_id").
+		Joins("JOIN votes ON votes.id = article_votes.vote_id").Joins("JOIN tags ON votes.tag_id = tags.id").
+		Where("tags.name = ?", tag).Scopes(listedFor(viewer, "articles"), notMuted(viewer, "articles")).Group("articles.id").Order("articles.updated_at desc").
 		Offset(offset).Limit(size).Find(&articles).Error
 	return articles, err
 }
 
-func FindAllGalleriesByTagPaginated(tag string, page, size int) ([]model.Gallery, error) {
+func FindAllGalleriesByTagPaginated(viewer, tag string, page, size int) ([]model.Gallery, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * size
 	var galleries []model.Gallery
-	err := DB.Model(&model.Gallery{}).Preload("Images").Joins("JOIN gallery_tags ON galleries.id = gallery_tags.gallery_id").
-		Joins("JOIN tags ON gallery_tags.tag_id = tags.id").Where("tags.name = ?", tag).Order("updated_at desc").
+	err := DB.Model(&model.Gallery{}).Preload("Images", orderedImages).Joins("JOIN gallery_votes ON galleries.id = gallery_votes.gallery_id").
+		Joins("JOIN votes ON votes.id = gallery_votes.vote_id").Joins("JOIN tags ON votes.tag_id = tags.id").
+		Where("tags.name = ?", tag).Scopes(listedFor(viewer, "galleries"), notMuted(viewer, "galleries")).Group("galleries.id").Order("galleries.updated_at desc").
 		Offset(offset).Limit(size).Find(&galleries).Error
 	return galleries, err
 }
@@ -170,35 +253,35 @@ func CountArticles() (int64, error) {
 	return count, err
 }
 
-func FindPostsByQueryPaginated(query string, page, size int) ([]model.Post, error) {
+func FindPostsByQueryPaginated(viewer, query string, page, size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * size
 	var posts []model.Post
-	err := DB.Where("title LIKE ? AND published = true", "%"+query+"%").Order("updated_at desc").Offset(offset).
+	err := DB.Where("title LIKE ?", "%"+query+"%").Scopes(listedFor(viewer, "posts"), notMuted(viewer, "posts")).Order("updated_at desc").Offset(offset).
 		Limit(size).Find(&posts).Error
 	return posts, err
 }
 
-func FindArticlesByQueryPaginated(query string, page, size int) ([]model.Article, error) {
+func FindArticlesByQueryPaginated(viewer, query string, page, size int) ([]model.Article, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * size
 	var articles []model.Article
-	err := DB.Where("title LIKE ? AND published = true", "%"+query+"%").Order("updated_at desc").Offset(offset).
+	err := DB.Where("title LIKE ?", "%"+query+"%").Scopes(listedFor(viewer, "articles"), notMuted(viewer, "articles")).Order("updated_at desc").Offset(offset).
 		Limit(size).Find(&articles).Error
 	return articles, err
 }
 
-func FindGalleriesByQueryPaginated(query string, page, size int) ([]model.Gallery, error) {
+func FindGalleriesByQueryPaginated(viewer, query string, page, size int) ([]model.Gallery, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * size
 	var galleries []model.Gallery
-	err := DB.Where("title LIKE ?  AND published = true", "%"+query+"%").Order("updated_at desc").Preload("Images").
+	err := DB.Where("title LIKE ?", "%"+query+"%").Scopes(listedFor(viewer, "galleries"), notMuted(viewer, "galleries")).Order("updated_at desc").Preload("Images", orderedImages).
 		Offset(offset).Limit(size).Find(&galleries).Error
 	return galleries, err
 }
@@ -294,7 +377,7 @@ func GetFirstFiftyMostVotedTagsForGallery(galleryID uint64) ([]model.Tag, error)
 	err := DB.Table("tags").
 		Select("tags.id, tags.name").Joins("JOIN votes ON votes.tag_id = tags.id").
 		Joins("JOIN gallery_votes ON gallery_votes.vote_id = votes.id").
-		Where("gallery_votes.article_id = ?", galleryID).Group("tags.id, tags.name").
+		Where("gallery_votes.gallery_id = ?", galleryID).Group("tags.id, tags.name").
 		Order("COUNT(votes.id) DESC").Limit(50).Scan(&tags).Error
 	if err != nil {
 		return nil, err
@@ -302,39 +385,90 @@ func GetFirstFiftyMostVotedTagsForGallery(galleryID uint64) ([]model.Tag, error)
 	return tags, nil
 }
 
-func VoteTagForArticle(article *model.Article, vote *model.Vote) error {
+// VoteTagForPost stores the vote in the join table of the post type and in the post index
+func VoteTagForPost(post model.Post, vote *model.Vote) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(article).Association("Votes").Append(vote)
+		return voteTagForPost(tx, post, vote)
 	})
 }
 
-func VoteTagForGallery(gallery *model.Gallery, vote *model.Vote) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(gallery).Association("Votes").Append(vote)
-	})
+func voteTagForPost(tx *gorm.DB, post model.Post, vote *model.Vote) error {
+	err := tx.Create(vote).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Table(post.OwnerType + "_votes").Create(map[string]any{post.OwnerType + "_id": post.OwnerID, "vote_id": vote.ID}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Table("post_votes").Create(map[string]any{"post_id": post.ID, "vote_id": vote.ID}).Error
 }
 
-func UnvoteTagForArticle(article *model.Article, vote *model.Vote) error {
+// UnvoteTagForPost removes the vote of the user for the tag on the post from every table
+func UnvoteTagForPost(post model.Post, tagID uint64, voter string) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(article).Association("Votes").Delete(vote)
+		var voteIDs []uint64
+		err := tx.Table("votes").Joins("JOIN "+post.OwnerType+"_votes ON votes.id = "+post.OwnerType+"_votes.vote_id").
+			Where("votes.tag_id = ? AND votes.voter = ? AND "+post.OwnerType+"_votes."+post.OwnerType+"_id = ?", tagID, voter, post.OwnerID).
+			Pluck("votes.id", &voteIDs).Error
+		if err != nil {
+			return err
+		}
+		return deleteVotes(tx, voteIDs)
 	})
 }
 
-func UnvoteTagForGallery(gallery *model.Gallery, vote *model.Vote) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(gallery).Association("Votes").Delete(vote)
-	})
-}
-func RemoveAllVotesForArticle(article *model.Article) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(article).Association("Votes").Clear()
+func deleteVotes(tx *gorm.DB, voteIDs []uint64) error {
+	if len(voteIDs) == 0 {
+		return nil
+	}
+	for _, table := range []string{"article_votes", "gallery_votes", "project_votes", "post_votes"} {
+		err := tx.Exec("DELETE FROM "+table+" WHERE vote_id IN ?", voteIDs).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ?", voteIDs).Delete(&model.Vote{}).Error
+}
+
+// SyncPostVotes adds to post_votes the votes older versions only stored in the join table of the post type.
+// It runs once and never removes votes.
+func SyncPostVotes() error {
+	return runOnce("sync_post_votes", func(tx *gorm.DB) error {
+		for _, postType := range []string{"article", "gallery", "project"} {
+			err := tx.Exec(`INSERT INTO post_votes (post_id, vote_id) SELECT posts.id, `+postType+`_votes.vote_id FROM `+postType+`_votes
+				JOIN posts ON posts.owner_id = `+postType+`_votes.`+postType+`_id AND posts.owner_type = ?
+				WHERE NOT EXISTS (SELECT 1 FROM post_votes WHERE post_votes.post_id = posts.id AND post_votes.vote_id = `+postType+`_votes.vote_id)`,
+				postType).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 }
 
-func RemoveAllVotesForGallery(gallery *model.Gallery) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(gallery).Association("Votes").Clear()
-	})
+// CountTagVotesOfPosts returns the tags of each post with their votes, most voted first
+func CountTagVotesOfPosts(postIDs []uint64) (map[uint64][]TagVotes, error) {
+	counts := make(map[uint64][]TagVotes)
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		PostID uint64
+		TagVotes
+	}
+	err := DB.Table("post_votes").Select("post_votes.post_id, tags.id, tags.name, COUNT(votes.id) AS votes").
+		Joins("JOIN votes ON votes.id = post_votes.vote_id").Joins("JOIN tags ON tags.id = votes.tag_id").
+		Where("post_votes.post_id IN ?", postIDs).Group("post_votes.post_id, tags.id, tags.name").
+		Order("COUNT(votes.id) DESC, tags.name").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.PostID] = append(counts[row.PostID], row.TagVotes)
+	}
+	return counts, nil
 }
 
 func FindVoteByTagAndUser(tagID uint64, username string) (model.Vote, error) {
@@ -353,7 +487,22 @@ func VoteExistsForTagUserAndPost(tagID uint64, voter string, postID uint64, post
 	return count > 0
 }
 
-func FindPaginatedPostsByTagOrderedByNumberOfVotes(tagName string, page, size int) ([]model.Post, error) {
+// TagVotes is a tag with the amount of votes it got
+type TagVotes struct {
+	ID    uint64
+	Name  string
+	Votes int64
+}
+
+func FindPaginatedPostsByTagOrderedByNumberOfVotes(viewer, tagName string, page, size int) ([]model.Post, error) {
+	return findPaginatedPostsByTag(viewer, tagName, "COUNT(votes.id) DESC, posts.updated_at DESC", page, size)
+}
+
+func FindPaginatedPostsByTagOrderedByDate(viewer, tagName string, page, size int) ([]model.Post, error) {
+	return findPaginatedPostsByTag(viewer, tagName, "posts.created_at DESC, posts.id DESC", page, size)
+}
+
+func findPaginatedPostsByTag(viewer, tagName, order string, page, size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -365,10 +514,31 @@ func FindPaginatedPostsByTagOrderedByNumberOfVotes(tagName string, page, size in
 		Joins("JOIN votes ON votes.id = post_votes.vote_id").
 		Joins("JOIN tags ON tags.id = votes.tag_id").
 		Where("tags.name = ?", tagName).
+		Scopes(listedFor(viewer, "posts"), notMuted(viewer, "posts")).
 		Group("posts.id").
+		Order(order).
 		Offset(offset).
 		Limit(size).
 		Find(&posts).Error
 	return posts, err
 }
-	
\ No newline at end of file
+
+// CountPostsAndVotesOfTag returns in how many public posts the tag was voted and how many votes it got there
+func CountPostsAndVotesOfTag(tagName string) (int64, int64, error) {
+	var result struct {
+		Posts int64
+		Votes int64
+	}
+	err := DB.Table("posts").Select("COUNT(DISTINCT posts.id) AS posts, COUNT(votes.id) AS votes").
+		Joins("JOIN post_votes ON post_votes.post_id = posts.id").
+		Joins("JOIN votes ON votes.id = post_votes.vote_id").
+		Joins("JOIN tags ON tags.id = votes.tag_id").
+		Where("tags.name = ? AND posts.visibility = ?", tagName, model.VISIBILITY_PUBLIC).Scan(&result).Error
+	return result.Posts, result.Votes, err
+}
+
+func FindPostByOwner(ownerID uint64, ownerType string) (model.Post, error) {
+	var post model.Post
+	err := DB.Where("owner_id = ? AND owner_type = ?", ownerID, ownerType).First(&post).Error
+	return post, err
+}
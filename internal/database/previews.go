@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrTooManyPreviewLinks = errors.New("the post can not have more preview links")
+
+var ErrTooMuchPreviewFeedback = errors.New("the preview link can not take more feedback")
+
+// CreatePreviewLink stores the link, expired links count until the author removes them
+func CreatePreviewLink(link *model.PreviewLink) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.PreviewLink{}).Where("post_id = ?", link.PostID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= model.PREVIEW_LINKS_MAX {
+			return ErrTooManyPreviewLinks
+		}
+		return tx.Create(link).Error
+	})
+}
+
+func FindPreviewLinksOfPost(postID uint64) ([]model.PreviewLink, error) {
+	var links []model.PreviewLink
+	err := DB.Where("post_id = ?", postID).Order("created_at desc, id desc").Find(&links).Error
+	return links, err
+}
+
+func FindPreviewLinkByID(id uint64) (model.PreviewLink, error) {
+	var link model.PreviewLink
+	err := DB.Preload("Post").First(&link, id).Error
+	return link, err
+}
+
+// FindValidPreviewLink looks the token up among the links that did not expire
+func FindValidPreviewLink(token string) (model.PreviewLink, error) {
+	var link model.PreviewLink
+	err := DB.Preload("Post").Where("token = ? AND expires_at > ?", token, time.Now()).First(&link).Error
+	return link, err
+}
+
+// DeletePreviewLink revokes the link, the feedback left through it is kept
+func DeletePreviewLink(link *model.PreviewLink) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(link).Error
+	})
+}
+
+// CreatePreviewFeedback stores the feedback unless the link already took as much as it can,
+// the limit is checked by the insert itself so reviewers sending at once can not go over it
+func CreatePreviewFeedback(feedback *model.PreviewFeedback) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		now := tx.NowFunc()
+		result := tx.Exec(`INSERT INTO preview_feedbacks (post_id, preview_link_id, name, quote, image_id, content, created_at)
+			SELECT ?, ?, ?, ?, ?, ?, ? WHERE (SELECT COUNT(*) FROM preview_feedbacks WHERE preview_link_id = ?) < ?`,
+			feedback.PostID, feedback.PreviewLinkID, feedback.Name, feedback.Quote, feedback.ImageID, feedback.Content, now,
+			feedback.PreviewLinkID, model.PREVIEW_FEEDBACK_MAX)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTooMuchPreviewFeedback
+		}
+		return tx.Where("preview_link_id = ?", feedback.PreviewLinkID).Order("id desc").First(feedback).Error
+	})
+}
+
+// FindFeedbackOfPost returns the feedback left on the post through any of its links, the oldest first
+func FindFeedbackOfPost(postID uint64) ([]model.PreviewFeedback, error) {
+	var feedback []model.PreviewFeedback
+	err := DB.Where("post_id = ?", postID).Order("created_at, id").Find(&feedback).Error
+	return feedback, err
+}
+
+func FindFeedbackOfPreviewLink(linkID uint64) ([]model.PreviewFeedback, error) {
+	var feedback []model.PreviewFeedback
+	err := DB.Where("preview_link_id = ?", linkID).Order("created_at, id").Find(&feedback).Error
+	return feedback, err
+}
+
+func FindPreviewFeedbackByID(id uint64) (model.PreviewFeedback, error) {
+	var feedback model.PreviewFeedback
+	err := DB.Preload("Post").First(&feedback, id).Error
+	return feedback, err
+}
+
+func DeletePreviewFeedback(feedback *model.PreviewFeedback) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(feedback).Error
+	})
+}
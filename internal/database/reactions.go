@@ -0,0 +1,91 @@
+package database
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// ToggleReaction adds the reaction of the user or removes it if it was already there, returns if it was added
+func ToggleReaction(username string, postID uint64, kind string) (bool, error) {
+	added := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("username = ? AND post_id = ? AND kind = ?", username, postID, kind).Delete(&model.Reaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		added = true
+		return tx.Create(&model.Reaction{Username: username, PostID: postID, Kind: kind}).Error
+	})
+	return added, err
+}
+
+// CountReactionsOfPosts returns the amount of each kind of reaction by post
+func CountReactionsOfPosts(postIDs []uint64) (map[uint64]map[string]int64, error) {
+	counts := make(map[uint64]map[string]int64)
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		PostID uint64
+		Kind   string
+		Count  int64
+	}
+	err := DB.Model(&model.Reaction{}).Select("post_id, kind, COUNT(*) AS count").Where("post_id IN ?", postIDs).
+		Group("post_id, kind").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if counts[row.PostID] == nil {
+			counts[row.PostID] = make(map[string]int64)
+		}
+		counts[row.PostID][row.Kind] = row.Count
+	}
+	return counts, nil
+}
+
+func FindReactionKindsOfUser(username string, postID uint64) ([]string, error) {
+	var kinds []string
+	err := DB.Model(&model.Reaction{}).Where("username = ? AND post_id = ?", username, postID).Pluck("kind", &kinds).Error
+	return kinds, err
+}
+
+// ToggleSavedPost saves the post for the user or removes it from the list, returns if it was saved
+func ToggleSavedPost(username string, postID uint64) (bool, error) {
+	saved := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("username = ? AND post_id = ?", username, postID).Delete(&model.SavedPost{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		saved = true
+		return tx.Create(&model.SavedPost{Username: username, PostID: postID}).Error
+	})
+	return saved, err
+}
+
+func IsPostSaved(username string, postID uint64) (bool, error) {
+	var count int64
+	err := DB.Model(&model.SavedPost{}).Where("username = ? AND post_id = ?", username, postID).Count(&count).Error
+	return count > 0, err
+}
+
+// FindSavedPostsPaginated returns the posts the user saved, last saved first.
+// Posts that the user can no longer open, like the ones turned back into drafts, are left out.
+func FindSavedPostsPaginated(user model.User, page, pageSize int) ([]model.Post, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+	var posts []model.Post
+	result := DB.Joins("JOIN saved_posts ON saved_posts.post_id = posts.id").
+		Where("saved_posts.username = ?", user.Username).Scopes(reachableBy(user.Username, "posts")).
+		Order("saved_posts.created_at desc, saved_posts.id desc").Offset(offset).Limit(pageSize).Find(&posts).Error
+	return posts, result
+}
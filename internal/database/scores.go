@@ -0,0 +1,210 @@
+package database
+
+import (
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+const (
+	FEED_TRENDING = "trending"
+	FEED_WEEK     = "week"
+	FEED_MONTH    = "month"
+	FEED_ALL_TIME = "all"
+)
+
+// How much each kind of engagement adds to the score of a post
+const (
+	scoreVoteWeight     = 1.0
+	scoreReactionWeight = 1.0
+	scoreCommentWeight  = 3.0
+	scoreViewWeight     = 0.1
+)
+
+var (
+	ScoreInterval     = 15 * time.Minute
+	TrendingHalfLife  = 24 * time.Hour
+	scoreColumnOfFeed = map[string]string{
+		FEED_TRENDING: "trending",
+		FEED_WEEK:     "week",
+		FEED_MONTH:    "month",
+		FEED_ALL_TIME: "all_time",
+	}
+)
+
+func init() {
+	godotenv.Load()
+	if minutes, err := strconv.Atoi(os.Getenv("SCORE_INTERVAL")); err == nil && minutes > 0 {
+		ScoreInterval = time.Duration(minutes) * time.Minute
+	}
+	if hours, err := strconv.Atoi(os.Getenv("TRENDING_HALF_LIFE")); err == nil && hours > 0 {
+		TrendingHalfLife = time.Duration(hours) * time.Hour
+	}
+}
+
+// engagementOfPublishedPosts lists every vote, reaction, approved comment and view of the published posts with its weight.
+// Votes cast before they had a date count from the creation of the post.
+func engagementOfPublishedPosts(tx *gorm.DB) *gorm.DB {
+	return tx.Raw(`SELECT post_votes.post_id AS post_id, COALESCE(votes.created_at, posts.created_at) AS created_at, ? AS weight
+		FROM votes JOIN post_votes ON post_votes.vote_id = votes.id JOIN posts ON posts.id = post_votes.post_id WHERE posts.published = true
+		UNION ALL SELECT reactions.post_id, reactions.created_at, ?
+		FROM reactions JOIN posts ON posts.id = reactions.post_id WHERE posts.published = true
+		UNION ALL SELECT comments.post_id, comments.created_at, ?
+		FROM comments JOIN posts ON posts.id = comments.post_id WHERE posts.published = true AND comments.approved = true
+		UNION ALL SELECT views.post_id, views.created_at, ?
+		FROM views JOIN posts ON posts.id = views.post_id WHERE posts.published = true`,
+		scoreVoteWeight, scoreReactionWeight, scoreCommentWeight, scoreViewWeight)
+}
+
+func sumEngagementSince(tx *gorm.DB, since *time.Time) (map[uint64]float64, error) {
+	var rows []struct {
+		PostID uint64
+		Score  float64
+	}
+	query := tx.Table("(?) AS engagement", engagementOfPublishedPosts(tx)).Select("post_id, SUM(weight) AS score")
+	if since != nil {
+		query = query.Where("created_at >= ?", *since)
+	}
+	err := query.Group("post_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[uint64]float64, len(rows))
+	for _, row := range rows {
+		scores[row.PostID] = row.Score
+	}
+	return scores, nil
+}
+
+// trendingScores adds up the engagement of each post halving its weight every TrendingHalfLife.
+// It is grouped by hour so the job reads a bounded amount of rows.
+func trendingScores(tx *gorm.DB, now time.Time) (map[uint64]float64, error) {
+	since := now.Add(-8 * TrendingHalfLife)
+	var rows []struct {
+		PostID uint64
+		Hour   string
+		Weight float64
+	}
+	err := tx.Table("(?) AS engagement", engagementOfPublishedPosts(tx)).
+		Select("post_id, substr(created_at, 1, 13) AS hour, SUM(weight) AS weight").
+		Where("created_at >= ?", since).Group("post_id, hour").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[uint64]float64)
+	for _, row := range rows {
+		//Drivers store the date and the hour apart with a space or with a T as in RFC 3339
+		hour, err := time.ParseInLocation("2006-01-02 15", strings.Replace(row.Hour, "T", " ", 1), now.Location())
+		if err != nil {
+			log.Println("error reading the hour of the engagement of post", row.PostID, ": ", err)
+			continue
+		}
+		age := now.Sub(hour.Add(30 * time.Minute))
+		if age < 0 {
+			age = 0
+		}
+		scores[row.PostID] += row.Weight * math.Pow(0.5, age.Hours()/TrendingHalfLife.Hours())
+	}
+	return scores, nil
+}
+
+// RecomputePostScores replaces the cached scores of every post
+func RecomputePostScores() error {
+	now := DB.NowFunc()
+	week := now.AddDate(0, 0, -7)
+	month := now.AddDate(0, -1, 0)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		trending, err := trendingScores(tx, now)
+		if err != nil {
+			return err
+		}
+		weekly, err := sumEngagementSince(tx, &week)
+		if err != nil {
+			return err
+		}
+		monthly, err := sumEngagementSince(tx, &month)
+		if err != nil {
+			return err
+		}
+		allTime, err := sumEngagementSince(tx, nil)
+		if err != nil {
+			return err
+		}
+		scores := make([]model.PostScore, 0, len(allTime))
+		for postID, score := range allTime {
+			scores = append(scores, model.PostScore{
+				PostID:    postID,
+				Trending:  trending[postID],
+				Week:      weekly[postID],
+				Month:     monthly[postID],
+				AllTime:   score,
+				UpdatedAt: now,
+			})
+		}
+		err = tx.Where("1 = 1").Delete(&model.PostScore{}).Error
+		if err != nil {
+			return err
+		}
+		if len(scores) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(scores, 200).Error
+	})
+}
+
+// StartScoreScheduler computes the scores right away and then every ScoreInterval, it also forgets old visitor hashes
+func StartScoreScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(ScoreInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			err := RecomputePostScores()
+			if err != nil {
+				log.Println("error computing post scores: ", err)
+			}
+			err = ForgetViewVisitors()
+			if err != nil {
+				log.Println("error forgetting view visitors: ", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// FindPostsOfFeedPaginated ranks the posts listed to the viewer by the cached score of the feed, posts without engagement are left out
+func FindPostsOfFeedPaginated(viewer, feed string, page, pageSize int) ([]model.Post, error) {
+	column, ok := scoreColumnOfFeed[feed]
+	if !ok {
+		column = scoreColumnOfFeed[FEED_TRENDING]
+	}
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+	var posts []model.Post
+	err := DB.Joins("JOIN post_scores ON post_scores.post_id = posts.id").
+		Where("post_scores."+column+" > 0").Scopes(listedFor(viewer, "posts"), notMuted(viewer, "posts")).
+		Order("post_scores." + column + " DESC, posts.created_at DESC").Offset(offset).Limit(pageSize).Find(&posts).Error
+	return posts, err
+}
+
+func FindNewPostsPaginated(viewer string, page, pageSize int) ([]model.Post, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+	var posts []model.Post
+	err := DB.Scopes(listedFor(viewer, "posts"), notMuted(viewer, "posts")).Order("created_at desc, id desc").Offset(offset).Limit(pageSize).Find(&posts).Error
+	return posts, err
+}
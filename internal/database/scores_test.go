@@ -0,0 +1,67 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// createPublishedPost stores a public article of author with its post, skipping the hooks so no notification goes out
+func createPublishedPost(t *testing.T, tx *gorm.DB, author, title string) model.Post {
+	t.Helper()
+	quiet := tx.Session(&gorm.Session{SkipHooks: true})
+	article := model.Article{BasePost: model.BasePost{Title: title, Author: author, Published: true, Visibility: model.VISIBILITY_PUBLIC}}
+	if err := quiet.Create(&article).Error; err != nil {
+		t.Fatal(err)
+	}
+	post := model.Post{BasePost: article.BasePost, OwnerID: article.ID, OwnerType: "article"}
+	post.ID = 0
+	if err := quiet.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestTrendingScores(t *testing.T) {
+	tx := rollbackDB(t)
+	createUsers(t, tx, "writer", "reader")
+	now := time.Date(2026, 10, 19, 12, 30, 0, 0, time.Local)
+	stored := createPublishedPost(t, tx, "writer", "stored")
+	spaced := createPublishedPost(t, tx, "writer", "spaced")
+	//The driver writes the times of stored as RFC 3339, the ones of spaced are written with a space as other drivers do
+	if err := tx.Create(&model.Reaction{PostID: stored.ID, Username: "reader", Kind: model.REACTION_LIKE, CreatedAt: now.Add(-20 * time.Minute)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	comment := model.Comment{PostID: stored.ID, Author: "reader", Approved: true, CreatedAt: now.Add(-TrendingHalfLife + 10*time.Minute)}
+	if err := tx.Create(&comment).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&model.View{PostID: stored.ID, Author: "writer", CreatedAt: now.Add(-9 * TrendingHalfLife)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Exec("INSERT INTO reactions (post_id, username, kind, created_at) VALUES (?, ?, ?, ?)",
+		spaced.ID, "reader", model.REACTION_LIKE, now.Add(-20*time.Minute).Format("2006-01-02 15:04:05-07:00")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := trendingScores(tx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := []struct {
+		post     model.Post
+		expected float64
+	}{
+		//The reaction of this hour counts in full, the comment of a half-life ago in half and the old view not at all
+		{stored, scoreReactionWeight + scoreCommentWeight/2},
+		{spaced, scoreReactionWeight},
+	}
+	for _, p := range params {
+		if math.Abs(scores[p.post.ID]-p.expected) > 1e-9 {
+			t.Errorf("post %s: expected a trending score of %v, got %v", p.post.Title, p.expected, scores[p.post.ID])
+		}
+	}
+}
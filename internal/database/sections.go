@@ -0,0 +1,141 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// FindSectionByNameOrAlias looks for the section by its name and then by the names it had before,
+// renamed tells the caller the name was an old one so it can send the visitor to the current address
+func FindSectionByNameOrAlias(username, name string) (section model.Section, renamed bool, err error) {
+	err = DB.Where("owner = ? AND name = ?", username, name).First(&section).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return section, false, err
+	}
+	var alias model.SectionAlias
+	err = DB.Where("owner = ? AND name = ?", username, name).First(&alias).Error
+	if err != nil {
+		return section, false, err
+	}
+	err = DB.First(&section, alias.SectionID).Error
+	return section, true, err
+}
+
+// UpdateSection saves the section, when it was renamed the old name is kept as an alias
+func UpdateSection(section *model.Section, oldName string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(section).Select("name", "description", "visibility").Updates(section).Error
+		if err != nil {
+			return err
+		}
+		if oldName == section.Name {
+			return nil
+		}
+		//A section may take back one of its old names
+		err = tx.Where("owner = ? AND name = ?", section.Owner, section.Name).Delete(&model.SectionAlias{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.SectionAlias{SectionID: section.ID, Owner: section.Owner, Name: oldName}).Error
+	})
+}
+
+// AddPostsToSection appends the posts of the owner of the section that are not in it yet, keeping the order they are given in
+func AddPostsToSection(section *model.Section, postIDs []uint64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return addPostsToSection(tx, section, postIDs)
+	})
+}
+
+func addPostsToSection(tx *gorm.DB, section *model.Section, postIDs []uint64) error {
+	var owned []uint64
+	err := tx.Model(&model.Post{}).Where("id IN ?", postIDs).Scopes(writtenBy(section.Owner, "posts")).Pluck("id", &owned).Error
+	if err != nil {
+		return err
+	}
+	var present []uint64
+	err = tx.Model(&model.SectionPost{}).Where("section_id = ?", section.ID).Pluck("post_id", &present).Error
+	if err != nil {
+		return err
+	}
+	var position int
+	err = tx.Model(&model.SectionPost{}).Select("COALESCE(MAX(position), 0)").
+		Where("section_id = ?", section.ID).Scan(&position).Error
+	if err != nil {
+		return err
+	}
+	skip := make(map[uint64]bool, len(present))
+	for _, id := range present {
+		skip[id] = true
+	}
+	isOwned := make(map[uint64]bool, len(owned))
+	for _, id := range owned {
+		isOwned[id] = true
+	}
+	for _, id := range postIDs {
+		if skip[id] || !isOwned[id] {
+			continue
+		}
+		skip[id] = true
+		position++
+		err = tx.Create(&model.SectionPost{SectionID: section.ID, PostID: id, Position: position}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemovePostsFromSection(section *model.Section, postIDs []uint64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("section_id = ? AND post_id IN ?", section.ID, postIDs).Delete(&model.SectionPost{}).Error
+	})
+}
+
+// FindPostsInSectionOrdered returns every post of the section, published or not, in the order shown to visitors
+func FindPostsInSectionOrdered(section *model.Section, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := DB.Select("posts.*").Joins("JOIN section_posts ON section_posts.post_id = posts.id").
+		Where("section_posts.section_id = ?", section.ID).
+		Order("section_posts.position, posts.updated_at desc").Limit(limit).Find(&posts).Error
+	return posts, err
+}
+
+// MovePostInSection swaps the post with the one before (offset -1) or after it (offset 1) and numbers them again
+func MovePostInSection(section *model.Section, postID uint64, offset int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var postIDs []uint64
+		err := tx.Table("section_posts").Select("section_posts.post_id").
+			Joins("JOIN posts ON posts.id = section_posts.post_id").
+			Where("section_posts.section_id = ?", section.ID).
+			Order("section_posts.position, posts.updated_at desc").Pluck("post_id", &postIDs).Error
+		if err != nil {
+			return err
+		}
+		for i := range postIDs {
+			if postIDs[i] != postID {
+				continue
+			}
+			if j := i + offset; j >= 0 && j < len(postIDs) {
+				postIDs[i], postIDs[j] = postIDs[j], postIDs[i]
+			}
+			break
+		}
+		for i, id := range postIDs {
+			err = tx.Model(&model.SectionPost{}).Where("section_id = ? AND post_id = ?", section.ID, id).
+				UpdateColumn("position", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
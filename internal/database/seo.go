@@ -0,0 +1,131 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// The sitemap protocol does not allow more urls in a single file
+const SITEMAP_MAX_URLS = 50000
+
+// How many times a save is tried again when another post took the same slug at the same time
+const slugRetries = 3
+
+type ProfileLastModified struct {
+	Username  string
+	UpdatedAt string
+}
+
+func FindArticleBySlug(slug string) (model.Article, error) {
+	var article model.Article
+	err := DB.Preload("Votes.Tag").Where("slug = ?", slug).First(&article).Error
+	return article, err
+}
+
+func FindGalleryBySlug(slug string) (model.Gallery, error) {
+	var gallery model.Gallery
+	err := DB.Preload("Images", orderedImages).Preload("Images.Variants").Preload("Votes.Tag").
+		Where("slug = ?", slug).First(&gallery).Error
+	return gallery, err
+}
+
+// retryOnSlugConflict runs save again when the unique index rejects the slug it got, which happens when two posts with
+// the same title are published at the same time. The slug is set back before each try so a free one is looked up.
+func retryOnSlugConflict(slug *string, save func() error) error {
+	previous := *slug
+	var err error
+	for try := 0; try < slugRetries; try++ {
+		*slug = previous
+		err = save()
+		if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") || !strings.Contains(err.Error(), ".slug") {
+			return err
+		}
+	}
+	return err
+}
+
+// UniqueSlugs makes the slugs of articles and galleries unique in the database, not only when they are assigned.
+// Posts that got the same slug are given a new one first, the oldest keeps it. It runs once.
+func UniqueSlugs() error {
+	return runOnce("unique_slugs", func(tx *gorm.DB) error {
+		for _, kind := range []struct{ table, postType string }{{"articles", "article"}, {"galleries", "gallery"}} {
+			var rows []struct {
+				ID    uint64
+				Title string
+			}
+			err := tx.Table(kind.table).Select("id, title").
+				Where("slug <> '' AND EXISTS (SELECT 1 FROM " + kind.table + " AS older WHERE older.slug = " + kind.table + ".slug AND older.id < " + kind.table + ".id)").
+				Order("id").Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				err = resetSlug(tx, kind.table, kind.postType, row.ID, row.Title)
+				if err != nil {
+					return err
+				}
+			}
+			err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_" + kind.table + "_unique_slug ON " + kind.table + " (slug) WHERE slug <> ''").Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resetSlug gives the post a free slug, the columns are set directly so the post keeps its dates
+func resetSlug(tx *gorm.DB, table, postType string, id uint64, title string) error {
+	slug, err := model.UniqueSlug(tx, table, postType, id, title)
+	if err != nil {
+		return err
+	}
+	err = tx.Table(table).Where("id = ?", id).UpdateColumn("slug", slug).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&model.Post{}).Where("owner_id = ? AND owner_type = ?", id, postType).UpdateColumn("slug", slug).Error
+}
+
+// SyncSlugs gives a slug to the published articles and galleries created before they had one
+func SyncSlugs() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, kind := range []struct{ table, postType string }{{"articles", "article"}, {"galleries", "gallery"}} {
+			var rows []struct {
+				ID    uint64
+				Title string
+			}
+			err := tx.Table(kind.table).Select("id, title").Where("(slug IS NULL OR slug = '') AND published = true").Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				err = resetSlug(tx, kind.table, kind.postType, row.ID, row.Title)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// FindPostsForSitemap lists the public articles and galleries, the most recently updated first
+func FindPostsForSitemap() ([]model.Post, error) {
+	var posts []model.Post
+	err := DB.Where("visibility = ? AND owner_type IN ?", model.VISIBILITY_PUBLIC, []string{"article", "gallery"}).
+		Order("updated_at desc").Limit(SITEMAP_MAX_URLS / 2).Find(&posts).Error
+	return posts, err
+}
+
+// FindPublicProfilesForSitemap lists the users that are not banned with the date of their last public post
+func FindPublicProfilesForSitemap() ([]ProfileLastModified, error) {
+	var profiles []ProfileLastModified
+	err := DB.Table("users").Select("users.username, MAX(COALESCE(posts.updated_at, users.updated_at)) AS updated_at").
+		Joins("LEFT JOIN posts ON posts.author = users.username AND posts.visibility = ?", model.VISIBILITY_PUBLIC).
+		Where("users.active = true").Group("users.username").Order("updated_at desc").
+		Limit(SITEMAP_MAX_URLS / 2).Scan(&profiles).Error
+	return profiles, err
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+)
+
+func TestUniqueSlug(t *testing.T) {
+	tx := rollbackDB(t)
+	createUsers(t, tx, "writer")
+	existing := []model.Article{
+		{BasePost: model.BasePost{Title: "Hello world", Slug: "hello-world", Author: "writer"}},
+		{BasePost: model.BasePost{Title: "Hello world", Slug: "hello-world-2", Author: "writer"}},
+		{BasePost: model.BasePost{Title: "2024", Slug: "article-2024", Author: "writer"}},
+	}
+	for i := range existing {
+		if err := tx.Create(&existing[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	params := []struct {
+		name     string
+		id       uint64
+		title    string
+		expected string
+	}{
+		{"free", 0, "Another post", "another-post"},
+		{"taken_twice", 0, "Hello, World!", "hello-world-3"},
+		{"own_slug", existing[0].ID, "Hello world", "hello-world"},
+		{"digits", 0, "2024", "article-2024-2"},
+		{"digits_own_slug", existing[2].ID, "2024", "article-2024"},
+		{"reserved", 0, "Create", "create-2"},
+		{"no_ascii", 0, "日本語", "article"},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			slug, err := model.UniqueSlug(tx, "articles", "article", p.id, p.title)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slug != p.expected {
+				t.Errorf("expected %q, got %q", p.expected, slug)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// ModerationTag is a tag with what moderators need to decide about it
+type ModerationTag struct {
+	model.Tag
+	Votes       int64
+	AliasOfName string
+}
+
+// ResolveTag finds the tag with the name, or the one it is an alias of
+func ResolveTag(name string) (model.Tag, error) {
+	return resolveTag(DB, name)
+}
+
+func resolveTag(tx *gorm.DB, name string) (model.Tag, error) {
+	var tag model.Tag
+	err := tx.Where("name = ?", name).First(&tag).Error
+	if err != nil || tag.AliasOfID == 0 {
+		return tag, err
+	}
+	var canonical model.Tag
+	err = tx.First(&canonical, tag.AliasOfID).Error
+	return canonical, err
+}
+
+func FindTagsForModerationPaginated(query string, page, pageSize int) ([]ModerationTag, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+	var tags []ModerationTag
+	err := DB.Table("tags").
+		Select("tags.*, (SELECT COUNT(*) FROM votes WHERE votes.tag_id = tags.id) AS votes, canonical.name AS alias_of_name").
+		Joins("LEFT JOIN tags AS canonical ON canonical.id = tags.alias_of_id").
+		Where("tags.name LIKE ?", "%"+query+"%").Order("votes DESC, tags.name").
+		Offset(offset).Limit(pageSize).Scan(&tags).Error
+	return tags, err
+}
+
+func UpdateTagDescription(tag *model.Tag, description string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(tag).Update("description", description).Error
+	})
+}
+
+// BanTag deletes every vote the tag got so it disappears from the posts
+func BanTag(tag *model.Tag) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var voteIDs []uint64
+		err := tx.Model(&model.Vote{}).Where("tag_id = ?", tag.ID).Pluck("id", &voteIDs).Error
+		if err != nil {
+			return err
+		}
+		err = deleteVotes(tx, voteIDs)
+		if err != nil {
+			return err
+		}
+		tag.Banned = true
+		return tx.Model(tag).Update("banned", true).Error
+	})
+}
+
+func UnbanTag(tag *model.Tag) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		tag.Banned = false
+		return tx.Model(tag).Update("banned", false).Error
+	})
+}
+
+// MergeTags moves the votes of source to target and keeps source as an alias of it.
+// A user who voted both tags on the same post keeps a single vote.
+func MergeTags(source, target *model.Tag) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return mergeTags(tx, source, target)
+	})
+}
+
+func mergeTags(tx *gorm.DB, source, target *model.Tag) error {
+	var duplicated []uint64
+	err := tx.Table("votes").Joins("JOIN post_votes ON post_votes.vote_id = votes.id").
+		Where(`votes.tag_id = ? AND EXISTS (SELECT 1 FROM votes AS other JOIN post_votes AS other_posts ON other_posts.vote_id = other.id
+			WHERE other.tag_id = ? AND other.voter = votes.voter AND other_posts.post_id = post_votes.post_id)`, source.ID, target.ID).
+		Pluck("votes.id", &duplicated).Error
+	if err != nil {
+		return err
+	}
+	err = deleteVotes(tx, duplicated)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&model.Vote{}).Where("tag_id = ?", source.ID).Update("tag_id", target.ID).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&model.Tag{}).Where("alias_of_id = ?", source.ID).Update("alias_of_id", target.ID).Error
+	if err != nil {
+		return err
+	}
+	if target.Description == "" && source.Description != "" {
+		err = tx.Model(target).Update("description", source.Description).Error
+		if err != nil {
+			return err
+		}
+	}
+	source.AliasOfID = target.ID
+	source.Description = ""
+	source.Banned = false
+	return tx.Model(source).Select("alias_of_id", "description", "banned").Updates(source).Error
+}
+
+// NormalizeTags gives the tags created before names were normalized their normalized name. When a tag with that
+// name already exists the old one is merged into it and stays as its alias. It runs once.
+func NormalizeTags() error {
+	return runOnce("normalize_tags", func(tx *gorm.DB) error {
+		var tags []model.Tag
+		err := tx.Order("id").Find(&tags).Error
+		if err != nil {
+			return err
+		}
+		for i := range tags {
+			tag := &tags[i]
+			name := model.NormalizeTagName(tag.Name)
+			if name == "" || name == tag.Name {
+				continue
+			}
+			var target model.Tag
+			err = tx.Where("name = ?", name).First(&target).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = tx.Model(tag).UpdateColumn("name", name).Error
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			//Merging into an alias would chain them, the votes go to the tag it stands for
+			if target.AliasOfID != 0 {
+				err = tx.First(&target, target.AliasOfID).Error
+				if err != nil {
+					return err
+				}
+			}
+			if target.ID == tag.ID || tag.AliasOfID != 0 || tag.Banned {
+				continue
+			}
+			err = mergeTags(tx, tag, &target)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTagAlias removes an alias, it never has votes since they are moved when it is created
+func DeleteTagAlias(tag *model.Tag) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("id = ? AND alias_of_id <> 0", tag.ID).Delete(&model.Tag{}).Error
+	})
+}
+
+func FindTagByID(id uint64) (model.Tag, error) {
+	var tag model.Tag
+	err := DB.First(&tag, id).Error
+	return tag, err
+}
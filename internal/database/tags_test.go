@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+)
+
+func TestMergeTags(t *testing.T) {
+	params := []struct {
+		name                string
+		sourceDescription   string
+		targetDescription   string
+		expectedDescription string
+	}{
+		{"keeps_target_description", "source", "target", "target"},
+		{"takes_source_description", "source", "", "source"},
+		{"no_description", "", "", ""},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			tx := rollbackDB(t)
+			source := model.Tag{Name: "merge-source", Description: p.sourceDescription}
+			target := model.Tag{Name: "merge-target", Description: p.targetDescription}
+			alias := model.Tag{Name: "merge-alias"}
+			for _, tag := range []*model.Tag{&source, &target} {
+				if err := tx.Create(tag).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			alias.AliasOfID = source.ID
+			if err := tx.Create(&alias).Error; err != nil {
+				t.Fatal(err)
+			}
+			createUsers(t, tx, "writer", "alice", "bob")
+			first := createDraft(t, tx, "writer", "first")
+			second := createDraft(t, tx, "writer", "second")
+			votes := []struct {
+				post  model.Post
+				voter string
+				tag   uint64
+			}{
+				//alice voted both tags on the first post and must end with a single vote
+				{first, "alice", source.ID},
+				{first, "alice", target.ID},
+				{first, "bob", source.ID},
+				{second, "alice", source.ID},
+			}
+			for _, v := range votes {
+				if err := VoteTagForPost(v.post, &model.Vote{Voter: v.voter, TagID: v.tag}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := MergeTags(&source, &target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var remaining int64
+			tx.Model(&model.Vote{}).Where("tag_id = ?", source.ID).Count(&remaining)
+			if remaining != 0 {
+				t.Errorf("expected no votes left on the source tag, got %d", remaining)
+			}
+			counts := []struct {
+				post     model.Post
+				voter    string
+				expected int64
+			}{
+				{first, "alice", 1},
+				{first, "bob", 1},
+				{second, "alice", 1},
+			}
+			for _, c := range counts {
+				var count int64
+				tx.Table("votes").Joins("JOIN post_votes ON post_votes.vote_id = votes.id").
+					Where("votes.tag_id = ? AND votes.voter = ? AND post_votes.post_id = ?", target.ID, c.voter, c.post.ID).Count(&count)
+				if count != c.expected {
+					t.Errorf("expected %d votes of %s on post %d, got %d", c.expected, c.voter, c.post.ID, count)
+				}
+			}
+			var storedSource, storedAlias, storedTarget model.Tag
+			tx.First(&storedSource, source.ID)
+			if storedSource.AliasOfID != target.ID || storedSource.Description != "" {
+				t.Errorf("expected the source to be an alias of %d without description, got %+v", target.ID, storedSource)
+			}
+			tx.First(&storedAlias, alias.ID)
+			if storedAlias.AliasOfID != target.ID {
+				t.Errorf("expected the alias to point to %d, got %d", target.ID, storedAlias.AliasOfID)
+			}
+			tx.First(&storedTarget, target.ID)
+			if storedTarget.Description != p.expectedDescription {
+				t.Errorf("expected the target description %q, got %q", p.expectedDescription, storedTarget.Description)
+			}
+		})
+	}
+}
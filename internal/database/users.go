@@ -39,17 +39,17 @@ func FindUserByEmail(email string) (model.User, error) {
 
 func FindSectionsByUser(username string) ([]model.Section, error) {
 	var sections []model.Section
-	result := DB.Where("owner = ?", username).Find(&sections)
+	result := DB.Where("owner = ?", username).Order("position, id").Find(&sections)
 	return sections, result.Error
 }
 
-func FindPostsByUserPaginated(username string, page, page_size int) ([]model.Post, error) {
+func FindPostsByUserPaginated(viewer, username string, page, page_size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * page_size
 	var posts []model.Post
-	result := DB.Where("author = ? AND published = ?", username, true).Order("updated_at desc").Offset(offset).
+	result := DB.Scopes(writtenBy(username, "posts"), listedFor(viewer, "posts")).Order("updated_at desc").Offset(offset).
 		Limit(page_size).Find(&posts).Error
 	return posts, result
 }
@@ -60,38 +60,47 @@ func FindSectionByUsernameAndName(username, name string) (model.Section, error)
 	return section, result.Error
 }
 
-func FindPostsByUserAndSectionPaginated(username, section string, page, page_size int) ([]model.Post, error) {
+func FindPostsByUserAndSectionPaginated(viewer, username, section string, page, page_size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * page_size
 	var posts []model.Post
 	//Section has a many to many relationship with posts and posts has no foreign key to section
-	//So we need to do a subquery to get the posts
-	result := DB.Where("author = ? AND published = true AND id IN (SELECT post_id FROM section_posts WHERE section_id = (SELECT id FROM sections WHERE owner = ? AND name = ?))", username, username, section).
-		Order("updated_at desc").Offset(offset).Limit(page_size).Find(&posts).Error
+	//So we need to join the posts with the section, which also holds the order chosen by the owner
+	result := DB.Select("posts.*").Joins("JOIN section_posts ON section_posts.post_id = posts.id").
+		Where("section_posts.section_id = (SELECT id FROM sections WHERE owner = ? AND name = ?)", username, section).
+		Scopes(writtenBy(username, "posts"), listedFor(viewer, "posts")).
+		Order("section_posts.position, posts.updated_at desc").Offset(offset).Limit(page_size).Find(&posts).Error
 	return posts, result
 }
 
 func CreateSection(section *model.Section) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		result := tx.Create(section)
-		return result.Error
+		return createSection(tx, section)
 	})
 }
 
+func createSection(tx *gorm.DB, section *model.Section) error {
+	//New sections go last
+	err := tx.Model(&model.Section{}).Select("COALESCE(MAX(position), 0) + 1").
+		Where("owner = ?", section.Owner).Scan(&section.Position).Error
+	if err != nil {
+		return err
+	}
+	result := tx.Create(section)
+	return result.Error
+}
+
 func AddPostToSection(section *model.Section, post *model.Post) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(section).Association("Posts").Append(post)
-	})
+	return AddPostsToSection(section, []uint64{post.ID})
 }
 
 func RemovePostFromSection(section *model.Section, post *model.Post) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(section).Association("Posts").Delete(post)
-	})
+	return RemovePostsFromSection(section, []uint64{post.ID})
 }
 
+// FindPostsByUserNotInSectionPaginated lists the posts the owner can still add to the section, drafts are left out
 func FindPostsByUserNotInSectionPaginated(username, section string, page, page_size int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
@@ -100,14 +109,28 @@ func FindPostsByUserNotInSectionPaginated(username, section string, page, page_s
 	var posts []model.Post
 	//Section has a many to many relationship with posts and posts has no foreign key to section
 	//So we need to do a subquery to get the posts
-	result := DB.Where("author = ? AND published = true AND id NOT IN (SELECT post_id FROM section_posts WHERE section_id = (SELECT id FROM sections WHERE owner = ? AND name = ?))", username, username, section).
+	result := DB.Where("id NOT IN (SELECT post_id FROM section_posts WHERE section_id = (SELECT id FROM sections WHERE owner = ? AND name = ?))", username, section).
+		Scopes(writtenBy(username, "posts"), listedFor(username, "posts")).
 		Order("updated_at desc").Offset(offset).Limit(page_size).Find(&posts).Error
 	return posts, result
 }
 
 func DeleteSectionByUsernameAndName(username, name string) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		result := tx.Where("owner = ? AND name = ?", username, name).Delete(&model.Section{})
+		var section model.Section
+		err := tx.Where("owner = ? AND name = ?", username, name).First(&section).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("section_id = ?", section.ID).Delete(&model.SectionPost{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("section_id = ?", section.ID).Delete(&model.SectionAlias{}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Delete(&section)
 		return result.Error
 	})
 }
@@ -144,12 +167,32 @@ func DeleteUser(user *model.User) error {
 		}
 
 		if len(sections) > 0 {
+			sectionIDs := make([]uint64, len(sections))
+			for i := range sections {
+				sectionIDs[i] = sections[i].ID
+			}
+			err = tx.Where("section_id IN ?", sectionIDs).Delete(&model.SectionPost{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("section_id IN ?", sectionIDs).Delete(&model.SectionAlias{}).Error
+			if err != nil {
+				return err
+			}
 			err = tx.Delete(&sections).Error
 			if err != nil {
 				return err
 			}
 		}
 		if len(images) > 0 {
+			imageIDs := make([]uint64, len(images))
+			for i := range images {
+				imageIDs[i] = images[i].ID
+			}
+			err = tx.Where("image_id IN ?", imageIDs).Delete(&model.ImageVariant{}).Error
+			if err != nil {
+				return err
+			}
 			err = tx.Delete(&images).Error
 			if err != nil {
 				return err
@@ -173,30 +216,107 @@ func DeleteUser(user *model.User) error {
 				return err
 			}
 		}
+		err = tx.Where("owner = ?", user.Username).Delete(&model.DataExport{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner = ?", user.Username).Delete(&model.ArticleAutosave{}).Error
+		if err != nil {
+			return err
+		}
+		//The comments of the user go with the replies they received
+		var commentIDs []uint64
+		err = tx.Model(&model.Comment{}).Where("author = ?", user.Username).Pluck("id", &commentIDs).Error
+		if err != nil {
+			return err
+		}
+		err = deleteCommentTrees(tx, commentIDs)
+		if err != nil {
+			return err
+		}
+		err = tx.Where("username = ?", user.Username).Delete(&model.Reaction{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("username = ?", user.Username).Delete(&model.SavedPost{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("author = ?", user.Username).Delete(&model.View{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("username = ?", user.Username).Delete(&model.FollowEvent{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner = ?", user.Username).Delete(&model.FeaturedPost{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner = ?", user.Username).Delete(&model.Portfolio{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("username = ?", user.Username).Delete(&model.CoAuthor{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner = ? OR username = ?", user.Username, user.Username).Delete(&model.Block{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner = ? OR username = ?", user.Username, user.Username).Delete(&model.Mute{}).Error
+		if err != nil {
+			return err
+		}
 		return tx.Delete(user).Error
 	})
 }
 
 func FollowUser(follower_follow_list *model.FollowList, followed *model.User) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(follower_follow_list).Where("owner = ?", follower_follow_list.Owner).
+		already, err := followsUser(tx, follower_follow_list.Owner, followed.Username)
+		if err != nil || already {
+			return err
+		}
+		err = tx.Model(follower_follow_list).Where("owner = ?", follower_follow_list.Owner).
 			Association("Following").Append(followed)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.FollowEvent{Username: followed.Username, Delta: 1}).Error
 	})
 }
 
 func UnfollowUser(follower_follow_list *model.FollowList, followed *model.User) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(follower_follow_list).Association("Following").Delete(followed)
+		following, err := followsUser(tx, follower_follow_list.Owner, followed.Username)
+		if err != nil || !following {
+			return err
+		}
+		err = tx.Model(follower_follow_list).Association("Following").Delete(followed)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.FollowEvent{Username: followed.Username, Delta: -1}).Error
 	})
 }
 
+func followsUser(tx *gorm.DB, owner, username string) (bool, error) {
+	var count int64
+	err := tx.Table("follows").Where("owner = ? AND username = ?", owner, username).Count(&count).Error
+	return count > 0, err
+}
+
 func FindFollowingPostsPaginated(user model.User, page, pageSize int) ([]model.Post, error) {
 	if page < 1 {
 		page = 1
 	}
 	offset := (page - 1) * pageSize
 	var posts []model.Post
-	result := DB.Where("author IN (SELECT username FROM follows WHERE owner = ?) AND published = true", user.Username).
+	result := DB.Where(followedWriters("posts"), user.Username, user.Username).
+		Scopes(listedFor(user.Username, "posts"), notMuted(user.Username, "posts")).
 		Order("updated_at desc").Offset(offset).Limit(pageSize).Find(&posts).Error
 	return posts, result
 }
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// SyncVisibility gives a visibility to the posts saved before it existed, published posts become public.
+// The columns are set directly so the posts keep their dates.
+func SyncVisibility() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"articles", "galleries", "projects", "posts"} {
+			err := tx.Exec("UPDATE "+table+" SET visibility = CASE WHEN published THEN ? ELSE ? END WHERE visibility IS NULL OR visibility = ''",
+				model.VISIBILITY_PUBLIC, model.VISIBILITY_DRAFT).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// listedFor keeps the posts of table that the viewer may find in listings: public ones, followers-only ones of the
+// users they follow and the posts they wrote or co-wrote but drafts. Unlisted posts of others and posts of blocked
+// users are left out, an empty viewer only gets public posts.
+func listedFor(viewer, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == "" {
+			return db.Where(table+".visibility = ?", model.VISIBILITY_PUBLIC)
+		}
+		return db.Where("("+table+".visibility = ? OR ("+table+".visibility = ? AND "+followedWriters(table)+") OR ("+ownWriting(table)+" AND "+table+".visibility <> ?))",
+			model.VISIBILITY_PUBLIC, model.VISIBILITY_FOLLOWERS, viewer, viewer, viewer, viewer, model.VISIBILITY_DRAFT).
+			Scopes(notBlocked(viewer, table))
+	}
+}
+
+// reachableBy keeps the posts of table that the viewer may open, the listed ones and any unlisted one
+func reachableBy(viewer, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+table+".visibility IN ? OR ("+table+".visibility = ? AND "+followedWriters(table)+") OR ("+ownWriting(table)+" AND "+table+".visibility <> ?))",
+			[]string{model.VISIBILITY_PUBLIC, model.VISIBILITY_UNLISTED}, model.VISIBILITY_FOLLOWERS, viewer, viewer, viewer, viewer, model.VISIBILITY_DRAFT).
+			Scopes(notBlocked(viewer, table))
+	}
+}
+
+// followedWriters is the condition of the posts written or co-written by someone the viewer follows, it takes the viewer twice
+func followedWriters(table string) string {
+	return "(" + table + ".author IN (SELECT username FROM follows WHERE owner = ?) OR " + postIDColumn(table) +
+		" IN (SELECT post_id FROM co_authors WHERE accepted = true AND username IN (SELECT username FROM follows WHERE owner = ?)))"
+}
+
+// ownWriting is the condition of the posts written or co-written by the viewer, it takes the viewer twice
+func ownWriting(table string) string {
+	return "(" + table + ".author = ? OR " + postIDColumn(table) + " IN (SELECT post_id FROM co_authors WHERE username = ? AND accepted = true))"
+}
+
+// FollowsWriterOf tells whether the user follows the author or an accepted co-author of the article, gallery or project
+func FollowsWriterOf(follower, ownerType string, ownerID uint64) (bool, error) {
+	var count int64
+	err := DB.Table("follows").Where("owner = ? AND username IN (SELECT author FROM posts WHERE owner_type = ? AND owner_id = ? "+
+		"UNION SELECT co_authors.username FROM co_authors JOIN posts ON posts.id = co_authors.post_id "+
+		"WHERE posts.owner_type = ? AND posts.owner_id = ? AND co_authors.accepted = true)", follower, ownerType, ownerID, ownerType, ownerID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateArticleVisibility only writes the visibility, Published follows it. The slug is written too, publishing
+// for the first time assigns it.
+func UpdateArticleVisibility(article *model.Article) error {
+	return retryOnSlugConflict(&article.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(article).Select("published", "visibility", "slug").Updates(article).Error
+		})
+	})
+}
+
+// UpdateGalleryVisibility only writes the visibility, Published follows it. The slug is written too, publishing
+// for the first time assigns it.
+func UpdateGalleryVisibility(gallery *model.Gallery) error {
+	return retryOnSlugConflict(&gallery.Slug, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(gallery).Select("published", "visibility", "slug").Updates(gallery).Error
+		})
+	})
+}
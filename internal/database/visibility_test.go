@@ -0,0 +1,107 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// createVisibilityPosts stores an article of writer for each visibility and three of stranger co-written by writer,
+// the titles name them. fan follows writer.
+func createVisibilityPosts(t *testing.T, tx *gorm.DB) {
+	t.Helper()
+	createUsers(t, tx, "writer", "stranger", "fan")
+	articles := []model.Article{
+		{BasePost: model.BasePost{Title: "public", Author: "writer", Visibility: model.VISIBILITY_PUBLIC}},
+		{BasePost: model.BasePost{Title: "unlisted", Author: "writer", Visibility: model.VISIBILITY_UNLISTED}},
+		{BasePost: model.BasePost{Title: "followers", Author: "writer", Visibility: model.VISIBILITY_FOLLOWERS}},
+		{BasePost: model.BasePost{Title: "private", Author: "writer", Visibility: model.VISIBILITY_PRIVATE}},
+		{BasePost: model.BasePost{Title: "draft", Author: "writer", Visibility: model.VISIBILITY_DRAFT}},
+		{BasePost: model.BasePost{Title: "co-followers", Author: "stranger", Visibility: model.VISIBILITY_FOLLOWERS}},
+		{BasePost: model.BasePost{Title: "co-private", Author: "stranger", Visibility: model.VISIBILITY_PRIVATE}},
+		{BasePost: model.BasePost{Title: "co-draft", Author: "stranger", Visibility: model.VISIBILITY_DRAFT}},
+	}
+	//Hooks are skipped so no notification goes out, the post index is filled here instead
+	quiet := tx.Session(&gorm.Session{SkipHooks: true})
+	for i := range articles {
+		articles[i].Published = articles[i].Visibility != model.VISIBILITY_DRAFT
+		if err := quiet.Create(&articles[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		post := model.Post{BasePost: articles[i].BasePost, OwnerID: articles[i].ID, OwnerType: "article"}
+		post.ID = 0
+		if err := quiet.Create(&post).Error; err != nil {
+			t.Fatal(err)
+		}
+		if articles[i].Author == "writer" {
+			continue
+		}
+		if err := quiet.Create(&model.CoAuthor{PostID: post.ID, Username: "writer", Accepted: true, InvitedBy: "stranger"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Exec("INSERT INTO follows (owner, username) VALUES (?, ?)", "fan", "writer").Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// titlesIn returns the titles of the articles and of the posts kept by scope, failing when both tables disagree
+func titlesIn(t *testing.T, tx *gorm.DB, scope func(viewer, table string) func(*gorm.DB) *gorm.DB, viewer string) []string {
+	t.Helper()
+	var titles []string
+	for _, table := range []string{"articles", "posts"} {
+		var found []string
+		err := tx.Table(table).Scopes(scope(viewer, table)).Where(table+".author IN ?", []string{"writer", "stranger"}).
+			Order(table+".title").Pluck(table+".title", &found).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if titles != nil && !slices.Equal(titles, found) {
+			t.Fatalf("articles give %v but posts give %v", titles, found)
+		}
+		titles = found
+	}
+	return titles
+}
+
+func TestListedFor(t *testing.T) {
+	tx := rollbackDB(t)
+	createVisibilityPosts(t, tx)
+	params := []struct {
+		viewer   string
+		expected []string
+	}{
+		{"", []string{"public"}},
+		{"nobody", []string{"public"}},
+		{"fan", []string{"co-followers", "followers", "public"}},
+		{"writer", []string{"co-followers", "co-private", "followers", "private", "public", "unlisted"}},
+	}
+	for _, p := range params {
+		titles := titlesIn(t, tx, listedFor, p.viewer)
+		if !slices.Equal(titles, p.expected) {
+			t.Errorf("viewer %q: expected %v, got %v", p.viewer, p.expected, titles)
+		}
+	}
+}
+
+func TestReachableBy(t *testing.T) {
+	tx := rollbackDB(t)
+	createVisibilityPosts(t, tx)
+	params := []struct {
+		viewer   string
+		expected []string
+	}{
+		{"", []string{"public", "unlisted"}},
+		{"nobody", []string{"public", "unlisted"}},
+		{"fan", []string{"co-followers", "followers", "public", "unlisted"}},
+		{"writer", []string{"co-followers", "co-private", "followers", "private", "public", "unlisted"}},
+	}
+	for _, p := range params {
+		titles := titlesIn(t, tx, reachableBy, p.viewer)
+		if !slices.Equal(titles, p.expected) {
+			t.Errorf("viewer %q: expected %v, got %v", p.viewer, p.expected, titles)
+		}
+	}
+}
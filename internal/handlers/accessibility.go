@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/joho/godotenv"
+	"github.com/labstack/echo/v4"
+	xhtml "golang.org/x/net/html"
+)
+
+const (
+	ISSUE_MISSING_ALT  = "missing_alt"
+	ISSUE_EMPTY_LINK   = "empty_link"
+	ISSUE_HEADING_SKIP = "heading_skip"
+)
+
+// When true images without alternative text stop a post from being published, otherwise it is only a warning
+var RequireAltText = false
+
+func init() {
+	godotenv.Load()
+	if required, err := strconv.ParseBool(os.Getenv("REQUIRE_ALT_TEXT")); err == nil {
+		RequireAltText = required
+	}
+}
+
+type AccessibilityIssue struct {
+	Kind   string
+	Detail string
+	Thumb  string
+}
+
+// checkArticleAccessibility looks for images without alt, links without text and headings that skip a level.
+// The title of the article is the h1 of the page, so the content starts counting from there.
+func checkArticleAccessibility(content string) []AccessibilityIssue {
+	doc, err := xhtml.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	var issues []AccessibilityIssue
+	level := 1
+	var visit func(n *xhtml.Node)
+	visit = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.Data {
+			case "img":
+				if strings.TrimSpace(attributeOf(n, "alt")) == "" {
+					issues = append(issues, AccessibilityIssue{Kind: ISSUE_MISSING_ALT, Detail: shortDetail(attributeOf(n, "src")), Thumb: attributeOf(n, "src")})
+				}
+			case "a":
+				if !hasAccessibleName(n) {
+					issues = append(issues, AccessibilityIssue{Kind: ISSUE_EMPTY_LINK, Detail: shortDetail(attributeOf(n, "href"))})
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				heading := int(n.Data[1] - '0')
+				if heading > level+1 {
+					issues = append(issues, AccessibilityIssue{Kind: ISSUE_HEADING_SKIP, Detail: fmt.Sprintf("h%d → h%d", level, heading)})
+				}
+				level = heading
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(doc)
+	return issues
+}
+
+func checkGalleryAccessibility(gallery model.Gallery) []AccessibilityIssue {
+	var issues []AccessibilityIssue
+	for i, image := range gallery.Images {
+		if strings.TrimSpace(image.Alt) == "" {
+			issues = append(issues, AccessibilityIssue{Kind: ISSUE_MISSING_ALT, Detail: strconv.Itoa(i + 1), Thumb: image.ThumbURL})
+		}
+	}
+	return issues
+}
+
+// hasAccessibleName tells if a screen reader has something to announce for the link
+func hasAccessibleName(n *xhtml.Node) bool {
+	if strings.TrimSpace(attributeOf(n, "aria-label")) != "" || strings.TrimSpace(attributeOf(n, "title")) != "" {
+		return true
+	}
+	if strings.TrimSpace(textContent(n)) != "" {
+		return true
+	}
+	named := false
+	walkElements(n, "img", func(img *xhtml.Node) {
+		named = named || strings.TrimSpace(attributeOf(img, "alt")) != ""
+	})
+	return named
+}
+
+func shortDetail(detail string) string {
+	if strings.HasPrefix(detail, "data:") {
+		return "data:"
+	}
+	if runes := []rune(detail); len(runes) > 80 {
+		return string(runes[:77]) + "..."
+	}
+	return detail
+}
+
+// blocksPublishing tells if the issues must be fixed before the post can be published
+func blocksPublishing(issues []AccessibilityIssue) bool {
+	if !RequireAltText {
+		return false
+	}
+	for _, issue := range issues {
+		if issue.Kind == ISSUE_MISSING_ALT {
+			return true
+		}
+	}
+	return false
+}
+
+func convertIssuesToDataMap(locale string, issues []AccessibilityIssue) []map[string]any {
+	issues_content := make([]map[string]any, len(issues))
+	for i, issue := range issues {
+		issues_content[i] = map[string]any{
+			"message": utils.Translate(locale, "accessibility_issue_"+issue.Kind),
+			"detail":  issue.Detail,
+			"thumb":   issue.Thumb,
+		}
+	}
+	return issues_content
+}
+
+// renderAccessibilityCheck shows the issues found before publishing, with a way to publish anyway when allowed
+func renderAccessibilityCheck(c echo.Context, issues []AccessibilityIssue, publishURL, editURL string) error {
+	locale := utils.GetLocale(c)
+	data := map[string]any{
+		"locale":      locale,
+		"issues":      convertIssuesToDataMap(locale, issues),
+		"blocked":     blocksPublishing(issues),
+		"publish_url": publishURL,
+		"edit_url":    editURL,
+	}
+	return c.Render(200, "accessibility_check", data)
+}
+
+// renderAccessibilityWarnings shows the issues of a post that was published despite them, so they can be fixed
+func renderAccessibilityWarnings(c echo.Context, issues []AccessibilityIssue, editURL string) error {
+	locale := utils.GetLocale(c)
+	data := map[string]any{
+		"locale":    locale,
+		"issues":    convertIssuesToDataMap(locale, issues),
+		"published": true,
+		"edit_url":  editURL,
+	}
+	return c.Render(200, "accessibility_check", data)
+}
+
+func GetAccessibilityReport(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return GetAccessibilityReportPart(c)
+	}
+	return GetAccessibilityReportFull(c)
+}
+
+func GetAccessibilityReportFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"isActive":        user.Active,
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"page_to_load":    "/profile/mine/accessibility?which=part",
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+// GetAccessibilityReportPart lists every post of the user that has something to fix
+func GetAccessibilityReportPart(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	var posts []map[string]any
+	total := 0
+	for page := 1; ; page++ {
+		articles, err := database.FindAllArticlesByAuthorPaginated(user.Username, page, 50)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		for _, article := range articles {
+			issues := checkArticleAccessibility(article.Content)
+			if len(issues) == 0 {
+				continue
+			}
+			total += len(issues)
+			posts = append(posts, map[string]any{
+				"title":     article.Title,
+				"post_type": "article",
+				"url":       fmt.Sprintf("/article/%d", article.ID),
+				"edit_url":  fmt.Sprintf("/article/edit/%d", article.ID),
+				"published": article.Published,
+				"issues":    convertIssuesToDataMap(locale, issues),
+			})
+		}
+		if len(articles) < 50 {
+			break
+		}
+	}
+	for page := 1; ; page++ {
+		galleries, err := database.FindAllGalleriesByAuthorPaginated(user.Username, page, 50)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		for _, gallery := range galleries {
+			issues := checkGalleryAccessibility(gallery)
+			if len(issues) == 0 {
+				continue
+			}
+			total += len(issues)
+			posts = append(posts, map[string]any{
+				"title":     gallery.Title,
+				"post_type": "gallery",
+				"url":       fmt.Sprintf("/gallery/%d", gallery.ID),
+				"edit_url":  fmt.Sprintf("/gallery/edit/%d", gallery.ID),
+				"published": gallery.Published,
+				"issues":    convertIssuesToDataMap(locale, issues),
+			})
+		}
+		if len(galleries) < 50 {
+			break
+		}
+	}
+	data := map[string]any{
+		"locale": locale,
+		"posts":  posts,
+		"total":  total,
+	}
+	return c.Render(200, "accessibility_report", data)
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	analyticsPeriods = []int{7, 30, 90}
+	botUserAgent     = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|archiver|preview|headless|lighthouse|facebookexternalhit|curl|wget|python|go-http-client|java/|okhttp|httpclient|monitor`)
+)
+
+// The salt of the visitor hashes lives only in memory and changes every day, so visitors can not be followed across days
+var visitorSalt struct {
+	sync.Mutex
+	day  string
+	salt []byte
+}
+
+func dailyVisitorSalt() []byte {
+	visitorSalt.Lock()
+	defer visitorSalt.Unlock()
+	today := time.Now().Format("2006-01-02")
+	if visitorSalt.day != today {
+		salt := make([]byte, 32)
+		rand.Read(salt)
+		visitorSalt.day = today
+		visitorSalt.salt = salt
+	}
+	return visitorSalt.salt
+}
+
+// countView records a visit to a page of author, posts have a postID and profiles use 0.
+// Bots, visitors asking not to be tracked and the author are not counted.
+func countView(c echo.Context, author string, postID uint64) {
+	req := c.Request()
+	agent := req.UserAgent()
+	if agent == "" || botUserAgent.MatchString(agent) {
+		return
+	}
+	if req.Header.Get("DNT") == "1" || req.Header.Get("Sec-GPC") == "1" {
+		return
+	}
+	user, _ := GetUserOfSession(c)
+	if user.Username == author {
+		return
+	}
+	hash := sha256.New()
+	hash.Write(dailyVisitorSalt())
+	hash.Write([]byte(c.RealIP() + "\n" + agent))
+	view := model.View{
+		PostID:   postID,
+		Author:   author,
+		Visitor:  hex.EncodeToString(hash.Sum(nil)),
+		Referrer: referrerHost(req.Referer(), req.Host),
+	}
+	err := database.RecordView(&view)
+	if err != nil {
+		log.Println("error recording view: ", err)
+	}
+}
+
+func countPostView(c echo.Context, ownerID uint64, ownerType string) {
+	post, err := database.FindPostByOwner(ownerID, ownerType)
+	if err != nil || post.IsDraft() {
+		return
+	}
+	countView(c, post.Author, post.ID)
+}
+
+// referrerHost keeps only the site a visitor came from, links inside the app count as direct visits
+func referrerHost(referrer, host string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" || parsed.Host == host {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// convertDayCountsToDataMap charts every day starting from since, the height of each bar is relative to the highest one
+func convertDayCountsToDataMap(counts map[string]int64, since time.Time, days int) map[string]any {
+	var highest int64
+	for _, count := range counts {
+		highest = max(highest, count)
+	}
+	bars := make([]map[string]any, days)
+	for i := range bars {
+		day := since.AddDate(0, 0, i).Format("2006-01-02")
+		height := 0
+		if highest > 0 {
+			height = int(counts[day] * 100 / highest)
+		}
+		bars[i] = map[string]any{
+			"day":    day,
+			"count":  counts[day],
+			"height": height,
+		}
+	}
+	return map[string]any{
+		"bars":  bars,
+		"first": since.Format("2006-01-02"),
+		"last":  since.AddDate(0, 0, days-1).Format("2006-01-02"),
+	}
+}
+
+func GetAnalytics(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return GetAnalyticsPart(c)
+	}
+	return GetAnalyticsFull(c)
+}
+
+func GetAnalyticsFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	page_to_load := "/profile/mine/analytics?which=part"
+	if days := c.QueryParam("days"); days != "" {
+		page_to_load += "&days=" + url.QueryEscape(days)
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"isActive":        user.Active,
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"page_to_load":    page_to_load,
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+// GetAnalyticsPart shows the author how their posts and profile are doing over the last days
+func GetAnalyticsPart(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	days, err := strconv.Atoi(c.QueryParam("days"))
+	if err != nil || !slices.Contains(analyticsPeriods, days) {
+		days = 30
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := today.AddDate(0, 0, 1-days)
+	viewsPerDay, err := database.CountViewsOfAuthorPerDay(user.Username, since)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	views := make(map[string]int64, len(viewsPerDay))
+	var totalViews int64
+	for _, day := range viewsPerDay {
+		views[day.Day] = day.Count
+		totalViews += day.Count
+	}
+	profileViews, err := database.CountProfileViewsOfAuthor(user.Username, since)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	topPosts, err := database.FindTopPostsOfAuthorByViews(user.Username, since, 10)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	posts := make([]map[string]any, len(topPosts))
+	for i, post := range topPosts {
+		posts[i] = map[string]any{
+			"title": post.Title,
+			"type":  post.OwnerType,
+			"url":   postPath(post.OwnerType, post.OwnerID, post.Slug),
+			"views": post.Views,
+		}
+	}
+	referrerViews, err := database.CountReferrersOfAuthor(user.Username, since, 10)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	referrers := make([]map[string]any, len(referrerViews))
+	for i, referrer := range referrerViews {
+		referrers[i] = map[string]any{
+			"referrer": referrer.Referrer,
+			"views":    referrer.Views,
+		}
+	}
+	followers, err := database.CountFollowersOfUser(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	followerChanges, err := database.CountFollowerChangesPerDay(user.Username, since)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	//Walk the changes forward from the amount of followers there were before the period
+	var gained int64
+	for _, day := range followerChanges {
+		gained += day.Count
+	}
+	changes := make(map[string]int64, len(followerChanges))
+	for _, day := range followerChanges {
+		changes[day.Day] = day.Count
+	}
+	followersPerDay := make(map[string]int64, days)
+	running := followers - gained
+	for i := 0; i < days; i++ {
+		day := since.AddDate(0, 0, i).Format("2006-01-02")
+		running += changes[day]
+		followersPerDay[day] = running
+	}
+	tagVotes, err := database.CountTagVotesReceivedByAuthor(user.Username, since, 10)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	tags := make([]map[string]any, len(tagVotes))
+	for i, tag := range tagVotes {
+		tags[i] = map[string]any{
+			"name":   tag.Name,
+			"votes":  tag.Votes,
+			"recent": tag.Recent,
+		}
+	}
+	data := map[string]any{
+		"locale":           locale,
+		"days":             days,
+		"periods":          analyticsPeriods,
+		"total_views":      totalViews,
+		"profile_views":    profileViews,
+		"views_chart":      convertDayCountsToDataMap(views, since, days),
+		"posts":            posts,
+		"referrers":        referrers,
+		"followers":        followers,
+		"followers_gained": gained,
+		"followers_chart":  convertDayCountsToDataMap(followersPerDay, since, days),
+		"tags":             tags,
+	}
+	return c.Render(200, "analytics", data)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Pasted images travel inside the html, bigger autosaves are refused instead of filling the database
+const articleAutosaveMaxSize = 4 << 20
+
+// articleAutosaveOf reads the state of the editor from the form, the html is the one written and has to go through
+// processHTML before it is stored
+func articleAutosaveOf(c echo.Context, articleID uint64, owner string, version uint64) model.ArticleAutosave {
+	format := model.ARTICLE_FORMAT_HTML
+	if c.FormValue("format") == model.ARTICLE_FORMAT_MARKDOWN {
+		format = model.ARTICLE_FORMAT_MARKDOWN
+	}
+	return model.ArticleAutosave{
+		ArticleID: articleID,
+		Owner:     owner,
+		Title:     c.FormValue("title"),
+		Format:    format,
+		Source:    c.FormValue("source"),
+		Content:   c.FormValue("text"),
+		Version:   version,
+	}
+}
+
+// withArticleAutosave adds the autosave of the user to the data of the article form. With draft=restore the form
+// is filled with it, with draft=discard it is removed and otherwise the form offers to restore it.
+func withArticleAutosave(c echo.Context, data map[string]any, articleID uint64, username string) {
+	autosave, err := database.FindArticleAutosave(articleID, username)
+	if err != nil {
+		return
+	}
+	restoreURL, discardURL := "/article/create?which=part&draft=restore", "/article/create?which=part&draft=discard"
+	if articleID != 0 {
+		restoreURL = fmt.Sprintf("/article/edit/%d?draft=restore", articleID)
+		discardURL = fmt.Sprintf("/article/edit/%d?draft=discard", articleID)
+	}
+	switch c.QueryParam("draft") {
+	case "restore":
+		//Autosaves stored before they were processed may hold anything, the html is cleaned again
+		content, err := processHTML(autosave.Content)
+		if err != nil {
+			return
+		}
+		data["formValues"] = map[string]any{
+			"title":      autosave.Title,
+			"text":       template.HTML(content), //skipcq  GSC-G203
+			"source":     autosave.Source,
+			"isMarkdown": autosave.IsMarkdown(),
+		}
+		//Saving a restored autosave is checked against the version it was written on
+		data["version"] = autosave.Version
+	case "discard":
+		database.DeleteArticleAutosave(articleID, username)
+	default:
+		data["autosave"] = map[string]any{
+			"savedAt":    autosave.UpdatedAt.Format("2006-01-02 15:04"),
+			"restoreURL": restoreURL,
+			"discardURL": discardURL,
+		}
+	}
+}
+
+// AutosaveArticle stores the editor state of the user, the article itself is not changed until it is saved
+func AutosaveArticle(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	var articleID, version uint64
+	if idstr := c.Param("id"); idstr != "" {
+		id, err := strconv.ParseUint(idstr, 10, 64)
+		if err != nil {
+			return c.String(400, "Bad Request")
+		}
+		article, err := database.FindArticleByID(id)
+		if err != nil {
+			return c.String(404, "Not Found")
+		}
+		if !canEditPost(user.Username, "article", article.ID, article.Author) {
+			return c.String(401, "Unauthorized")
+		}
+		version, err = strconv.ParseUint(c.FormValue("version"), 10, 64)
+		if err != nil {
+			return c.String(400, "Bad Request")
+		}
+		articleID = article.ID
+	}
+	locale := utils.GetLocale(c)
+	data := map[string]any{"locale": locale}
+	autosave := articleAutosaveOf(c, articleID, user.Username, version)
+	if len(autosave.Title)+len(autosave.Source)+len(autosave.Content) > articleAutosaveMaxSize {
+		data["error"] = utils.Translate(locale, "article_autosave_too_large_error")
+		return c.Render(200, "article_autosave", data)
+	}
+	autosave.Content, err = processHTML(autosave.Content)
+	if err != nil {
+		data["error"] = utils.Translate(locale, "article_autosave_error")
+		return c.Render(200, "article_autosave", data)
+	}
+	err = database.SaveArticleAutosave(&autosave)
+	if err != nil {
+		data["error"] = utils.Translate(locale, "article_autosave_error")
+		return c.Render(200, "article_autosave", data)
+	}
+	data["savedAt"] = autosave.UpdatedAt.Format("15:04:05")
+	return c.Render(200, "article_autosave", data)
+}
+
+// renderArticleConflict shows the edit that could not be saved next to the saved article. The edit is kept as the
+// autosave of the user on the current version, restoring it and saving again replaces the saved article.
+func renderArticleConflict(c echo.Context, mine model.ArticleAutosave, mineHTML string) error {
+	saved, err := database.FindArticleByID(mine.ArticleID)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	mine.Content = mineHTML
+	mine.Version = saved.Version
+	err = database.SaveArticleAutosave(&mine)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	savedContent, _ := articleContent(saved.Content)
+	mineContent, _ := articleContent(mineHTML)
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+		"id":     saved.ID,
+		"mine": map[string]any{
+			"title":   mine.Title,
+			"content": mineContent,
+		},
+		"saved": map[string]any{
+			"title":     saved.Title,
+			"content":   savedContent,
+			"updatedAt": saved.UpdatedAt.Format("2006-01-02 15:04:05"),
+		},
+	}
+	return c.Render(200, "article_conflict", data)
+}
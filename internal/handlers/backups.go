@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Backups are only available to admins, they are listed in the dashboard
+func ListBackups(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
+		return c.String(401, "Unauthorized")
+	}
+	return renderBackups(c, "", "")
+}
+
+func renderBackups(c echo.Context, message, errorMessage string) error {
+	locale := utils.GetLocale(c)
+	backupsDB, err := database.ListBackups()
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	backups := make([]map[string]any, len(backupsDB))
+	for i, backup := range backupsDB {
+		backups[i] = map[string]any{
+			"name":      backup.Name,
+			"size":      strconv.FormatInt(backup.Size/1024, 10) + " KB",
+			"createdAt": backup.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	data := map[string]any{
+		"locale":    locale,
+		"backups":   backups,
+		"retention": database.BackupRetention,
+		"message":   message,
+		"error":     errorMessage,
+	}
+	return c.Render(200, "backups", data)
+}
+
+func CreateBackup(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	_, err = database.CreateBackup()
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_create_error"))
+	}
+	err = database.PruneBackups(database.BackupRetention)
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_prune_error"))
+	}
+	return renderBackups(c, utils.Translate(locale, "backups_create_success"), "")
+}
+
+func DownloadBackup(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
+		return c.String(401, "Unauthorized")
+	}
+	path, err := database.BackupPath(c.Param("name"))
+	if err != nil {
+		return c.String(400, "Bad request")
+	}
+	if _, err = os.Stat(path); err != nil {
+		return c.String(404, "Not found")
+	}
+	return c.Attachment(path, filepath.Base(path))
+}
+
+func RestoreBackup(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	path, err := database.BackupPath(c.Param("name"))
+	if err != nil {
+		return c.String(400, "Bad request")
+	}
+	err = database.RestoreBackup(path)
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_restore_error"))
+	}
+	return renderBackups(c, utils.Translate(locale, "backups_restore_success"), "")
+}
+
+// UploadBackup stores a snapshot taken elsewhere so it can be restored from the list
+func UploadBackup(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	file, err := c.FormFile("backup")
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	src, err := file.Open()
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	defer src.Close()
+	err = os.MkdirAll(database.BackupDir, 0775)
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	path, err := database.BackupPath(database.NewBackupName())
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	dst, err := os.Create(path)
+	if err != nil {
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	_, err = io.Copy(dst, src)
+	dst.Close()
+	if err == nil {
+		err = database.VerifyBackup(path)
+	}
+	if err != nil {
+		os.Remove(path)
+		return renderBackups(c, "", utils.Translate(locale, "backups_upload_error"))
+	}
+	return renderBackups(c, utils.Translate(locale, "backups_upload_success"), "")
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// addRelationData adds to the data of a profile whether the viewer blocked, was blocked by or muted the user
+func addRelationData(data map[string]any, viewer, username string) {
+	data["can_restrict"] = viewer != "" && viewer != username
+	if viewer == "" {
+		return
+	}
+	isBlocked, _ := database.HasBlocked(viewer, username)
+	blockedBy, _ := database.HasBlocked(username, viewer)
+	isMuted, _ := database.HasMuted(viewer, username)
+	data["is_blocked"] = isBlocked
+	data["blocked_by"] = blockedBy
+	data["is_muted"] = isMuted
+}
+
+// isBlockedWith tells whether any of the two users blocked the other, errors count as blocked
+func isBlockedWith(viewer, username string) bool {
+	blocked, err := database.IsBlockedBetween(viewer, username)
+	return err != nil || blocked
+}
+
+func renderProfileRelation(c echo.Context, viewer, username string) error {
+	followList, err := database.FindFollowListByUsername(viewer)
+	if err != nil {
+		followList = model.FollowList{Owner: viewer}
+	}
+	data := map[string]any{
+		"username":     username,
+		"locale":       utils.GetLocale(c),
+		"is_following": isFollowing(followList, model.User{Username: username}),
+	}
+	addRelationData(data, viewer, username)
+	return c.Render(200, "profile_relation", data)
+}
+
+// findUserToRestrict returns the user of the session and the one in the url, users can not restrict themselves
+func findUserToRestrict(c echo.Context) (model.User, model.User, error) {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return user, model.User{}, echo.ErrUnauthorized
+	}
+	other, err := database.FindUserByUsername(c.Param("username"))
+	if err != nil {
+		return user, other, echo.ErrNotFound
+	}
+	if other.Username == user.Username {
+		return user, other, echo.ErrBadRequest
+	}
+	return user, other, nil
+}
+
+func restrictErrorResponse(c echo.Context, err error) error {
+	switch err {
+	case echo.ErrUnauthorized:
+		return c.String(401, "Unauthorized")
+	case echo.ErrBadRequest:
+		return c.String(400, "Bad request")
+	}
+	return c.String(404, "Not found")
+}
+
+// BlockUser also removes the follows between both users, the blocked user is not told
+func BlockUser(c echo.Context) error {
+	user, other, err := findUserToRestrict(c)
+	if err != nil {
+		return restrictErrorResponse(c, err)
+	}
+	err = database.BlockUser(user.Username, other.Username)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return renderProfileRelation(c, user.Username, other.Username)
+}
+
+// UnblockUser does not bring back the follows removed by the block
+func UnblockUser(c echo.Context) error {
+	user, other, err := findUserToRestrict(c)
+	if err != nil {
+		return restrictErrorResponse(c, err)
+	}
+	err = database.UnblockUser(user.Username, other.Username)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return renderProfileRelation(c, user.Username, other.Username)
+}
+
+func MuteUser(c echo.Context) error {
+	user, other, err := findUserToRestrict(c)
+	if err != nil {
+		return restrictErrorResponse(c, err)
+	}
+	err = database.MuteUser(user.Username, other.Username)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return renderProfileRelation(c, user.Username, other.Username)
+}
+
+func UnmuteUser(c echo.Context) error {
+	user, other, err := findUserToRestrict(c)
+	if err != nil {
+		return restrictErrorResponse(c, err)
+	}
+	err = database.UnmuteUser(user.Username, other.Username)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return renderProfileRelation(c, user.Username, other.Username)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// canEditPost tells whether the user can change the content of the post, its author or a co-author with the editor role
+func canEditPost(username, ownerType string, ownerID uint64, author string) bool {
+	if username == "" {
+		return false
+	}
+	if username == author {
+		return true
+	}
+	coAuthor, err := database.FindCoAuthorOfOwner(username, ownerType, ownerID)
+	return err == nil && coAuthor.CanEdit()
+}
+
+// wrotePost tells whether the user is the author or an accepted co-author of the post
+func wrotePost(username string, post model.Post) bool {
+	if username == post.Author {
+		return true
+	}
+	coAuthor, err := database.FindCoAuthor(post.ID, username)
+	return err == nil && coAuthor.Accepted
+}
+
+// coAuthorNames lists the accepted co-authors of the article, gallery or project
+func coAuthorNames(ownerType string, ownerID uint64) []string {
+	post, err := database.FindPostByOwner(ownerID, ownerType)
+	if err != nil {
+		return nil
+	}
+	names, _ := database.FindCoAuthorNamesOfPosts([]uint64{post.ID})
+	return names[post.ID]
+}
+
+func coAuthorRoleOptions(selected string) []map[string]any {
+	options := make([]map[string]any, len(model.COAUTHOR_ROLES))
+	for i, role := range model.COAUTHOR_ROLES {
+		options[i] = map[string]any{
+			"name":     role,
+			"label":    "coauthors_role_" + role,
+			"selected": role == selected,
+		}
+	}
+	return options
+}
+
+// renderCoAuthors shows the co-authors of the post, only its author can invite and remove them
+func renderCoAuthors(c echo.Context, post model.Post, user model.User, form_errors, formValues map[string]string) error {
+	locale := utils.GetLocale(c)
+	coAuthors, err := database.FindCoAuthorsOfPost(post.ID)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	isAuthor := user.Username == post.Author
+	var coAuthorsData []map[string]any
+	for _, coAuthor := range coAuthors {
+		if !coAuthor.Accepted && !isAuthor {
+			continue
+		}
+		coAuthorsData = append(coAuthorsData, map[string]any{
+			"username": coAuthor.Username,
+			"role":     "coauthors_role_" + coAuthor.Role,
+			"roles":    coAuthorRoleOptions(coAuthor.Role),
+			"pending":  !coAuthor.Accepted,
+			"isMe":     coAuthor.Username == user.Username,
+		})
+	}
+	if formValues == nil {
+		formValues = map[string]string{"role": model.COAUTHOR_EDITOR}
+	}
+	data := map[string]any{
+		"locale":     locale,
+		"type":       post.OwnerType,
+		"owner_id":   post.OwnerID,
+		"coauthors":  coAuthorsData,
+		"isAuthor":   isAuthor && user.Active,
+		"canInvite":  isAuthor && user.Active && len(coAuthors) < model.COAUTHORS_MAX,
+		"roles":      coAuthorRoleOptions(formValues["role"]),
+		"errors":     form_errors,
+		"formValues": formValues,
+	}
+	return c.Render(200, "coauthors", data)
+}
+
+// findPostOfCoAuthors returns the post in the url if the user wrote it or was invited to
+func findPostOfCoAuthors(c echo.Context) (model.Post, model.User, error) {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return post, model.User{}, echo.ErrNotFound
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return post, user, echo.ErrUnauthorized
+	}
+	if user.Username == post.Author {
+		return post, user, nil
+	}
+	if _, err := database.FindCoAuthor(post.ID, user.Username); err != nil {
+		return post, user, echo.ErrUnauthorized
+	}
+	return post, user, nil
+}
+
+func GetCoAuthors(c echo.Context) error {
+	post, user, err := findPostOfCoAuthors(c)
+	if err != nil {
+		//Visitors only see the names next to the author, the list is for the people writing the post
+		return c.NoContent(200)
+	}
+	return renderCoAuthors(c, post, user, nil, nil)
+}
+
+func InviteCoAuthor(c echo.Context) error {
+	post, user, err := findPostOfCoAuthors(c)
+	if err != nil || user.Username != post.Author || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	username := strings.TrimPrefix(strings.TrimSpace(c.FormValue("username")), "@")
+	role := c.FormValue("role")
+	formValues := map[string]string{"username": username, "role": role}
+	form_errors := make(map[string]string)
+	invited, err := database.FindUserByUsername(username)
+	switch {
+	case err != nil || !invited.Active:
+		form_errors["username"] = utils.Translate(locale, "coauthors_user_not_found")
+	case invited.Username == post.Author:
+		form_errors["username"] = utils.Translate(locale, "coauthors_user_is_author")
+	case isBlockedWith(user.Username, invited.Username):
+		//Blocked users are not told about the block
+		form_errors["username"] = utils.Translate(locale, "coauthors_user_not_found")
+	default:
+		if _, err := database.FindCoAuthor(post.ID, invited.Username); err == nil {
+			form_errors["username"] = utils.Translate(locale, "coauthors_user_already_invited")
+		}
+	}
+	if !slices.Contains(model.COAUTHOR_ROLES, role) {
+		form_errors["role"] = utils.Translate(locale, "coauthors_role_invalid")
+	}
+	if len(form_errors) > 0 {
+		return renderCoAuthors(c, post, user, form_errors, formValues)
+	}
+	err = database.InviteCoAuthor(&model.CoAuthor{
+		PostID:    post.ID,
+		Username:  invited.Username,
+		Role:      role,
+		InvitedBy: user.Username,
+	})
+	if err == database.ErrTooManyCoAuthors {
+		form_errors["username"] = utils.Translate(locale, "coauthors_too_many")
+		return renderCoAuthors(c, post, user, form_errors, formValues)
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderCoAuthors(c, post, user, nil, nil)
+}
+
+func ChangeCoAuthorRole(c echo.Context) error {
+	post, user, err := findPostOfCoAuthors(c)
+	if err != nil || user.Username != post.Author || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	role := c.FormValue("role")
+	if !slices.Contains(model.COAUTHOR_ROLES, role) {
+		return c.String(400, "Bad Request")
+	}
+	coAuthor, err := database.FindCoAuthor(post.ID, c.FormValue("username"))
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	coAuthor.Role = role
+	err = database.UpdateCoAuthorRole(&coAuthor)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderCoAuthors(c, post, user, nil, nil)
+}
+
+// RemoveCoAuthor lets the author remove anyone and a co-author leave the post
+func RemoveCoAuthor(c echo.Context) error {
+	post, user, err := findPostOfCoAuthors(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	username := c.FormValue("username")
+	if user.Username != post.Author && user.Username != username {
+		return c.String(401, "Unauthorized")
+	}
+	coAuthor, err := database.FindCoAuthor(post.ID, username)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	err = database.DeleteCoAuthor(&coAuthor)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if user.Username != post.Author {
+		return c.NoContent(200)
+	}
+	return renderCoAuthors(c, post, user, nil, nil)
+}
+
+func renderInvitations(c echo.Context, user model.User) error {
+	invitations, err := database.FindPendingInvitations(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	invitationsData := make([]map[string]any, len(invitations))
+	for i, invitation := range invitations {
+		invitationsData[i] = map[string]any{
+			"id":     invitation.ID,
+			"title":  invitation.Post.Title,
+			"author": invitation.Post.Author,
+			"type":   invitation.Post.OwnerType,
+			"path":   postPath(invitation.Post.OwnerType, invitation.Post.OwnerID, invitation.Post.Slug),
+			"role":   "coauthors_role_" + invitation.Role,
+		}
+	}
+	data := map[string]any{
+		"locale":      utils.GetLocale(c),
+		"invitations": invitationsData,
+	}
+	return c.Render(200, "coauthor_invitations", data)
+}
+
+// GetCoAuthorInvitations lists the invitations the user has not answered, shown on their own profile
+func GetCoAuthorInvitations(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	return renderInvitations(c, user)
+}
+
+// AnswerCoAuthorInvitation accepts or declines the invitation, declined ones are removed
+func AnswerCoAuthorInvitation(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	invitation, err := database.FindCoAuthorByID(id)
+	if err != nil || invitation.Username != user.Username || invitation.Accepted {
+		return c.String(404, "Not Found")
+	}
+	switch c.FormValue("answer") {
+	case "accept":
+		err = database.AcceptCoAuthorInvitation(&invitation)
+	case "decline":
+		err = database.DeleteCoAuthor(&invitation)
+	default:
+		return c.String(400, "Bad Request")
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderInvitations(c, user)
+}
+
+// canEditImage tells whether the user uploaded the image or can edit the gallery holding it
+func canEditImage(username string, image model.Image) bool {
+	if username != "" && image.Owner == username {
+		return true
+	}
+	gallery, err := database.FindGalleryByID(image.GalleryID)
+	return err == nil && canEditPost(username, "gallery", gallery.ID, gallery.Author)
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	commentMaxLength = 5000
+	// Replies deeper than this are shown at the same indentation as their parent
+	commentMaxDepth = 4
+)
+
+var (
+	postTypes     = []string{"article", "gallery", "project"}
+	commentsModes = []string{model.COMMENTS_OPEN, model.COMMENTS_MODERATED, model.COMMENTS_CLOSED}
+)
+
+// findPostOfURL returns the post index entry of the article, gallery or project in the url
+func findPostOfURL(c echo.Context) (model.Post, error) {
+	postType := c.Param("type")
+	if !slices.Contains(postTypes, postType) {
+		return model.Post{}, echo.ErrNotFound
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return model.Post{}, echo.ErrNotFound
+	}
+	return database.FindPostByOwner(id, postType)
+}
+
+func isModeratorUser(user model.User) bool {
+	return user.Authority.Level >= model.AUTH_MODERATOR.Level
+}
+
+func GetComments(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, _ := GetUserOfSession(c)
+	if !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) {
+		return c.String(401, "Unauthorized")
+	}
+	return renderComments(c, post, user, nil, nil)
+}
+
+// renderComments builds the threads of the post, pending comments are only shown to who can act on them
+func renderComments(c echo.Context, post model.Post, user model.User, errors, formValues map[string]string) error {
+	locale := utils.GetLocale(c)
+	comments, err := database.FindCommentsOfPost(post.ID)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	isPostAuthor := user.Username != "" && user.Username == post.Author
+	isModerator := isModeratorUser(user)
+	canComment := user.Username != "" && user.Active && !post.IsDraft() && post.CommentsOpen()
+	//Comments of users blocked with the viewer are hidden, their replies go with them
+	var blocked []string
+	if user.Username != "" {
+		blocked, _ = database.FindUsernamesBlockedWith(user.Username)
+	}
+	replies := make(map[uint64][]model.Comment)
+	for _, comment := range comments {
+		if slices.Contains(blocked, comment.Author) {
+			continue
+		}
+		if comment.Approved || comment.Author == user.Username || isPostAuthor || isModerator {
+			replies[comment.ParentID] = append(replies[comment.ParentID], comment)
+		}
+	}
+	count := 0
+	var convert func(parentID uint64, depth int) []map[string]any
+	convert = func(parentID uint64, depth int) []map[string]any {
+		thread := make([]map[string]any, len(replies[parentID]))
+		for i, comment := range replies[parentID] {
+			count++
+			isAuthor := comment.Author == user.Username
+			thread[i] = map[string]any{
+				"id":         comment.ID,
+				"author":     comment.Author,
+				"avatar":     comment.User.Profile.PfPUrl,
+				"content":    template.HTML(comment.Content), //skipcq  GSC-G203
+				"createdAt":  comment.CreatedAt.Format("2006-01-02 15:04"),
+				"pending":    !comment.Approved,
+				"nested":     depth < commentMaxDepth,
+				"canReply":   canComment && comment.Approved,
+				"canDelete":  isAuthor || isPostAuthor || isModerator,
+				"canApprove": !comment.Approved && (isPostAuthor || isModerator),
+				"canReport":  user.Username != "" && !isAuthor,
+				"replies":    convert(comment.ID, depth+1),
+				"locale":     locale,
+				"type":       post.OwnerType,
+				"owner_id":   post.OwnerID,
+			}
+		}
+		return thread
+	}
+	threads := convert(0, 0)
+	data := map[string]any{
+		"locale":          locale,
+		"type":            post.OwnerType,
+		"owner_id":        post.OwnerID,
+		"comments":        threads,
+		"count":           count,
+		"canComment":      canComment,
+		"isAuthenticated": user.Username != "",
+		"isPostAuthor":    isPostAuthor,
+		"mode":            post.CommentsMode,
+		"closed":          !post.CommentsOpen(),
+		"moderated":       post.CommentsModerated(),
+		"errors":          errors,
+		"formValues":      formValues,
+	}
+	return c.Render(200, "comments", data)
+}
+
+func CreateComment(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	if post.IsDraft() || !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) || !post.CommentsOpen() {
+		return c.String(403, "Forbidden")
+	}
+	locale := utils.GetLocale(c)
+	var comment model.Comment
+	if parentStr := c.FormValue("parent"); parentStr != "" && parentStr != "0" {
+		parentID, err := strconv.ParseUint(parentStr, 10, 64)
+		if err != nil {
+			return c.String(400, "Bad Request")
+		}
+		parent, err := database.FindCommentByID(parentID)
+		if err != nil || parent.PostID != post.ID || !parent.Approved {
+			return c.String(400, "Bad Request")
+		}
+		if isBlockedWith(user.Username, parent.Author) {
+			return c.String(403, "Forbidden")
+		}
+		comment.ParentID = parent.ID
+	}
+	text := strings.TrimSpace(c.FormValue("content"))
+	formValues := map[string]string{"content": text}
+	if text == "" {
+		return renderComments(c, post, user, map[string]string{"content": utils.Translate(locale, "comments_empty_error")}, formValues)
+	}
+	if len([]rune(text)) > commentMaxLength {
+		return renderComments(c, post, user, map[string]string{"content": utils.Translate(locale, "comments_too_long_error")}, formValues)
+	}
+	//Comments are written in markdown and cleaned with the same policy as the articles
+	comment.Content = sanitizeHTML(renderMarkdown([]byte(text)))
+	if strings.TrimSpace(comment.Content) == "" {
+		return renderComments(c, post, user, map[string]string{"content": utils.Translate(locale, "comments_empty_error")}, formValues)
+	}
+	comment.PostID = post.ID
+	comment.Author = user.Username
+	comment.Approved = !post.CommentsModerated() || user.Username == post.Author
+	err = database.CreateComment(&comment)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if user.Username != post.Author {
+		go sendCommentNotification(post, comment, locale)
+	}
+	return renderComments(c, post, user, nil, nil)
+}
+
+func DeleteComment(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	comment, err := database.FindCommentByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	if comment.Author != user.Username && comment.Post.Author != user.Username && !isModeratorUser(user) {
+		return c.String(401, "Unauthorized")
+	}
+	err = database.DeleteComment(&comment)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	c.Response().Header().Set("HX-Trigger", "comments-reload")
+	data := map[string]string{
+		"message": "Comment deleted successfully!",
+	}
+	return c.JSON(200, data)
+}
+
+func ApproveComment(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	comment, err := database.FindCommentByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	if comment.Post.Author != user.Username && !isModeratorUser(user) {
+		return c.String(401, "Unauthorized")
+	}
+	err = database.ApproveComment(&comment)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	c.Response().Header().Set("HX-Trigger", "comments-reload")
+	data := map[string]string{
+		"message": "Comment approved successfully!",
+	}
+	return c.JSON(200, data)
+}
+
+// ReportComment sends the comment to the moderators, the reason comes from the htmx prompt
+func ReportComment(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	comment, err := database.FindCommentByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	reason := strings.TrimSpace(c.Request().Header.Get("HX-Prompt"))
+	report := model.Report{
+		Description: fmt.Sprintf("Comment %d by @%s on %s %d, reported by @%s: %s\n\n%s", comment.ID, comment.Author,
+			comment.Post.OwnerType, comment.Post.OwnerID, user.Username, reason, comment.Content),
+		CommentID: comment.ID,
+	}
+	err = database.CreateReport(&report)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+	}
+	return c.Render(200, "comment_reported", data)
+}
+
+func UpdateCommentsMode(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active || user.Username != post.Author {
+		return c.String(401, "Unauthorized")
+	}
+	mode := c.FormValue("mode")
+	if !slices.Contains(commentsModes, mode) {
+		return c.String(400, "Bad Request")
+	}
+	err = database.UpdatePostCommentsMode(&post, mode)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	post.CommentsMode = mode
+	return renderComments(c, post, user, nil, nil)
+}
+
+// sendCommentNotification lets the author of the post know someone commented on it
+func sendCommentNotification(post model.Post, comment model.Comment, locale string) {
+	author, err := database.FindUserByUsername(post.Author)
+	if err != nil || author.Email == "" {
+		return
+	}
+	var body bytes.Buffer
+	headers := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	//Titles are written by users, line breaks in them would add headers to the message
+	title := strings.NewReplacer("\r", " ", "\n", " ").Replace(post.Title)
+	subject := mime.QEncoding.Encode("UTF-8", fmt.Sprintf(utils.Translate(locale, "comments_email_subject"), comment.Author, title))
+	body.WriteString(fmt.Sprintf("Subject: %s\n%s\n\n", subject, headers))
+	if !comment.Approved {
+		body.WriteString("<p>" + html.EscapeString(utils.Translate(locale, "comments_email_pending")) + "</p>")
+	}
+	body.WriteString("<blockquote>" + comment.Content + "</blockquote>")
+	if post.OwnerType != "project" {
+		link := fmt.Sprintf("%s/%s/%d", utils.BaseURL, post.OwnerType, post.OwnerID)
+		body.WriteString(`<p><a href="` + link + `">` + link + `</a></p>`)
+	}
+	err = utils.SendEmailNotification([]string{author.Email}, body.Bytes())
+	if err != nil {
+		log.Errorf("Error sending comment notification to %s: %v", author.Username, err)
+	}
+}
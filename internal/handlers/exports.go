@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/joho/godotenv"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	xhtml "golang.org/x/net/html"
+)
+
+const ExportsDir = "./exports"
+
+// exportFormat identifies the archives built by this application in their manifest
+const exportFormat = "portfol.io"
+
+// Hosts the images of the posts are downloaded from into the exports, IMAGE_HOSTS replaces them. Uploaded images
+// are kept in imgbb, the urls of any other host stay in the export as they are.
+var ImageHosts = []string{"i.ibb.co"}
+
+var (
+	errImageHostNotAllowed = errors.New("the image host is not allowed")
+	errPrivateAddress      = errors.New("the address is not public")
+	errNotAnImage          = errors.New("the response is not an image")
+)
+
+// exportHTTPClient only connects to public addresses and only follows redirects to the image hosts
+var exportHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: publicAddressOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if !isImageHost(req.URL) {
+			return errImageHostNotAllowed
+		}
+		return nil
+	},
+}
+
+func init() {
+	godotenv.Load()
+	if hosts := os.Getenv("IMAGE_HOSTS"); hosts != "" {
+		ImageHosts = strings.Split(hosts, ",")
+	}
+}
+
+// publicAddressOnly refuses to connect to loopback, private and link-local addresses. It runs on the resolved
+// address, so a host can not resolve to one of them after being checked.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+func isImageHost(u *url.URL) bool {
+	return (u.Scheme == "https" || u.Scheme == "http") && slices.Contains(ImageHosts, u.Hostname())
+}
+
+func GetDataExport(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return GetDataExportPart(c)
+	}
+	return GetDataExportFull(c)
+}
+
+func GetDataExportFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"isActive":        user.Active,
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"page_to_load":    "/profile/mine/export?which=part",
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+func GetDataExportPart(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	return renderDataExport(c, user)
+}
+
+func renderDataExport(c echo.Context, user model.User) error {
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+	}
+	export, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_DATA)
+	if err == nil {
+		data["status"] = export.Status
+		data["isPending"] = export.Status == model.EXPORT_PENDING
+		data["isReady"] = export.Status == model.EXPORT_READY
+		data["isFailed"] = export.Status == model.EXPORT_FAILED
+		data["requestedAt"] = export.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	return c.Render(200, "data_export", data)
+}
+
+// RequestDataExport starts building the archive in the background, only one may be pending at a time
+func RequestDataExport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	latest, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_DATA)
+	hasPrevious := err == nil
+	if hasPrevious && latest.Status == model.EXPORT_PENDING {
+		return renderDataExport(c, user)
+	}
+	export := model.DataExport{Owner: user.Username, Kind: model.EXPORT_KIND_DATA, Status: model.EXPORT_PENDING}
+	err = database.CreateDataExport(&export)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	//Only the latest archive is kept around
+	if hasPrevious {
+		removeDataExportFile(latest)
+	}
+	go buildDataExport(export, user, utils.GetLocale(c))
+	return renderDataExport(c, user)
+}
+
+func DownloadDataExport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	export, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_DATA)
+	if err != nil || export.Status != model.EXPORT_READY {
+		return c.String(404, "Not found")
+	}
+	return c.Attachment(filepath.Join(ExportsDir, export.FileName), export.FileName)
+}
+
+func removeDataExportFile(export model.DataExport) {
+	if export.FileName == "" {
+		return
+	}
+	os.Remove(filepath.Join(ExportsDir, export.FileName))
+}
+
+// removeDataExports deletes the archives of a user, the records are removed along with the user
+func removeDataExports(username string) {
+	exports, err := database.FindDataExportsByOwner(username)
+	if err != nil {
+		return
+	}
+	for _, export := range exports {
+		removeDataExportFile(export)
+	}
+}
+
+func buildDataExport(export model.DataExport, user model.User, locale string) {
+	export.FileName = fmt.Sprintf("%s_%d.zip", user.Username, time.Now().Unix())
+	err := writeDataExport(filepath.Join(ExportsDir, export.FileName), user)
+	export.Status = model.EXPORT_READY
+	if err != nil {
+		log.Errorf("Error exporting data of %s: %v", user.Username, err)
+		removeDataExportFile(export)
+		export.Status = model.EXPORT_FAILED
+		export.FileName = ""
+	}
+	err = database.UpdateDataExport(&export)
+	if err != nil {
+		log.Errorf("Error updating data export of %s: %v", user.Username, err)
+		return
+	}
+	if export.Status == model.EXPORT_READY && user.Email != "" {
+		sendDataExportNotification(user, locale)
+	}
+}
+
+func sendDataExportNotification(user model.User, locale string) {
+	var body bytes.Buffer
+	headers := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	body.WriteString(fmt.Sprintf("Subject: %s\n%s\n\n", utils.Translate(locale, "data_export_email_subject"), headers))
+	body.WriteString("<p>" + html.EscapeString(utils.Translate(locale, "data_export_email_body")) + "</p>")
+	link := utils.BaseURL + "/profile/mine/export/download"
+	body.WriteString(`<p><a href="` + link + `">` + link + `</a></p>`)
+	err := utils.SendEmailNotification([]string{user.Email}, body.Bytes())
+	if err != nil {
+		log.Errorf("Error sending data export notification to %s: %v", user.Username, err)
+	}
+}
+
+func writeDataExport(name string, user model.User) error {
+	err := os.MkdirAll(ExportsDir, 0775)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zipWriter := zip.NewWriter(file)
+	manifest := map[string]any{
+		"format":     exportFormat,
+		"version":    1,
+		"exportedAt": time.Now(),
+	}
+	err = writeJSONToZip(zipWriter, "manifest.json", manifest)
+	if err != nil {
+		return err
+	}
+	err = writeProfileExport(zipWriter, user)
+	if err != nil {
+		return err
+	}
+	err = writeArticlesExport(zipWriter, user)
+	if err != nil {
+		return err
+	}
+	err = writeGalleriesExport(zipWriter, user)
+	if err != nil {
+		return err
+	}
+	err = writeSectionsExport(zipWriter, user)
+	if err != nil {
+		return err
+	}
+	err = writeFollowsExport(zipWriter, user)
+	if err != nil {
+		return err
+	}
+	votes, err := database.FindVotesCastByUser(user.Username)
+	if err != nil {
+		return err
+	}
+	err = writeJSONToZip(zipWriter, "votes.json", votes)
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+func writeJSONToZip(zipWriter *zip.Writer, name string, value any) error {
+	f, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeProfileExport(zipWriter *zip.Writer, user model.User) error {
+	profile := map[string]any{
+		"username":  user.Username,
+		"fullname":  user.FullName,
+		"email":     user.Email,
+		"bio":       user.Profile.Bio,
+		"avatar":    user.Profile.PfPUrl,
+		"authority": user.Authority.AuthName,
+		"active":    user.Active,
+		"createdAt": user.CreatedAt,
+		"updatedAt": user.UpdatedAt,
+	}
+	return writeJSONToZip(zipWriter, "profile.json", profile)
+}
+
+func writeArticlesExport(zipWriter *zip.Writer, user model.User) error {
+	var index []map[string]any
+	for page := 1; ; page++ {
+		articles, err := database.FindAllArticlesByAuthorPaginated(user.Username, page, 50)
+		if err != nil {
+			return err
+		}
+		for _, article := range articles {
+			base := fmt.Sprintf("articles/%d", article.ID)
+			f, err := zipWriter.Create(base + ".html")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(f, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"UTF-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n%s\n</body>\n</html>\n",
+				html.EscapeString(article.Title), html.EscapeString(article.Title), article.Content)
+			if err != nil {
+				return err
+			}
+			f, err = zipWriter.Create(base + ".md")
+			if err != nil {
+				return err
+			}
+			markdown := htmlToMarkdown(article.Content)
+			if article.IsMarkdown() {
+				markdown = article.Source
+			}
+			_, err = fmt.Fprintf(f, "# %s\n\n%s\n", article.Title, markdown)
+			if err != nil {
+				return err
+			}
+			tags, err := database.GetFirstFiftyMostVotedTagsForArticle(article.ID)
+			if err != nil {
+				return err
+			}
+			index = append(index, map[string]any{
+				"id":         article.ID,
+				"title":      article.Title,
+				"tags":       tagNames(tags),
+				"published":  article.Published,
+				"visibility": article.Visibility,
+				"createdAt":  article.CreatedAt,
+				"updatedAt":  article.UpdatedAt,
+				"html":       base + ".html",
+				"markdown":   base + ".md",
+			})
+		}
+		if len(articles) < 50 {
+			break
+		}
+	}
+	return writeJSONToZip(zipWriter, "articles.json", index)
+}
+
+func writeGalleriesExport(zipWriter *zip.Writer, user model.User) error {
+	var index []map[string]any
+	for page := 1; ; page++ {
+		galleries, err := database.FindAllGalleriesByAuthorPaginated(user.Username, page, 50)
+		if err != nil {
+			return err
+		}
+		for _, gallery := range galleries {
+			images := make([]map[string]any, len(gallery.Images))
+			for i, image := range gallery.Images {
+				images[i] = map[string]any{
+					"footer": image.Footer,
+					"alt":    image.Alt,
+					"cover":  image.ID == gallery.CoverID,
+					"url":    image.ImageURL,
+				}
+				//Images are hosted elsewhere, if one can not be downloaded the url is still kept
+				name, err := downloadImageToZip(zipWriter, fmt.Sprintf("galleries/%d/%d", gallery.ID, image.ID), image.ImageURL)
+				if err != nil {
+					log.Errorf("Error downloading image %d for export: %v", image.ID, err)
+					continue
+				}
+				images[i]["file"] = name
+			}
+			tags, err := database.GetFirstFiftyMostVotedTagsForGallery(gallery.ID)
+			if err != nil {
+				return err
+			}
+			index = append(index, map[string]any{
+				"id":         gallery.ID,
+				"title":      gallery.Title,
+				"tags":       tagNames(tags),
+				"published":  gallery.Published,
+				"visibility": gallery.Visibility,
+				"createdAt":  gallery.CreatedAt,
+				"updatedAt":  gallery.UpdatedAt,
+				"images":     images,
+			})
+		}
+		if len(galleries) < 50 {
+			break
+		}
+	}
+	return writeJSONToZip(zipWriter, "galleries.json", index)
+}
+
+// fetchImage downloads an image from one of the ImageHosts, both the content type and the content must be of an image
+func fetchImage(rawURL string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isImageHost(u) {
+		return nil, "", errImageHostNotAllowed
+	}
+	resp, err := exportHTTPClient.Get(u.String())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close() //skipcq GO-S2307
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", errNotAnImage
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ImageMaxUploadSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > ImageMaxUploadSize {
+		return nil, "", ErrImageTooLarge
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, "", errNotAnImage
+	}
+	ext := path.Ext(resp.Request.URL.Path)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	return data, ext, nil
+}
+
+func downloadImageToZip(zipWriter *zip.Writer, base, rawURL string) (string, error) {
+	data, ext, err := fetchImage(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := base + ext
+	f, err := zipWriter.Create(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	return name, err
+}
+
+func writeSectionsExport(zipWriter *zip.Writer, user model.User) error {
+	sections, err := database.FindSectionsByUser(user.Username)
+	if err != nil {
+		return err
+	}
+	index := make([]map[string]any, len(sections))
+	for i, section := range sections {
+		//A negative limit keeps every post, in the order chosen by the owner
+		sectionPosts, err := database.FindPostsInSectionOrdered(&section, -1)
+		if err != nil {
+			return err
+		}
+		posts := make([]map[string]any, len(sectionPosts))
+		for j, post := range sectionPosts {
+			posts[j] = map[string]any{
+				"type":  post.OwnerType,
+				"id":    post.OwnerID,
+				"title": post.Title,
+			}
+		}
+		index[i] = map[string]any{
+			"name":        section.Name,
+			"description": section.Description,
+			"visibility":  section.Visibility,
+			"posts":       posts,
+		}
+	}
+	return writeJSONToZip(zipWriter, "sections.json", index)
+}
+
+func writeFollowsExport(zipWriter *zip.Writer, user model.User) error {
+	var following []string
+	followList, err := database.FindFollowListByUsername(user.Username)
+	if err == nil {
+		for _, followed := range followList.Following {
+			following = append(following, followed.Username)
+		}
+	}
+	return writeJSONToZip(zipWriter, "follows.json", following)
+}
+
+// htmlToMarkdown converts the subset of html allowed by sanitizeHTML into markdown
+func htmlToMarkdown(htmlstr string) string {
+	doc, err := xhtml.Parse(strings.NewReader(htmlstr))
+	if err != nil {
+		return htmlstr
+	}
+	var buf strings.Builder
+	writeMarkdown(&buf, doc, 0)
+	lines := strings.Split(buf.String(), "\n")
+	var result []string
+	blank := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+			line = ""
+		} else {
+			blank = 0
+		}
+		result = append(result, line)
+	}
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
+
+func writeMarkdown(buf *strings.Builder, n *xhtml.Node, depth int) {
+	if n.Type == xhtml.TextNode {
+		buf.WriteString(n.Data)
+		return
+	}
+	if n.Type != xhtml.ElementNode {
+		writeMarkdownChildren(buf, n, depth)
+		return
+	}
+	switch n.Data {
+	case "p", "div":
+		writeMarkdownChildren(buf, n, depth)
+		buf.WriteString("\n\n")
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		buf.WriteString("\n" + strings.Repeat("#", level) + " ")
+		writeMarkdownChildren(buf, n, depth)
+		buf.WriteString("\n\n")
+	case "strong", "b":
+		writeMarkdownWrapped(buf, n, depth, "**")
+	case "em", "i":
+		writeMarkdownWrapped(buf, n, depth, "*")
+	case "s":
+		writeMarkdownWrapped(buf, n, depth, "~~")
+	case "br":
+		buf.WriteString("  \n")
+	case "a":
+		buf.WriteString("[")
+		writeMarkdownChildren(buf, n, depth)
+		buf.WriteString("](" + attributeOf(n, "href") + ")")
+	case "img":
+		buf.WriteString("![" + attributeOf(n, "alt") + "](" + attributeOf(n, "src") + ")")
+	case "ul", "ol":
+		buf.WriteString("\n")
+		position := 1
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != xhtml.ElementNode || child.Data != "li" {
+				continue
+			}
+			marker := "- "
+			if n.Data == "ol" {
+				marker = strconv.Itoa(position) + ". "
+				position++
+			}
+			buf.WriteString(strings.Repeat("  ", depth) + marker)
+			var item strings.Builder
+			writeMarkdownChildren(&item, child, depth+1)
+			buf.WriteString(strings.TrimSpace(item.String()) + "\n")
+		}
+		buf.WriteString("\n")
+	case "blockquote":
+		var quote strings.Builder
+		writeMarkdownChildren(&quote, n, depth)
+		for _, line := range strings.Split(strings.TrimSpace(quote.String()), "\n") {
+			buf.WriteString("> " + line + "\n")
+		}
+		buf.WriteString("\n")
+	case "pre":
+		buf.WriteString("\n```\n" + strings.TrimRight(textContent(n), "\n") + "\n```\n\n")
+	case "code":
+		buf.WriteString("`" + textContent(n) + "`")
+	default:
+		writeMarkdownChildren(buf, n, depth)
+	}
+}
+
+func writeMarkdownChildren(buf *strings.Builder, n *xhtml.Node, depth int) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeMarkdown(buf, child, depth)
+	}
+}
+
+func writeMarkdownWrapped(buf *strings.Builder, n *xhtml.Node, depth int, marker string) {
+	buf.WriteString(marker)
+	writeMarkdownChildren(buf, n, depth)
+	buf.WriteString(marker)
+}
+
+func attributeOf(n *xhtml.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *xhtml.Node) string {
+	if n.Type == xhtml.TextNode {
+		return n.Data
+	}
+	var buf strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(textContent(child))
+	}
+	return buf.String()
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFetchImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(encodedPNG(t, 2, 2, 255))
+	}))
+	defer server.Close()
+	local, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := ImageHosts
+	defer func() { ImageHosts = hosts }()
+	//The test server is allowed as a host, only its loopback address stops the download
+	ImageHosts = []string{"i.ibb.co", local.Hostname(), "localhost", "169.254.169.254"}
+	params := []struct {
+		name string
+		url  string
+		err  error
+	}{
+		{"other_host", "https://internal.example/image.png", errImageHostNotAllowed},
+		{"other_scheme", "file:///etc/passwd", errImageHostNotAllowed},
+		{"loopback", server.URL + "/image.png", errPrivateAddress},
+		{"localhost", "http://localhost:" + local.Port() + "/image.png", errPrivateAddress},
+		{"metadata", "http://169.254.169.254/latest/meta-data/", errPrivateAddress},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			_, _, err := fetchImage(p.url)
+			if !errors.Is(err, p.err) {
+				t.Errorf("expected error %v, got %v", p.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	FEED_FORMAT_RSS  = "rss"
+	FEED_FORMAT_ATOM = "atom"
+	FEED_FORMAT_JSON = "json"
+	feedSize         = 20
+)
+
+var feedContentTypes = map[string]string{
+	FEED_FORMAT_RSS:  "application/rss+xml; charset=utf-8",
+	FEED_FORMAT_ATOM: "application/atom+xml; charset=utf-8",
+	FEED_FORMAT_JSON: "application/feed+json; charset=utf-8",
+}
+
+// syndicationFeed is what the three formats have in common, the links are absolute
+type syndicationFeed struct {
+	Title       string
+	Description string
+	HomeURL     string
+	FeedURL     string
+	Updated     time.Time
+	Entries     []feedEntry
+}
+
+type feedEntry struct {
+	ID          string
+	Title       string
+	URL         string
+	Author      string
+	AuthorURL   string
+	Published   time.Time
+	Updated     time.Time
+	ContentHTML string
+	Enclosures  []feedEnclosure
+}
+
+type feedEnclosure struct {
+	URL  string
+	Type string
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string        `xml:"title"`
+	Link      string        `xml:"link"`
+	GUID      rssGUID       `xml:"guid"`
+	Creator   string        `xml:"dc:creator"`
+	PubDate   string        `xml:"pubDate"`
+	Content   string        `xml:"content:encoded"`
+	Enclosure *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Summary string      `xml:"subtitle,omitempty"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Links     []atomLink  `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []jsonFeedAuthor     `json:"authors"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+// siteURL is where absolute links start, BASE_URL when it is set and the requested host otherwise
+func siteURL(c echo.Context) string {
+	if utils.BaseURL != "" {
+		return utils.BaseURL
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+func imageMimeType(imageURL string) string {
+	if mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(imageURL))); strings.HasPrefix(mimeType, "image/") {
+		return mimeType
+	}
+	return "image/jpeg"
+}
+
+// feedEntriesOfPosts loads the content of each post, articles go whole and galleries list their images
+func feedEntriesOfPosts(base string, posts []model.Post) []feedEntry {
+	entries := make([]feedEntry, 0, len(posts))
+	for _, post := range posts {
+		entry := feedEntry{
+			ID:        fmt.Sprintf("%s/%s/%d", base, post.OwnerType, post.OwnerID),
+			Title:     post.Title,
+			Author:    post.Author,
+			AuthorURL: fmt.Sprintf("%s/profile/%s", base, post.Author),
+			Published: post.CreatedAt,
+			Updated:   post.UpdatedAt,
+		}
+		entry.URL = base + postPath(post.OwnerType, post.OwnerID, post.Slug)
+		switch post.OwnerType {
+		case "article":
+			article, err := database.FindArticleByID(post.OwnerID)
+			if err != nil {
+				continue
+			}
+			entry.ContentHTML = sanitizeHTML(article.Content)
+		case "gallery":
+			gallery, err := database.FindGalleryByID(post.OwnerID)
+			if err != nil {
+				continue
+			}
+			var content strings.Builder
+			for _, image := range gallery.Images {
+				content.WriteString(fmt.Sprintf(`<figure><img src="%s" alt="%s">`, html.EscapeString(image.ImageURL), html.EscapeString(image.Alt)))
+				if image.Footer != "" {
+					content.WriteString("<figcaption>" + html.EscapeString(image.Footer) + "</figcaption>")
+				}
+				content.WriteString("</figure>")
+				entry.Enclosures = append(entry.Enclosures, feedEnclosure{URL: image.ImageURL, Type: imageMimeType(image.ImageURL)})
+			}
+			//The cover goes first since RSS only takes one enclosure
+			if cover, ok := gallery.Cover(); ok {
+				for i := range entry.Enclosures {
+					if entry.Enclosures[i].URL == cover.ImageURL {
+						entry.Enclosures[0], entry.Enclosures[i] = entry.Enclosures[i], entry.Enclosures[0]
+						break
+					}
+				}
+			}
+			entry.ContentHTML = content.String()
+		case "project":
+			project, err := database.FindProjectByID(post.OwnerID)
+			if err != nil {
+				continue
+			}
+			if project.Link != "" {
+				entry.URL = project.Link
+			}
+			entry.ContentHTML = "<p>" + html.EscapeString(project.Description) + "</p>"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (f syndicationFeed) rss() ([]byte, error) {
+	feed := rssFeed{
+		Version:   "2.0",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.HomeURL,
+			Description: f.Description,
+			Self:        atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !f.Updated.IsZero() {
+		feed.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range f.Entries {
+		item := rssItem{
+			Title:   entry.Title,
+			Link:    entry.URL,
+			GUID:    rssGUID{IsPermaLink: false, Value: entry.ID},
+			Creator: entry.Author,
+			PubDate: entry.Published.UTC().Format(time.RFC1123Z),
+			Content: entry.ContentHTML,
+		}
+		if len(entry.Enclosures) > 0 {
+			item.Enclosure = &rssEnclosure{URL: entry.Enclosures[0].URL, Type: entry.Enclosures[0].Type}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	return append([]byte(xml.Header), body...), err
+}
+
+func (f syndicationFeed) atom() ([]byte, error) {
+	feed := atomFeed{
+		Title:   f.Title,
+		Summary: f.Description,
+		ID:      f.FeedURL,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.HomeURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, entry := range f.Entries {
+		links := []atomLink{{Href: entry.URL, Rel: "alternate", Type: "text/html"}}
+		for _, enclosure := range entry.Enclosures {
+			links = append(links, atomLink{Href: enclosure.URL, Rel: "enclosure", Type: enclosure.Type})
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     entry.Title,
+			ID:        entry.ID,
+			Links:     links,
+			Published: entry.Published.UTC().Format(time.RFC3339),
+			Updated:   entry.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: entry.Author, URI: entry.AuthorURL},
+			Content:   atomContent{Type: "html", Value: entry.ContentHTML},
+		})
+	}
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	return append([]byte(xml.Header), body...), err
+}
+
+func (f syndicationFeed) json() ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, entry := range f.Entries {
+		item := jsonFeedItem{
+			ID:            entry.ID,
+			URL:           entry.URL,
+			Title:         entry.Title,
+			ContentHTML:   entry.ContentHTML,
+			DatePublished: entry.Published.UTC().Format(time.RFC3339),
+			DateModified:  entry.Updated.UTC().Format(time.RFC3339),
+			Authors:       []jsonFeedAuthor{{Name: entry.Author, URL: entry.AuthorURL}},
+		}
+		for _, enclosure := range entry.Enclosures {
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{URL: enclosure.URL, MimeType: enclosure.Type})
+		}
+		if len(entry.Enclosures) > 0 {
+			item.Image = entry.Enclosures[0].URL
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// renderFeed writes the posts in the format of the url, answering 304 when the reader already has the latest version
+func renderFeed(c echo.Context, feed syndicationFeed, posts []model.Post) error {
+	format := c.Param("format")
+	contentType, ok := feedContentTypes[format]
+	if !ok {
+		return c.String(404, "Not Found")
+	}
+	base := siteURL(c)
+	feed.HomeURL = base + feed.HomeURL
+	feed.FeedURL = base + c.Request().URL.Path
+	for _, post := range posts {
+		if post.UpdatedAt.After(feed.Updated) {
+			feed.Updated = post.UpdatedAt
+		}
+	}
+	feed.Entries = feedEntriesOfPosts(base, posts)
+	var body []byte
+	var err error
+	switch format {
+	case FEED_FORMAT_RSS:
+		body, err = feed.rss()
+	case FEED_FORMAT_ATOM:
+		body, err = feed.atom()
+	default:
+		body, err = feed.json()
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	if !feed.Updated.IsZero() {
+		header.Set("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request(), etag, feed.Updated) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(200, contentType, body)
+}
+
+// notModified follows RFC 9110, If-None-Match wins over If-Modified-Since when both are sent
+func notModified(req *http.Request, etag string, updated time.Time) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	return err == nil && !updated.IsZero() && !updated.Truncate(time.Second).After(since)
+}
+
+func displayName(user model.User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return "@" + user.Username
+}
+
+func GetUserFeed(c echo.Context) error {
+	user, err := database.FindUserByUsername(c.Param("username"))
+	if err != nil || !user.Active {
+		return c.String(404, "Not Found")
+	}
+	posts, err := database.FindPostsByUserPaginated("", user.Username, 1, feedSize)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	locale := utils.GetLocale(c)
+	feed := syndicationFeed{
+		Title:       fmt.Sprintf(utils.Translate(locale, "feeds_user_title"), displayName(user)),
+		Description: user.Profile.Bio,
+		HomeURL:     "/profile/" + user.Username,
+	}
+	return renderFeed(c, feed, posts)
+}
+
+func GetSectionFeed(c echo.Context) error {
+	username, sectionName := c.Param("username"), c.Param("section")
+	user, err := database.FindUserByUsername(username)
+	if err != nil || !user.Active {
+		return c.String(404, "Not Found")
+	}
+	//The main section of a user holds every post
+	var posts []model.Post
+	if sectionName == user.Username {
+		posts, err = database.FindPostsByUserPaginated("", user.Username, 1, feedSize)
+	} else {
+		var section model.Section
+		var renamed bool
+		section, renamed, err = database.FindSectionByNameOrAlias(user.Username, sectionName)
+		if err != nil || section.Visibility == model.SECTION_PRIVATE {
+			return c.String(404, "Not Found")
+		}
+		if renamed {
+			return redirectToSlug(c, fmt.Sprintf("/profile/%s/sections/%s/feed.%s", user.Username, url.PathEscape(section.Name), c.Param("format")))
+		}
+		sectionName = section.Name
+		posts, err = database.FindPostsByUserAndSectionPaginated("", user.Username, sectionName, 1, feedSize)
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	locale := utils.GetLocale(c)
+	feed := syndicationFeed{
+		Title:   fmt.Sprintf(utils.Translate(locale, "feeds_section_title"), sectionName, displayName(user)),
+		HomeURL: fmt.Sprintf("/profile/%s/sections/%s", user.Username, url.PathEscape(sectionName)),
+	}
+	return renderFeed(c, feed, posts)
+}
+
+func GetTagFeed(c echo.Context) error {
+	tag, err := database.ResolveTag(c.Param("name"))
+	if err != nil || tag.Banned {
+		return c.String(404, "Not Found")
+	}
+	posts, err := database.FindPaginatedPostsByTagOrderedByDate("", tag.Name, 1, feedSize)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	locale := utils.GetLocale(c)
+	feed := syndicationFeed{
+		Title:       fmt.Sprintf(utils.Translate(locale, "feeds_tag_title"), tag.Name),
+		Description: tag.Description,
+		HomeURL:     "/posts/all/tag/" + url.PathEscape(tag.Name),
+	}
+	return renderFeed(c, feed, posts)
+}
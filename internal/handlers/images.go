@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/joho/godotenv"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ImageMaxUploadSize int64 = 10 << 20
+	ImageMaxPixels           = 40_000_000
+	// Widths of the responsive variants, images are never upscaled
+	ImageWidths = []int{320, 640, 1280, 1920}
+	// How many images of a bulk upload are processed and uploaded at the same time
+	ImageUploadWorkers    = 3
+	ErrImageTooLarge      = errors.New("image is too large")
+	ErrImageTooManyPixels = errors.New("image has too many pixels")
+	ErrUnsupportedImage   = errors.New("unsupported image format")
+	ErrGalleryFull        = errors.New("the gallery has no room for more images")
+	supportedImageFormats = []string{"jpeg", "png", "gif", "webp"}
+	avatarWidths          = []int{256}
+	articleImageMaxWidths = []int{1280}
+	jpegOptions           = &jpeg.Options{Quality: 85}
+)
+
+func init() {
+	godotenv.Load()
+	if mb, err := strconv.Atoi(os.Getenv("IMAGE_MAX_UPLOAD_MB")); err == nil && mb > 0 {
+		ImageMaxUploadSize = int64(mb) << 20
+	}
+	if pixels, err := strconv.Atoi(os.Getenv("IMAGE_MAX_PIXELS")); err == nil && pixels > 0 {
+		ImageMaxPixels = pixels
+	}
+	if workers, err := strconv.Atoi(os.Getenv("IMAGE_UPLOAD_WORKERS")); err == nil && workers > 0 {
+		ImageUploadWorkers = workers
+	}
+	if widths := os.Getenv("IMAGE_WIDTHS"); widths != "" {
+		var parsed []int
+		for _, width := range strings.Split(widths, ",") {
+			w, err := strconv.Atoi(strings.TrimSpace(width))
+			if err == nil && w > 0 {
+				parsed = append(parsed, w)
+			}
+		}
+		if len(parsed) > 0 {
+			sort.Ints(parsed)
+			ImageWidths = parsed
+		}
+	}
+}
+
+type imageVariant struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// processImage validates an uploaded image and re-encodes it at every width up to its own.
+// Re-encoding drops the EXIF data, the orientation it held is applied to the pixels first.
+func processImage(data []byte, widths []int) ([]imageVariant, error) {
+	if int64(len(data)) > ImageMaxUploadSize {
+		return nil, ErrImageTooLarge
+	}
+	//The header is enough to reject decompression bombs before decoding
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !slices.Contains(supportedImageFormats, format) {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > ImageMaxPixels {
+		return nil, ErrImageTooManyPixels
+	}
+	//Re-encoding would keep only the first frame of an animation, GIFs carry no EXIF so they are kept as they are
+	if format == "gif" && gifFrameCount(data) > 1 {
+		return []imageVariant{{Width: config.Width, Height: config.Height, Data: data}}, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	width := img.Bounds().Dx()
+	var targets []int
+	for _, w := range widths {
+		if w < width {
+			targets = append(targets, w)
+		}
+	}
+	//The largest variant is the image itself, capped at the widest configured width
+	targets = append(targets, min(width, widths[len(widths)-1]))
+	opaque := isOpaque(img)
+	variants := make([]imageVariant, 0, len(targets))
+	for _, w := range targets {
+		resized := resizeImage(img, w)
+		var buf bytes.Buffer
+		if opaque {
+			err = jpeg.Encode(&buf, resized, jpegOptions)
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		bounds := resized.Bounds()
+		variants = append(variants, imageVariant{Width: bounds.Dx(), Height: bounds.Dy(), Data: buf.Bytes()})
+	}
+	return variants, nil
+}
+
+// uploadImageVariants processes the image and uploads every variant, smallest first
+func uploadImageVariants(data []byte) ([]model.ImageVariant, error) {
+	variants, err := processImage(data, ImageWidths)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := make([]model.ImageVariant, len(variants))
+	for i, variant := range variants {
+		urlMap, err := uploadImageToImgbb(variant.Data)
+		if err != nil {
+			return nil, err
+		}
+		uploaded[i] = model.ImageVariant{
+			Width:     variant.Width,
+			Height:    variant.Height,
+			URL:       urlMap["image_url"],
+			DeleteURL: urlMap["delete_url"],
+		}
+	}
+	return uploaded, nil
+}
+
+// setImageVariants fills the urls of the image from its variants, the largest one is the image itself
+func setImageVariants(image *model.Image, variants []model.ImageVariant) {
+	largest := variants[len(variants)-1]
+	image.ImageURL = largest.URL
+	image.DeleteURL = largest.DeleteURL
+	image.ThumbURL = variants[0].URL
+	image.Width = largest.Width
+	image.Height = largest.Height
+	image.Variants = variants
+}
+
+// processSingleImage returns just one cleaned up copy of the image, for avatars and images inside articles
+func processSingleImage(data []byte, widths []int) ([]byte, error) {
+	variants, err := processImage(data, widths)
+	if err != nil {
+		return nil, err
+	}
+	return variants[len(variants)-1].Data, nil
+}
+
+// imageErrorKey returns the translation key that explains why an image was rejected
+func imageErrorKey(err error) string {
+	switch {
+	case errors.Is(err, ErrImageTooLarge):
+		return "upload_image_too_large_error"
+	case errors.Is(err, ErrImageTooManyPixels):
+		return "upload_image_too_many_pixels_error"
+	case errors.Is(err, ErrUnsupportedImage):
+		return "upload_image_unsupported_error"
+	case errors.Is(err, ErrGalleryFull):
+		return "upload_image_limit_error"
+	case errors.Is(err, ErrImportTooLarge):
+		return "upload_image_zip_too_large_error"
+	case errors.Is(err, ErrUnsupportedImport):
+		return "upload_image_zip_error"
+	}
+	return "upload_image_server_error"
+}
+
+// bulkImage is one image of a multi-file upload, zip files are expanded into the images they hold
+type bulkImage struct {
+	Name     string
+	Footer   string
+	Alt      string
+	Data     []byte
+	Variants []model.ImageVariant
+	Err      error
+}
+
+// collectBulkImages reads every uploaded file, the footer and alt are only used when a single image is sent
+func collectBulkImages(files []*multipart.FileHeader, footer, alt string) []bulkImage {
+	var images []bulkImage
+	for _, file := range files {
+		if strings.EqualFold(path.Ext(file.Filename), ".zip") {
+			if file.Size > importMaxUploadSize {
+				images = append(images, bulkImage{Name: file.Filename, Err: ErrImportTooLarge})
+				continue
+			}
+			data, err := convertFileToBytes(file)
+			if err != nil {
+				images = append(images, bulkImage{Name: file.Filename, Err: err})
+				continue
+			}
+			fromZip, err := imagesFromZip(data)
+			if err != nil {
+				images = append(images, bulkImage{Name: file.Filename, Err: err})
+				continue
+			}
+			images = append(images, fromZip...)
+			continue
+		}
+		if file.Size > ImageMaxUploadSize {
+			images = append(images, bulkImage{Name: file.Filename, Err: ErrImageTooLarge})
+			continue
+		}
+		data, err := convertFileToBytes(file)
+		images = append(images, bulkImage{Name: file.Filename, Data: data, Err: err})
+	}
+	if len(files) == 1 && len(images) == 1 {
+		images[0].Footer = footer
+		images[0].Alt = alt
+	}
+	return images
+}
+
+// imagesFromZip returns the images of the zip sorted by name. The footers come from a csv with
+// file, footer and an optional alt column when there is one, otherwise from the file names.
+func imagesFromZip(data []byte) ([]bulkImage, error) {
+	files, err := readImportZip(data)
+	if err != nil {
+		return nil, err
+	}
+	footers := make(map[string]string)
+	alts := make(map[string]string)
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		base := path.Base(name)
+		if strings.HasPrefix(base, ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		if strings.EqualFold(path.Ext(name), ".csv") {
+			records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+			if err != nil {
+				return nil, ErrUnsupportedImport
+			}
+			for _, record := range records {
+				if len(record) >= 2 {
+					footers[path.Clean(record[0])] = strings.TrimSpace(record[1])
+				}
+				if len(record) >= 3 {
+					alts[path.Clean(record[0])] = strings.TrimSpace(record[2])
+				}
+			}
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nameReplacer := strings.NewReplacer("-", " ", "_", " ")
+	images := make([]bulkImage, 0, len(names))
+	for _, name := range names {
+		image := bulkImage{Name: name, Data: files[name]}
+		if !strings.HasPrefix(http.DetectContentType(image.Data), "image/") {
+			image.Err = ErrUnsupportedImage
+		}
+		footer, ok := footers[name]
+		if !ok {
+			footer, ok = footers[path.Base(name)]
+		}
+		if alt, found := alts[name]; found {
+			image.Alt = alt
+		} else {
+			image.Alt = alts[path.Base(name)]
+		}
+		if !ok && len(footers) == 0 {
+			footer = strings.TrimSpace(nameReplacer.Replace(strings.TrimSuffix(path.Base(name), path.Ext(name))))
+		}
+		image.Footer = footer
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// uploadBulkImages processes and uploads the images that have no error yet, a few at a time
+func uploadBulkImages(images []bulkImage) {
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, ImageUploadWorkers)
+	for i := range images {
+		if images[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(image *bulkImage) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			image.Variants, image.Err = uploadImageVariants(image.Data)
+		}(&images[i])
+	}
+	wg.Wait()
+}
+
+func imageSrcset(variants []model.ImageVariant) string {
+	candidates := make([]string, len(variants))
+	for i, variant := range variants {
+		candidates[i] = variant.URL + " " + strconv.Itoa(variant.Width) + "w"
+	}
+	return strings.Join(candidates, ", ")
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+func resizeImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width >= bounds.Dx() {
+		return toRGBA(img)
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// gifFrameCount walks the blocks of a GIF counting its image descriptors, a malformed file counts as a single frame
+func gifFrameCount(data []byte) int {
+	if len(data) < 13 {
+		return 1
+	}
+	i := 13
+	//Global color table
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21:
+			//Extension: label and data sub-blocks
+			i += 2
+		case 0x2C:
+			if i+10 > len(data) {
+				return max(frames, 1)
+			}
+			frames++
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			//LZW minimum code size, the data sub-blocks follow
+			i++
+		default:
+			//Trailer, or something that is not a block
+			return max(frames, 1)
+		}
+		for i < len(data) && data[i] != 0 {
+			i += int(data[i]) + 1
+		}
+		i++
+	}
+	return max(frames, 1)
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment of a JPEG, 1 means it is already upright
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		//Start of scan, the metadata segments are over
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns the pixels so the image looks as the EXIF orientation describes
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	//Orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
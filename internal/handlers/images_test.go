@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodedPNG(t *testing.T, width, height int, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: alpha})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodedJPEG adds an EXIF segment holding only the orientation tag right after the start of image
+func encodedJPEG(t *testing.T, width, height int, orientation byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, 0, 0, 0, 0}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, 0, byte(len(segment) + 2)}, segment...)
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
+
+func encodedGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 40, 30), palette)
+		frame.SetColorIndex(i, i, 1)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessImage(t *testing.T) {
+	animated := encodedGIF(t, 3)
+	//Only the header of a GIF is read before the pixel check, so a 65535x65535 screen needs no pixels
+	hugeGIF := []byte{'G', 'I', 'F', '8', '9', 'a', 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0}
+	params := []struct {
+		name    string
+		data    []byte
+		widths  []int
+		sizes   [][2]int
+		formats []string
+		err     error
+	}{
+		{"opaque_png", encodedPNG(t, 800, 400, 255), []int{320, 640, 1280},
+			[][2]int{{320, 160}, {640, 320}, {800, 400}}, []string{"jpeg", "jpeg", "jpeg"}, nil},
+		{"transparent_png", encodedPNG(t, 100, 50, 128), []int{320, 640},
+			[][2]int{{100, 50}}, []string{"png"}, nil},
+		{"capped_width", encodedPNG(t, 800, 400, 255), []int{320},
+			[][2]int{{320, 160}, {320, 160}}, []string{"jpeg", "jpeg"}, nil},
+		{"jpeg_upright", encodedJPEG(t, 40, 20, 1), []int{640},
+			[][2]int{{40, 20}}, []string{"jpeg"}, nil},
+		{"jpeg_rotated", encodedJPEG(t, 40, 20, 6), []int{640},
+			[][2]int{{20, 40}}, []string{"jpeg"}, nil},
+		{"single_frame_gif", encodedGIF(t, 1), []int{640},
+			[][2]int{{40, 30}}, []string{"jpeg"}, nil},
+		{"animated_gif", animated, []int{320, 640},
+			[][2]int{{40, 30}}, []string{"gif"}, nil},
+		{"too_large", make([]byte, ImageMaxUploadSize+1), []int{640}, nil, nil, ErrImageTooLarge},
+		{"unsupported", []byte("<svg></svg>"), []int{640}, nil, nil, ErrUnsupportedImage},
+		{"too_many_pixels", hugeGIF, []int{640}, nil, nil, ErrImageTooManyPixels},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			variants, err := processImage(p.data, p.widths)
+			if err != p.err {
+				t.Fatalf("expected error %v, got %v", p.err, err)
+			}
+			if len(variants) != len(p.sizes) {
+				t.Fatalf("expected %d variants, got %d", len(p.sizes), len(variants))
+			}
+			for i, variant := range variants {
+				config, format, err := image.DecodeConfig(bytes.NewReader(variant.Data))
+				if err != nil {
+					t.Fatalf("variant %d does not decode: %v", i, err)
+				}
+				if variant.Width != p.sizes[i][0] || variant.Height != p.sizes[i][1] ||
+					config.Width != p.sizes[i][0] || config.Height != p.sizes[i][1] {
+					t.Errorf("variant %d: expected %v, got %dx%d encoded as %dx%d", i, p.sizes[i],
+						variant.Width, variant.Height, config.Width, config.Height)
+				}
+				if format != p.formats[i] {
+					t.Errorf("variant %d: expected format %s, got %s", i, p.formats[i], format)
+				}
+			}
+			if p.name == "animated_gif" && !bytes.Equal(variants[0].Data, animated) {
+				t.Error("expected the animated GIF to be kept as it was uploaded")
+			}
+		})
+	}
+}
+
+func TestGifFrameCount(t *testing.T) {
+	animated := encodedGIF(t, 4)
+	params := []struct {
+		name   string
+		data   []byte
+		frames int
+	}{
+		{"single", encodedGIF(t, 1), 1},
+		{"animated", animated, 4},
+		{"no_trailer", animated[:len(animated)-1], 4},
+		{"header_only", animated[:13], 1},
+		{"too_short", []byte("GIF89a"), 1},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			frames := gifFrameCount(p.data)
+			if frames != p.frames {
+				t.Errorf("expected %d frames, got %d", p.frames, frames)
+			}
+		})
+	}
+}
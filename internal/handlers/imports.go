@@ -0,0 +1,876 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	xhtml "golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportsDir holds the parsed imports until their owner confirms or discards them
+const ImportsDir = "./imports"
+
+const (
+	// importTTL is how long a parsed import waits to be confirmed before it is removed
+	importTTL             = 24 * time.Hour
+	importCleanupInterval = time.Hour
+)
+
+const (
+	importMaxUploadSize = 32 << 20
+	importMaxFileSize   = 10 << 20
+	importMaxTotalSize  = 100 << 20
+	importMaxEntries    = 1000
+	importMaxItems      = 200
+	galleryMaxImages    = 10
+)
+
+var (
+	ErrUnsupportedImport = errors.New("unsupported import format")
+	ErrImportTooLarge    = errors.New("import is too large")
+	ErrInvalidImport     = errors.New("invalid import name")
+)
+
+type ImportImage struct {
+	Footer string
+	Alt    string `json:",omitempty"`
+	Cover  bool   `json:",omitempty"`
+	Data   []byte `json:",omitempty"`
+	URL    string `json:",omitempty"`
+}
+
+// ImportItem is an article or a gallery read from an uploaded file.
+// Errors holds translation keys, items with errors are skipped when the import is confirmed.
+type ImportItem struct {
+	Source    string
+	Type      string
+	Title     string
+	Content   string
+	Tags      []string
+	Sections  []string
+	Published bool
+	// Visibility is only known for exports of this site, otherwise Published decides between draft and public
+	Visibility string
+	Images     []ImportImage
+	Errors     []string
+}
+
+func GetImportForm(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return GetImportFormPart(c)
+	}
+	return GetImportFormFull(c)
+}
+
+func GetImportFormFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"isActive":        user.Active,
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"page_to_load":    "/profile/mine/import?which=part",
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+func GetImportFormPart(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+	}
+	return c.Render(200, "import", data)
+}
+
+// PreviewImport parses the uploaded file and stages the result so the user can review it before anything is created
+func PreviewImport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	file, err := c.FormFile("archive")
+	if err != nil {
+		return renderImportError(c, "import_error_no_file")
+	}
+	if file.Size > importMaxUploadSize {
+		return renderImportError(c, "import_error_too_large")
+	}
+	fileBytes, err := convertFileToBytes(file)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	items, err := parseImport(file.Filename, fileBytes)
+	if errors.Is(err, ErrImportTooLarge) {
+		return renderImportError(c, "import_error_too_large")
+	}
+	if err != nil {
+		return renderImportError(c, "import_error_unsupported")
+	}
+	if len(items) == 0 {
+		return renderImportError(c, "import_error_empty")
+	}
+	valid := 0
+	for i := range items {
+		validateImportItem(&items[i], user.Username)
+		if len(items[i].Errors) == 0 {
+			valid++
+		}
+	}
+	name, err := stageImport(user.Username, items)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	data := map[string]any{
+		"locale": locale,
+		"name":   name,
+		"items":  convertImportItemsToDataMap(items, locale),
+		"total":  len(items),
+		"valid":  valid,
+	}
+	return c.Render(200, "import_preview", data)
+}
+
+func renderImportError(c echo.Context, key string) error {
+	locale := utils.GetLocale(c)
+	data := map[string]any{
+		"locale": locale,
+		"error":  utils.Translate(locale, key),
+	}
+	return c.Render(200, "import", data)
+}
+
+func convertImportItemsToDataMap(items []ImportItem, locale string) []map[string]any {
+	itemsMap := make([]map[string]any, len(items))
+	for i, item := range items {
+		errorMessages := make([]string, len(item.Errors))
+		for j, key := range item.Errors {
+			errorMessages[j] = utils.Translate(locale, key)
+		}
+		itemsMap[i] = map[string]any{
+			"source":    item.Source,
+			"type":      utils.Translate(locale, "import_type_"+item.Type),
+			"title":     item.Title,
+			"tags":      strings.Join(item.Tags, ", "),
+			"sections":  strings.Join(item.Sections, ", "),
+			"published": item.Published,
+			"images":    len(item.Images),
+			"isGallery": item.Type == "gallery",
+			"errors":    errorMessages,
+		}
+	}
+	return itemsMap
+}
+
+// ConfirmImport creates every staged item without errors and reports how each one went
+func ConfirmImport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	locale := utils.GetLocale(c)
+	name := c.Param("name")
+	items, err := readStagedImport(user.Username, name)
+	if err != nil {
+		return renderImportError(c, "import_error_expired")
+	}
+	removeStagedImport(user.Username, name)
+	results := make([]map[string]any, 0, len(items))
+	imported := 0
+	for _, item := range items {
+		result := map[string]any{
+			"source": item.Source,
+			"type":   utils.Translate(locale, "import_type_"+item.Type),
+			"title":  item.Title,
+		}
+		if len(item.Errors) > 0 {
+			result["error"] = utils.Translate(locale, "import_report_skipped")
+			results = append(results, result)
+			continue
+		}
+		err = commitImportItem(item, user)
+		if err != nil {
+			log.Errorf("Error importing %s for %s: %v", item.Source, user.Username, err)
+			result["error"] = utils.Translate(locale, "import_report_failed")
+		} else {
+			imported++
+		}
+		results = append(results, result)
+	}
+	data := map[string]any{
+		"locale":   locale,
+		"results":  results,
+		"imported": imported,
+		"total":    len(items),
+	}
+	return c.Render(200, "import_report", data)
+}
+
+func DiscardImport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	removeStagedImport(user.Username, c.Param("name"))
+	return GetImportFormPart(c)
+}
+
+// importPath only resolves names staged for username, usernames may contain underscores so the rest must be the timestamp
+func importPath(username, name string) (string, error) {
+	prefix := username + "_"
+	if name != filepath.Base(name) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".json") {
+		return "", ErrInvalidImport
+	}
+	if _, err := strconv.ParseInt(strings.TrimSuffix(name[len(prefix):], ".json"), 10, 64); err != nil {
+		return "", ErrInvalidImport
+	}
+	return filepath.Join(ImportsDir, name), nil
+}
+
+func stageImport(username string, items []ImportItem) (string, error) {
+	err := os.MkdirAll(ImportsDir, 0775)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s_%d.json", username, time.Now().UnixNano())
+	file, err := os.Create(filepath.Join(ImportsDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return name, json.NewEncoder(file).Encode(items)
+}
+
+func readStagedImport(username, name string) ([]ImportItem, error) {
+	path, err := importPath(username, name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(info.ModTime()) > importTTL {
+		return nil, os.ErrNotExist
+	}
+	var items []ImportItem
+	err = json.NewDecoder(file).Decode(&items)
+	return items, err
+}
+
+func removeStagedImport(username, name string) {
+	path, err := importPath(username, name)
+	if err != nil {
+		return
+	}
+	os.Remove(path)
+}
+
+// removeStagedImports deletes every pending import of a user
+func removeStagedImports(username string) {
+	matches, err := filepath.Glob(filepath.Join(ImportsDir, username+"_*.json"))
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if path, err := importPath(username, filepath.Base(match)); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+// removeExpiredImports deletes the staged imports nobody confirmed or discarded within importTTL
+func removeExpiredImports() {
+	entries, err := os.ReadDir(ImportsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Error reading staged imports: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) <= importTTL {
+			continue
+		}
+		err = os.Remove(filepath.Join(ImportsDir, entry.Name()))
+		if err != nil {
+			log.Errorf("Error removing expired import %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// StartImportCleanup removes the expired imports right away and then every importCleanupInterval
+func StartImportCleanup(stop <-chan struct{}) {
+	ticker := time.NewTicker(importCleanupInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			removeExpiredImports()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func validateImportItem(item *ImportItem, username string) {
+	item.Title = strings.TrimSpace(item.Title)
+	if item.Title == "" {
+		item.Errors = append(item.Errors, "import_error_title")
+	}
+	switch item.Type {
+	case "article":
+		if strings.TrimSpace(item.Content) == "" {
+			item.Errors = append(item.Errors, "import_error_content")
+		}
+	case "gallery":
+		if len(item.Images) == 0 {
+			item.Errors = append(item.Errors, "import_error_no_images")
+		}
+		if len(item.Images) > galleryMaxImages {
+			item.Errors = append(item.Errors, "import_error_too_many_images")
+		}
+	}
+	item.Tags = uniqueNonEmpty(item.Tags)
+	item.Sections = uniqueNonEmpty(item.Sections)
+	//Same rules as CreateNewSection
+	for _, section := range item.Sections {
+		if len(section) < 5 || section == username {
+			item.Errors = append(item.Errors, "import_error_section")
+			break
+		}
+	}
+}
+
+func uniqueNonEmpty(values []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
+
+func commitImportItem(item ImportItem, user model.User) error {
+	imported := database.ImportedPost{Cover: -1, Sections: item.Sections}
+	for _, tagName := range item.Tags {
+		if name := model.NormalizeTagName(tagName); name != "" {
+			imported.Tags = append(imported.Tags, name)
+		}
+	}
+	switch item.Type {
+	case "article":
+		processedHTML, err := processHTML(item.Content)
+		if err != nil {
+			return err
+		}
+		article := model.Article{Content: processedHTML}
+		article.Title = item.Title
+		article.Author = user.Username
+		article.Published = item.Published
+		if slices.Contains(model.VISIBILITIES, item.Visibility) {
+			article.SetVisibility(item.Visibility)
+		}
+		imported.Article = &article
+	case "gallery":
+		var gallery model.Gallery
+		gallery.Title = item.Title
+		gallery.Author = user.Username
+		gallery.Published = item.Published
+		if slices.Contains(model.VISIBILITIES, item.Visibility) {
+			gallery.SetVisibility(item.Visibility)
+		}
+		imported.Gallery = &gallery
+		//The files are uploaded first, the rows are only written once all of them are ready
+		for _, importImage := range item.Images {
+			image := model.Image{Owner: user.Username, Footer: importImage.Footer, Alt: importImage.Alt}
+			data := importImage.Data
+			if len(data) == 0 {
+				//Images missing from the archive are downloaded to be checked and stored like the uploaded ones
+				var err error
+				data, _, err = fetchImage(importImage.URL)
+				if err != nil {
+					return err
+				}
+			}
+			variants, err := uploadImageVariants(data)
+			if err != nil {
+				return err
+			}
+			setImageVariants(&image, variants)
+			if importImage.Cover {
+				imported.Cover = len(imported.Images)
+			}
+			imported.Images = append(imported.Images, image)
+		}
+	default:
+		return ErrUnsupportedImport
+	}
+	return database.ImportPost(&imported, user.Username)
+}
+
+// parseImport detects the format of the upload: a WordPress WXR file, an archive exported by this application
+// or an archive of markdown files with front matter
+func parseImport(name string, data []byte) ([]ImportItem, error) {
+	if strings.EqualFold(path.Ext(name), ".xml") {
+		return parseWXR(data)
+	}
+	files, err := readImportZip(data)
+	if err != nil {
+		return nil, err
+	}
+	var items []ImportItem
+	if manifest, ok := files["manifest.json"]; ok && isOwnExport(manifest) {
+		items, err = parseOwnExport(files)
+	} else {
+		items, err = parseMarkdownZip(files)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > importMaxItems {
+		return nil, ErrImportTooLarge
+	}
+	return items, nil
+}
+
+// readImportZip reads every file of the archive. Entries and decompressed bytes are capped, so a small archive
+// can not expand into more than importMaxTotalSize of memory.
+func readImportZip(data []byte) (map[string][]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnsupportedImport
+	}
+	if len(zipReader.File) > importMaxEntries {
+		return nil, ErrImportTooLarge
+	}
+	files := make(map[string][]byte, len(zipReader.File))
+	remaining := int64(importMaxTotalSize)
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.UncompressedSize64 > importMaxFileSize || f.UncompressedSize64 > uint64(remaining) {
+			return nil, ErrImportTooLarge
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		//The declared size can not be trusted, so the read is limited as well
+		limit := min(int64(importMaxFileSize), remaining)
+		content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) > limit {
+			return nil, ErrImportTooLarge
+		}
+		remaining -= int64(len(content))
+		files[path.Clean(strings.TrimPrefix(f.Name, "./"))] = content
+	}
+	return files, nil
+}
+
+func isOwnExport(manifest []byte) bool {
+	var m struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(manifest, &m) == nil && m.Format == exportFormat
+}
+
+func parseOwnExport(files map[string][]byte) ([]ImportItem, error) {
+	var articles []struct {
+		ID         uint64   `json:"id"`
+		Title      string   `json:"title"`
+		Tags       []string `json:"tags"`
+		Published  bool     `json:"published"`
+		Visibility string   `json:"visibility"`
+		HTML       string   `json:"html"`
+		Markdown   string   `json:"markdown"`
+	}
+	var galleries []struct {
+		ID         uint64   `json:"id"`
+		Title      string   `json:"title"`
+		Tags       []string `json:"tags"`
+		Published  bool     `json:"published"`
+		Visibility string   `json:"visibility"`
+		Images     []struct {
+			Footer string `json:"footer"`
+			Alt    string `json:"alt"`
+			Cover  bool   `json:"cover"`
+			URL    string `json:"url"`
+			File   string `json:"file"`
+		} `json:"images"`
+	}
+	var sections []struct {
+		Name  string `json:"name"`
+		Posts []struct {
+			Type string `json:"type"`
+			ID   uint64 `json:"id"`
+		} `json:"posts"`
+	}
+	for name, target := range map[string]any{"articles.json": &articles, "galleries.json": &galleries, "sections.json": &sections} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		err := json.Unmarshal(content, target)
+		if err != nil {
+			return nil, ErrUnsupportedImport
+		}
+	}
+	//The ids of the export are only used to put the posts back in their sections
+	sectionsOf := make(map[string][]string)
+	for _, section := range sections {
+		for _, post := range section.Posts {
+			key := fmt.Sprintf("%s/%d", post.Type, post.ID)
+			sectionsOf[key] = append(sectionsOf[key], section.Name)
+		}
+	}
+	var items []ImportItem
+	for _, article := range articles {
+		item := ImportItem{
+			Source:     article.HTML,
+			Type:       "article",
+			Title:      article.Title,
+			Tags:       article.Tags,
+			Published:  article.Published,
+			Visibility: article.Visibility,
+			Sections:   sectionsOf[fmt.Sprintf("article/%d", article.ID)],
+		}
+		if content, ok := files[article.HTML]; ok {
+			item.Content = exportedArticleBody(content)
+		} else if content, ok := files[article.Markdown]; ok {
+			item.Source = article.Markdown
+			item.Content = renderMarkdown(content)
+		}
+		items = append(items, item)
+	}
+	for _, gallery := range galleries {
+		item := ImportItem{
+			Source:     fmt.Sprintf("galleries/%d", gallery.ID),
+			Type:       "gallery",
+			Title:      gallery.Title,
+			Tags:       gallery.Tags,
+			Published:  gallery.Published,
+			Visibility: gallery.Visibility,
+			Sections:   sectionsOf[fmt.Sprintf("gallery/%d", gallery.ID)],
+		}
+		for _, image := range gallery.Images {
+			importImage := ImportImage{Footer: image.Footer, Alt: image.Alt, Cover: image.Cover, URL: image.URL}
+			if content, ok := files[image.File]; ok {
+				importImage.Data = content
+			}
+			item.Images = append(item.Images, importImage)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// exportedArticleBody returns the content of an article written by writeArticlesExport, without the title heading
+func exportedArticleBody(content []byte) string {
+	doc, err := xhtml.Parse(bytes.NewReader(content))
+	if err != nil {
+		return ""
+	}
+	body := findElement(doc, "body")
+	if body == nil {
+		return ""
+	}
+	var buf strings.Builder
+	skippedTitle := false
+	for child := body.FirstChild; child != nil; child = child.NextSibling {
+		if !skippedTitle && child.Type == xhtml.ElementNode && child.Data == "h1" {
+			skippedTitle = true
+			continue
+		}
+		buf.WriteString(htmlNodeToString(child))
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func findElement(n *xhtml.Node, tag string) *xhtml.Node {
+	if n.Type == xhtml.ElementNode && n.Data == tag {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+type frontMatter struct {
+	Title     string   `yaml:"title"`
+	Type      string   `yaml:"type"`
+	Tags      []string `yaml:"tags"`
+	Section   string   `yaml:"section"`
+	Sections  []string `yaml:"sections"`
+	Draft     bool     `yaml:"draft"`
+	Published *bool    `yaml:"published"`
+}
+
+func parseMarkdownZip(files map[string][]byte) ([]ImportItem, error) {
+	var names []string
+	for name := range files {
+		if strings.EqualFold(path.Ext(name), ".md") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrUnsupportedImport
+	}
+	sort.Strings(names)
+	items := make([]ImportItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, parseMarkdownFile(name, files))
+	}
+	return items, nil
+}
+
+func parseMarkdownFile(name string, files map[string][]byte) ImportItem {
+	item := ImportItem{Source: name, Type: "article"}
+	meta, body, err := splitFrontMatter(files[name])
+	if err != nil {
+		item.Errors = append(item.Errors, "import_error_front_matter")
+		return item
+	}
+	item.Title = meta.Title
+	if item.Title == "" {
+		item.Title, body = extractMarkdownTitle(body)
+	}
+	item.Tags = meta.Tags
+	item.Sections = meta.Sections
+	if meta.Section != "" {
+		item.Sections = append(item.Sections, meta.Section)
+	}
+	item.Published = !meta.Draft
+	if meta.Published != nil {
+		item.Published = *meta.Published
+	}
+	if meta.Type == "gallery" {
+		item.Type = "gallery"
+	}
+	doc, err := xhtml.Parse(strings.NewReader(renderMarkdown(body)))
+	if err != nil {
+		item.Errors = append(item.Errors, "import_error_content")
+		return item
+	}
+	//Images next to the markdown file are embedded so processHTML uploads them like the editor ones
+	missingImage := false
+	var images []ImportImage
+	walkElements(doc, "img", func(n *xhtml.Node) {
+		src := attributeOf(n, "src")
+		image := ImportImage{Footer: attributeOf(n, "alt"), Alt: attributeOf(n, "alt")}
+		if isRemoteURL(src) {
+			image.URL = src
+		} else {
+			content, ok := files[path.Join(path.Dir(name), src)]
+			if !ok || !strings.HasPrefix(http.DetectContentType(content), "image/") {
+				missingImage = true
+				return
+			}
+			image.Data = content
+			setAttribute(n, "src", "data:"+http.DetectContentType(content)+";base64,"+base64.StdEncoding.EncodeToString(content))
+		}
+		images = append(images, image)
+	})
+	if missingImage {
+		item.Errors = append(item.Errors, "import_error_missing_image")
+	}
+	if item.Type == "gallery" {
+		item.Images = images
+		return item
+	}
+	item.Content = htmlNodeToString(doc)
+	return item
+}
+
+func splitFrontMatter(content []byte) (frontMatter, []byte, error) {
+	var meta frontMatter
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	normalized := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(normalized, []byte("---\n")) {
+		return meta, content, nil
+	}
+	rest := normalized[4:]
+	end := bytes.Index(rest, []byte("\n---"))
+	if end < 0 {
+		return meta, content, nil
+	}
+	err := yaml.Unmarshal(rest[:end], &meta)
+	if err != nil {
+		return meta, nil, err
+	}
+	body := rest[end+4:]
+	if i := bytes.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = nil
+	}
+	return meta, body, nil
+}
+
+// extractMarkdownTitle uses the first level one heading as title when the front matter has none
+func extractMarkdownTitle(body []byte) (string, []byte) {
+	lines := strings.Split(string(body), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "# ") {
+			remaining := append(lines[:i:i], lines[i+1:]...)
+			return strings.TrimSpace(trimmed[2:]), []byte(strings.Join(remaining, "\n"))
+		}
+		break
+	}
+	return "", body
+}
+
+func isRemoteURL(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+func walkElements(n *xhtml.Node, tag string, fn func(*xhtml.Node)) {
+	if n.Type == xhtml.ElementNode && n.Data == tag {
+		fn(n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkElements(child, tag, fn)
+	}
+}
+
+func setAttribute(n *xhtml.Node, key, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: key, Val: value})
+}
+
+type wxrItem struct {
+	Title      string `xml:"title"`
+	Link       string `xml:"link"`
+	Content    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Status     string `xml:"status"`
+	PostType   string `xml:"post_type"`
+	Categories []struct {
+		Domain   string `xml:"domain,attr"`
+		Nicename string `xml:"nicename,attr"`
+		Name     string `xml:",chardata"`
+	} `xml:"category"`
+}
+
+// parseWXR reads the posts and pages of a WordPress export, attachments and menus are ignored
+func parseWXR(data []byte) ([]ImportItem, error) {
+	var wxr struct {
+		Channel struct {
+			Items []wxrItem `xml:"item"`
+		} `xml:"channel"`
+	}
+	err := xml.Unmarshal(data, &wxr)
+	if err != nil {
+		return nil, ErrUnsupportedImport
+	}
+	var items []ImportItem
+	for i, wxrItem := range wxr.Channel.Items {
+		if wxrItem.PostType != "post" && wxrItem.PostType != "page" {
+			continue
+		}
+		if wxrItem.Status == "trash" || wxrItem.Status == "auto-draft" || wxrItem.Status == "inherit" {
+			continue
+		}
+		item := ImportItem{
+			Source:    fmt.Sprintf("item %d", i+1),
+			Type:      "article",
+			Title:     wxrItem.Title,
+			Content:   wordpressAutoParagraph(wxrItem.Content),
+			Published: wxrItem.Status == "publish",
+		}
+		if wxrItem.Link != "" {
+			item.Source = wxrItem.Link
+		}
+		for _, category := range wxrItem.Categories {
+			switch category.Domain {
+			case "post_tag":
+				item.Tags = append(item.Tags, category.Name)
+			case "category":
+				if category.Nicename != "uncategorized" {
+					item.Sections = append(item.Sections, category.Name)
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	if len(items) > importMaxItems {
+		return nil, ErrImportTooLarge
+	}
+	return items, nil
+}
+
+// wordpressAutoParagraph wraps the blank line separated blocks in paragraphs, as WordPress does when rendering
+func wordpressAutoParagraph(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if strings.Contains(content, "<p") {
+		return content
+	}
+	var buf strings.Builder
+	for _, block := range strings.Split(content, "\n\n") {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		buf.WriteString("<p>" + block + "</p>\n")
+	}
+	return buf.String()
+}
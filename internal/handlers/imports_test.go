@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+)
+
+type zipEntry struct {
+	name    string
+	content []byte
+}
+
+func zipOf(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		f, err := w.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(entry.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadImportZip(t *testing.T) {
+	manyEntries := make([]zipEntry, importMaxEntries+1)
+	for i := range manyEntries {
+		manyEntries[i] = zipEntry{fmt.Sprintf("post-%d.md", i), []byte("# Post")}
+	}
+	//Zeros compress to almost nothing, so these archives are small but expand over the limits
+	overTotal := make([]zipEntry, importMaxTotalSize/importMaxFileSize+1)
+	for i := range overTotal {
+		overTotal[i] = zipEntry{fmt.Sprintf("big-%d.md", i), make([]byte, importMaxFileSize)}
+	}
+	params := []struct {
+		name  string
+		data  []byte
+		files []string
+		err   error
+	}{
+		{"not_a_zip", []byte("plain text"), nil, ErrUnsupportedImport},
+		{"files", zipOf(t, zipEntry{"post.md", []byte("# Post")}, zipEntry{"images/a.png", []byte("png")}),
+			[]string{"images/a.png", "post.md"}, nil},
+		{"dirs_and_dot_prefix", zipOf(t, zipEntry{"posts/", nil}, zipEntry{"./posts/post.md", []byte("# Post")}),
+			[]string{"posts/post.md"}, nil},
+		{"too_many_entries", zipOf(t, manyEntries...), nil, ErrImportTooLarge},
+		{"file_too_large", zipOf(t, zipEntry{"big.md", make([]byte, importMaxFileSize+1)}), nil, ErrImportTooLarge},
+		{"total_too_large", zipOf(t, overTotal...), nil, ErrImportTooLarge},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			files, err := readImportZip(p.data)
+			if err != p.err {
+				t.Fatalf("expected error %v, got %v", p.err, err)
+			}
+			var names []string
+			for name := range files {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, p.files) {
+				t.Errorf("expected files %v, got %v", p.files, names)
+			}
+		})
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	frontMatter := "---\ntitle: With front matter\ntags: [go, web]\nsection: Notes\ndraft: true\n---\nSome **text**\n"
+	ownExport := zipOf(t,
+		zipEntry{"manifest.json", []byte(`{"format": "portfol.io", "version": 1}`)},
+		zipEntry{"articles.json", []byte(`[{"id": 3, "title": "Exported", "tags": ["go"], "published": true, "visibility": "unlisted", "html": "articles/3.html"}]`)},
+		zipEntry{"articles/3.html", []byte("<html><body><h1>Exported</h1><p>Body</p></body></html>")},
+		zipEntry{"sections.json", []byte(`[{"name": "Work", "posts": [{"type": "article", "id": 3}]}]`)},
+	)
+	wxr := `<?xml version="1.0"?>
+<rss xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+<item><title>Hello</title><link>https://blog.example/hello</link><content:encoded>First
+
+Second</content:encoded><wp:status>publish</wp:status><wp:post_type>post</wp:post_type>
+<category domain="post_tag" nicename="go">go</category><category domain="category" nicename="uncategorized">Uncategorized</category></item>
+<item><title>Deleted</title><wp:status>trash</wp:status><wp:post_type>post</wp:post_type></item>
+<item><title>logo.png</title><wp:status>inherit</wp:status><wp:post_type>attachment</wp:post_type></item>
+</channel>
+</rss>`
+	params := []struct {
+		name     string
+		file     string
+		data     []byte
+		expected []ImportItem
+		err      error
+	}{
+		{"front_matter", "posts.zip", zipOf(t, zipEntry{"post.md", []byte(frontMatter)}), []ImportItem{{
+			Source: "post.md", Type: "article", Title: "With front matter", Content: "<p>Some <strong>text</strong></p>",
+			Tags: []string{"go", "web"}, Sections: []string{"Notes"},
+		}}, nil},
+		{"heading_title", "posts.zip", zipOf(t, zipEntry{"post.md", []byte("# From heading\n\nBody\n")}), []ImportItem{{
+			Source: "post.md", Type: "article", Title: "From heading", Content: "<p>Body</p>", Published: true,
+		}}, nil},
+		{"missing_image", "posts.zip", zipOf(t, zipEntry{"post.md", []byte("# Post\n\n![alt](missing.png)\n")}), []ImportItem{{
+			Source: "post.md", Type: "article", Title: "Post", Content: `<p><img src="missing.png" alt="alt"/></p>`, Published: true,
+			Errors: []string{"import_error_missing_image"},
+		}}, nil},
+		{"own_export", "export.zip", ownExport, []ImportItem{{
+			Source: "articles/3.html", Type: "article", Title: "Exported", Content: "<p>Body</p>", Tags: []string{"go"},
+			Sections: []string{"Work"}, Published: true, Visibility: "unlisted",
+		}}, nil},
+		{"wxr", "blog.xml", []byte(wxr), []ImportItem{{
+			Source: "https://blog.example/hello", Type: "article", Title: "Hello", Content: "<p>First</p>\n<p>Second</p>\n",
+			Tags: []string{"go"}, Published: true,
+		}}, nil},
+		{"no_markdown", "images.zip", zipOf(t, zipEntry{"a.png", []byte("png")}), nil, ErrUnsupportedImport},
+		{"broken_wxr", "blog.xml", []byte("<rss><channel>"), nil, ErrUnsupportedImport},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			items, err := parseImport(p.file, p.data)
+			if err != p.err {
+				t.Fatalf("expected error %v, got %v", p.err, err)
+			}
+			if len(items) != len(p.expected) {
+				t.Fatalf("expected %d items, got %d: %+v", len(p.expected), len(items), items)
+			}
+			for i, item := range items {
+				expected := p.expected[i]
+				//Markdown renders as a whole document that processHTML trims on import, only the body matters here
+				if item.Source != expected.Source || item.Type != expected.Type || item.Title != expected.Title ||
+					!strings.Contains(item.Content, expected.Content) || item.Published != expected.Published ||
+					item.Visibility != expected.Visibility {
+					t.Errorf("expected %+v, got %+v", expected, item)
+				}
+				if !slices.Equal(item.Tags, expected.Tags) || !slices.Equal(item.Sections, expected.Sections) ||
+					!slices.Equal(item.Errors, expected.Errors) {
+					t.Errorf("expected tags %v, sections %v and errors %v, got %v, %v and %v",
+						expected.Tags, expected.Sections, expected.Errors, item.Tags, item.Sections, item.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitImportItemImages(t *testing.T) {
+	params := []struct {
+		name  string
+		image ImportImage
+		err   error
+	}{
+		{"remote_other_host", ImportImage{URL: "https://example.com/a.png"}, errImageHostNotAllowed},
+		{"remote_private", ImportImage{URL: "http://127.0.0.1/a.png"}, errImageHostNotAllowed},
+		{"no_image", ImportImage{}, errImageHostNotAllowed},
+		{"not_an_image", ImportImage{Data: []byte("<svg></svg>")}, ErrUnsupportedImage},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			item := ImportItem{Type: "gallery", Title: "Gallery", Images: []ImportImage{p.image}}
+			err := commitImportItem(item, model.User{Username: "importer"})
+			if !errors.Is(err, p.err) {
+				t.Errorf("expected error %v, got %v", p.err, err)
+			}
+		})
+	}
+}
+
+func TestRemoveExpiredImports(t *testing.T) {
+	//ImportsDir is relative, the test works in a directory of its own
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+	expired, err := stageImport("importer", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := stageImport("importer", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-importTTL - time.Minute)
+	if err := os.Chtimes(filepath.Join(ImportsDir, expired), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readStagedImport("importer", expired); err == nil {
+		t.Error("expected the expired import to be unreadable")
+	}
+	removeExpiredImports()
+
+	if _, err := os.Stat(filepath.Join(ImportsDir, expired)); !os.IsNotExist(err) {
+		t.Errorf("expected the expired import to be removed, got %v", err)
+	}
+	if _, err := readStagedImport("importer", recent); err != nil {
+		t.Errorf("expected the recent import to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// testDBErr tells why the tests that need a database are skipped
+var testDBErr error
+
+func TestMain(m *testing.M) {
+	//libsql writes UTC times ending in Z and only reads them back with a numeric offset
+	time.Local = time.FixedZone("test", 2*60*60)
+	dir, err := os.MkdirTemp("", "portfolio-handlers-*")
+	if err == nil {
+		err = database.OpenLocal(filepath.Join(dir, "test.db"))
+	}
+	if err != nil {
+		log.Println("the tests that need a database will be skipped: ", err)
+		testDBErr = err
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// rollbackDB points the database to a transaction of the test database that is rolled back when the test ends
+func rollbackDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	if testDBErr != nil {
+		t.Skip("no test database: ", testDBErr)
+	}
+	previous := database.DB
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	database.DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		database.DB = previous
+	})
+	return tx
+}
+
+// createUsers stores the users with their follow lists, the rows that posts and follows point to
+func createUsers(t *testing.T, tx *gorm.DB, usernames ...string) {
+	t.Helper()
+	for _, username := range usernames {
+		user := model.User{Username: username, FollowList: model.FollowList{Owner: username}}
+		if err := tx.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// The TXT record that proves a domain is owned, it is looked up at domainRecordPrefix + domain
+const (
+	domainRecordPrefix = "_portfolio."
+	domainRecordValue  = "portfolio-verification="
+)
+
+// lookupTXT is replaced in tests, so the verification does not depend on real DNS records
+var lookupTXT = net.LookupTXT
+
+// hostnameOf drops the port of a host header or url host
+func hostnameOf(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// mainHostname is the host of BASE_URL, empty when it is not set
+func mainHostname() string {
+	parsed, err := url.Parse(utils.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return hostnameOf(parsed.Host)
+}
+
+// normalizeDomain accepts a bare domain or an url and returns the domain, empty when it is not valid
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if strings.Contains(domain, "://") {
+		parsed, err := url.Parse(domain)
+		if err != nil {
+			return ""
+		}
+		domain = parsed.Host
+	}
+	domain = hostnameOf(strings.TrimSuffix(domain, "/"))
+	if len(domain) > model.PORTFOLIO_DOMAIN_MAX_LEN || !domainRegex.MatchString(domain) {
+		return ""
+	}
+	return domain
+}
+
+// PortfolioDomainMiddleware serves the portfolio of a user at the root of the custom domain they configured
+func PortfolioDomainMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if req.Method != "GET" || req.URL.Path != "/" {
+			return next(c)
+		}
+		host := hostnameOf(req.Host)
+		if host == "" || host == mainHostname() {
+			return next(c)
+		}
+		portfolio, err := database.FindPortfolioByDomain(host)
+		if err != nil {
+			return next(c)
+		}
+		user, err := database.FindUserByUsername(portfolio.Owner)
+		if err != nil || !user.Active {
+			return next(c)
+		}
+		return renderPortfolio(c, user, portfolio)
+	}
+}
+
+func GetPortfolio(c echo.Context) error {
+	user, err := database.FindUserByUsername(c.Param("username"))
+	if err != nil || !user.Active {
+		return c.String(404, "Not Found")
+	}
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPortfolio(c, user, portfolio)
+}
+
+// renderPortfolio shows the featured posts first and then the latest ones of each section in the order chosen by the user
+func renderPortfolio(c echo.Context, user model.User, portfolio model.Portfolio) error {
+	locale := utils.GetLocale(c)
+	data, err := portfolioData(user, portfolio, locale)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	data["static_url"] = "/static"
+	data["feed_url"] = "/profile/" + user.Username + "/feed"
+	data["home_url"] = siteURL(c)
+	data["meta"] = pageMeta(c, "profile", displayName(user), portfolioDescription(user, portfolio, locale),
+		"/u/"+user.Username, user.Profile.PfPUrl)
+	return c.Render(200, "portfolio", data)
+}
+
+// portfolioData is shared by the live portfolio and the static site export, links are left as in the live site
+func portfolioData(user model.User, portfolio model.Portfolio, locale string) (map[string]any, error) {
+	featured, err := database.FindFeaturedPosts(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	sections_db, err := database.FindSectionsByUser(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	var sections []map[string]any
+	for _, section := range sections_db {
+		if !section.IsListed() {
+			continue
+		}
+		posts, err := database.FindPostsByUserAndSectionPaginated("", user.Username, section.Name, 1, model.PORTFOLIO_SECTION_POSTS)
+		if err != nil {
+			return nil, err
+		}
+		if len(posts) == 0 {
+			continue
+		}
+		sections = append(sections, map[string]any{
+			"name":  section.Name,
+			"posts": convertPostsToDataMap(posts),
+		})
+	}
+	latest, err := database.FindPostsByUserPaginated("", user.Username, 1, model.PORTFOLIO_SECTION_POSTS)
+	if err != nil {
+		return nil, err
+	}
+	theme := portfolio.Theme
+	if !slices.Contains(model.THEMES, theme) {
+		theme = model.THEME_CLASSIC
+	}
+	data := map[string]any{
+		"app_title": "Portfol.io",
+		"locale":    locale,
+		"username":  user.Username,
+		"name":      displayName(user),
+		"avatar":    user.Profile.PfPUrl,
+		"bio":       user.Profile.Bio,
+		"headline":  portfolio.Headline,
+		"about":     template.HTML(portfolio.About), //skipcq  GSC-G203
+		"theme":     theme,
+		"featured":  convertPostsToDataMap(featured),
+		"sections":  sections,
+		"latest":    convertPostsToDataMap(latest),
+	}
+	return data, nil
+}
+
+func portfolioDescription(user model.User, portfolio model.Portfolio, locale string) string {
+	description := portfolio.Headline
+	if description == "" {
+		description = user.Profile.Bio
+	}
+	if description == "" {
+		description = fmt.Sprintf(utils.Translate(locale, "seo_profile_description"), displayName(user))
+	}
+	return shortenText(description, metaDescriptionLength)
+}
+
+func GetPortfolioSettings(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return GetPortfolioSettingsPart(c)
+	}
+	return GetPortfolioSettingsFull(c)
+}
+
+func GetPortfolioSettingsFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"isActive":        user.Active,
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"page_to_load":    "/profile/mine/portfolio?which=part",
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+func GetPortfolioSettingsPart(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPortfolioSettings(c, user, portfolio, nil, false)
+}
+
+func renderPortfolioSettings(c echo.Context, user model.User, portfolio model.Portfolio, form_errors map[string]string, saved bool) error {
+	locale := utils.GetLocale(c)
+	featured, err := featuredCandidates(user.Username, locale)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	sections, err := sectionNames(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	themes := make([]map[string]any, len(model.THEMES))
+	for i, theme := range model.THEMES {
+		themes[i] = map[string]any{
+			"name":     theme,
+			"label":    "portfolio_theme_" + theme,
+			"selected": theme == portfolio.Theme || (portfolio.Theme == "" && theme == model.THEME_CLASSIC),
+		}
+	}
+	data := map[string]any{
+		"locale":       locale,
+		"username":     user.Username,
+		"themes":       themes,
+		"headline":     portfolio.Headline,
+		"about":        portfolio.AboutSource,
+		"domain":       portfolio.Domain,
+		"verified":     portfolio.DomainVerified,
+		"recordName":   domainRecordPrefix + portfolio.Domain,
+		"recordValue":  domainRecordValue + portfolio.DomainToken,
+		"errors":       form_errors,
+		"saved":        saved,
+		"posts":        featured,
+		"sections":     sections,
+		"featured_max": model.FEATURED_POSTS_MAX,
+	}
+	return c.Render(200, "portfolio_settings", data)
+}
+
+// featuredCandidates lists the public posts of the user, marking the ones that are pinned
+func featuredCandidates(username, locale string) ([]map[string]any, error) {
+	ids, err := database.FindFeaturedPostIDs(username)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []map[string]any
+	for page := 1; ; page++ {
+		posts, err := database.FindPostsByUserPaginated("", username, page, 50)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			candidates = append(candidates, map[string]any{
+				"post_id":   post.ID,
+				"title":     post.Title,
+				"post_type": post.OwnerType,
+				"featured":  slices.Contains(ids, post.ID),
+				"locale":    locale,
+			})
+		}
+		if len(posts) < 50 {
+			return candidates, nil
+		}
+	}
+}
+
+func sectionNames(username string) ([]string, error) {
+	sections, err := database.FindSectionsByUser(username)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sections))
+	for i, section := range sections {
+		names[i] = section.Name
+	}
+	return names, nil
+}
+
+func SavePortfolioSettings(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	if !user.Active {
+		return c.String(403, "Forbidden")
+	}
+	locale := utils.GetLocale(c)
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	form_errors := map[string]string{}
+	theme := c.FormValue("theme")
+	if !slices.Contains(model.THEMES, theme) {
+		theme = model.THEME_CLASSIC
+	}
+	headline := strings.TrimSpace(c.FormValue("headline"))
+	if utf8.RuneCountInString(headline) > model.PORTFOLIO_HEADLINE_MAX {
+		form_errors["headline"] = utils.Translate(locale, "portfolio_settings_headline_too_long")
+	}
+	about := strings.TrimSpace(c.FormValue("about"))
+	if utf8.RuneCountInString(about) > model.PORTFOLIO_ABOUT_MAX {
+		form_errors["about"] = utils.Translate(locale, "portfolio_settings_about_too_long")
+	}
+	domain := ""
+	if raw := strings.TrimSpace(c.FormValue("domain")); raw != "" {
+		domain = normalizeDomain(raw)
+		switch {
+		case domain == "":
+			form_errors["domain"] = utils.Translate(locale, "portfolio_settings_domain_invalid")
+		case domain == mainHostname() || domain == hostnameOf(c.Request().Host):
+			form_errors["domain"] = utils.Translate(locale, "portfolio_settings_domain_taken")
+		}
+	}
+	portfolio.Theme = theme
+	portfolio.Headline = headline
+	portfolio.AboutSource = about
+	//A new domain has to be verified again, with a new token. Domains saved before verification existed get one too.
+	if domain != portfolio.Domain || (domain != "" && portfolio.DomainToken == "") {
+		portfolio.Domain = domain
+		portfolio.DomainVerified = false
+		portfolio.DomainToken = ""
+		if domain != "" {
+			portfolio.DomainToken, err = newDomainToken()
+			if err != nil {
+				return c.String(500, "Internal Server Error")
+			}
+		}
+	}
+	if len(form_errors) > 0 {
+		return renderPortfolioSettings(c, user, portfolio, form_errors, false)
+	}
+	portfolio.About = sanitizeHTML(renderMarkdown([]byte(about)))
+	err = database.SavePortfolio(&portfolio)
+	if errors.Is(err, database.ErrDomainTaken) {
+		form_errors["domain"] = utils.Translate(locale, "portfolio_settings_domain_taken")
+		return renderPortfolioSettings(c, user, portfolio, form_errors, false)
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPortfolioSettings(c, user, portfolio, nil, true)
+}
+
+func newDomainToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	return hex.EncodeToString(token), err
+}
+
+// domainRecordFound tells if the DNS of the domain has the TXT record with the token of the portfolio
+func domainRecordFound(portfolio model.Portfolio) bool {
+	records, err := lookupTXT(domainRecordPrefix + portfolio.Domain)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(records, domainRecordValue+portfolio.DomainToken)
+}
+
+// VerifyPortfolioDomain checks the TXT record of the domain, the portfolio is only served there once it is verified
+func VerifyPortfolioDomain(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	if !user.Active {
+		return c.String(403, "Forbidden")
+	}
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if portfolio.Domain == "" || portfolio.DomainToken == "" {
+		return c.String(400, "Bad Request")
+	}
+	if portfolio.DomainVerified {
+		return renderPortfolioSettings(c, user, portfolio, nil, false)
+	}
+	locale := utils.GetLocale(c)
+	if !domainRecordFound(portfolio) {
+		return renderPortfolioSettings(c, user, portfolio, map[string]string{"domain": utils.Translate(locale, "portfolio_settings_domain_not_verified")}, false)
+	}
+	err = database.VerifyPortfolioDomain(&portfolio)
+	if errors.Is(err, database.ErrDomainTaken) {
+		return renderPortfolioSettings(c, user, portfolio, map[string]string{"domain": utils.Translate(locale, "portfolio_settings_domain_taken")}, false)
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPortfolioSettings(c, user, portfolio, nil, false)
+}
+
+func ToggleFeaturedPost(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	post, err := database.FindPostById(id)
+	if err != nil || !wrotePost(user.Username, post) || !post.IsPublic() {
+		return c.String(404, "Not Found")
+	}
+	locale := utils.GetLocale(c)
+	data := map[string]any{
+		"locale":    locale,
+		"post_id":   post.ID,
+		"title":     post.Title,
+		"post_type": post.OwnerType,
+	}
+	featured, err := database.ToggleFeaturedPost(user.Username, post.ID)
+	if errors.Is(err, database.ErrTooManyFeaturedPosts) {
+		data["error"] = fmt.Sprintf(utils.Translate(locale, "portfolio_settings_featured_too_many"), model.FEATURED_POSTS_MAX)
+		return c.Render(200, "portfolio_featured_post", data)
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	data["featured"] = featured
+	return c.Render(200, "portfolio_featured_post", data)
+}
+
+func MovePortfolioSection(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	offset, err := strconv.Atoi(c.FormValue("offset"))
+	if err != nil || (offset != -1 && offset != 1) {
+		return c.String(400, "Bad Request")
+	}
+	err = database.MoveSection(user.Username, c.FormValue("section"), offset)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	sections, err := sectionNames(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	data := map[string]any{
+		"locale":   utils.GetLocale(c),
+		"sections": sections,
+	}
+	return c.Render(200, "portfolio_sections", data)
+}
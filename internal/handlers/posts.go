@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"net/url"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
 	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
 	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 )
 
 func GetPostsPaginated(c echo.Context) error {
@@ -19,7 +25,7 @@ func GetPostsPaginated(c echo.Context) error {
 	if err != nil {
 		return c.String(400, "Bad Request")
 	}
-	posts, err := database.FindPostsPaginated(page, 12)
+	posts, err := database.FindPostsPaginated(viewerOf(c), page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -41,6 +47,22 @@ func GetPostsPaginated(c echo.Context) error {
 
 func convertPostsToDataMap(posts []model.Post) []map[string]interface{} {
 	posts_content := make([]map[string]interface{}, len(posts))
+	postIDs := make([]uint64, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+	}
+	reactions, err := database.CountReactionsOfPosts(postIDs)
+	if err != nil {
+		log.Error(err)
+	}
+	tagVotes, err := database.CountTagVotesOfPosts(postIDs)
+	if err != nil {
+		log.Error(err)
+	}
+	coAuthors, err := database.FindCoAuthorNamesOfPosts(postIDs)
+	if err != nil {
+		log.Error(err)
+	}
 	for i := range posts {
 		switch posts[i].OwnerType {
 		case "article":
@@ -49,14 +71,16 @@ func convertPostsToDataMap(posts []model.Post) []map[string]interface{} {
 				continue
 			}
 			posts_content[i] = map[string]any{
-				"id":        article.ID,
-				"title":     article.Title,
-				"author":    article.Author,
-				"createdAt": article.CreatedAt,
-				"updatedAt": article.UpdatedAt,
-				"post_type": "article",
-				"post_id":   posts[i].ID,
-				"published": article.Published,
+				"id":         article.ID,
+				"path":       postPath("article", article.ID, article.Slug),
+				"title":      article.Title,
+				"author":     article.Author,
+				"createdAt":  article.CreatedAt,
+				"updatedAt":  article.UpdatedAt,
+				"post_type":  "article",
+				"post_id":    posts[i].ID,
+				"published":  article.Published,
+				"visibility": article.Visibility,
 			}
 		case "project":
 			project, err := database.FindProjectByID(posts[i].OwnerID)
@@ -64,14 +88,15 @@ func convertPostsToDataMap(posts []model.Post) []map[string]interface{} {
 				continue
 			}
 			posts_content[i] = map[string]any{
-				"id":        project.ID,
-				"title":     project.Title,
-				"author":    project.Author,
-				"createdAt": project.CreatedAt,
-				"updatedAt": project.UpdatedAt,
-				"post_type": "project",
-				"post_id":   posts[i].ID,
-				"published": project.Published,
+				"id":         project.ID,
+				"title":      project.Title,
+				"author":     project.Author,
+				"createdAt":  project.CreatedAt,
+				"updatedAt":  project.UpdatedAt,
+				"post_type":  "project",
+				"post_id":    posts[i].ID,
+				"published":  project.Published,
+				"visibility": project.Visibility,
 			}
 		case "gallery":
 			gallery, err := database.FindGalleryByID(posts[i].OwnerID)
@@ -80,22 +105,29 @@ func convertPostsToDataMap(posts []model.Post) []map[string]interface{} {
 			}
 			num_images := len(gallery.Images)
 			url := ""
-			if num_images > 0 {
-				url = gallery.Images[0].ThumbURL
+			if cover, ok := gallery.Cover(); ok {
+				url = cover.ThumbURL
 			}
 			posts_content[i] = map[string]any{
-				"id":        gallery.ID,
-				"title":     gallery.Title,
-				"author":    gallery.Author,
-				"createdAt": gallery.CreatedAt,
-				"updatedAt": gallery.UpdatedAt,
-				"post_type": "gallery",
-				"url":       url,
-				"amount":    num_images,
-				"post_id":   posts[i].ID,
-				"published": gallery.Published,
+				"id":         gallery.ID,
+				"path":       postPath("gallery", gallery.ID, gallery.Slug),
+				"title":      gallery.Title,
+				"author":     gallery.Author,
+				"createdAt":  gallery.CreatedAt,
+				"updatedAt":  gallery.UpdatedAt,
+				"post_type":  "gallery",
+				"url":        url,
+				"amount":     num_images,
+				"post_id":    posts[i].ID,
+				"published":  gallery.Published,
+				"visibility": gallery.Visibility,
 			}
 		}
+		if posts_content[i] != nil {
+			posts_content[i]["reactions"] = convertReactionCountsToDataMap(reactions[posts[i].ID])
+			posts_content[i]["tags"] = convertTagVotesToDataMap(tagVotes[posts[i].ID], 3)
+			posts_content[i]["coauthors"] = coAuthors[posts[i].ID]
+		}
 	}
 	return posts_content
 }
@@ -103,7 +135,11 @@ func convertPostsToDataMap(posts []model.Post) []map[string]interface{} {
 // Mostly about articles
 func CreateArticleFormPart(c echo.Context) error {
 	data := map[string]any{
-		"locale": utils.GetLocale(c),
+		"locale":       utils.GetLocale(c),
+		"visibilities": visibilityOptions("", false),
+	}
+	if user, err := GetUserOfSession(c); err == nil {
+		withArticleAutosave(c, data, 0, user.Username)
 	}
 	return c.Render(200, "article_form", data)
 }
@@ -120,6 +156,10 @@ func CreateArticleFormFull(c echo.Context) error {
 		"IsModerator":     isModerator,
 		"IsAdmin":         isAdmin,
 		"app_title":       "Portfol.io",
+		"visibilities":    visibilityOptions("", false),
+	}
+	if isAuthenticated {
+		withArticleAutosave(c, data, 0, user.Username)
 	}
 	return c.Render(200, "article_form_full", data)
 }
@@ -136,25 +176,29 @@ func CreateArticle(c echo.Context) error {
 	var article model.Article
 	title, text := c.FormValue("title"), c.FormValue("text")
 	data := map[string]any{
-		"locale": utils.GetLocale(c),
-		"title":  title,
-		"text":   text,
+		"locale":       utils.GetLocale(c),
+		"title":        title,
+		"text":         text,
+		"visibilities": visibilityOptions(c.FormValue("visibility"), false),
 	}
 	user, err := GetUserOfSession(c)
 	if err != nil || !user.Active {
 		return c.Render(200, "article_form", data)
 	}
-	processedHTML, err := processHTML(text)
+	format, source, processedHTML, err := processArticleForm(c)
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
 	article.Title = title
 	article.Content = processedHTML
+	article.Format = format
+	article.Source = source
 	article.Author = user.Username
 	err = database.CreateArticle(&article)
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
+	database.DeleteArticleAutosave(0, user.Username)
 	return c.Render(200, "success", nil)
 }
 
@@ -162,29 +206,68 @@ func CreateAndPublishArticle(c echo.Context) error {
 	var article model.Article
 	title, text := c.FormValue("title"), c.FormValue("text")
 	data := map[string]any{
-		"locale": utils.GetLocale(c),
-		"title":  title,
-		"text":   text,
+		"locale":       utils.GetLocale(c),
+		"title":        title,
+		"text":         text,
+		"visibilities": visibilityOptions(c.FormValue("visibility"), false),
 	}
 	user, err := GetUserOfSession(c)
 	if err != nil || !user.Active {
 		return c.Render(200, "article_form", data)
 	}
-	processedHTML, err := processHTML(text)
+	format, source, processedHTML, err := processArticleForm(c)
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
 	article.Title = title
 	article.Content = processedHTML
+	article.Format = format
+	article.Source = source
 	article.Author = user.Username
-	article.Published = true
+	visibility, ok := publishVisibility(c)
+	if !ok {
+		return c.Render(200, "article_form", data)
+	}
+	//Only issues that block publishing keep the article as a draft, the rest are shown once it is published
+	issues := checkArticleAccessibility(processedHTML)
+	blocked := blocksPublishing(issues)
+	if !blocked {
+		article.SetVisibility(visibility)
+	}
 	err = database.CreateArticle(&article)
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
+	database.DeleteArticleAutosave(0, user.Username)
+	if blocked {
+		return renderAccessibilityCheck(c, issues, fmt.Sprintf("/article/publish/%d?visibility=%s", article.ID, visibility), fmt.Sprintf("/article/edit/%d", article.ID))
+	}
+	if len(issues) > 0 {
+		return renderAccessibilityWarnings(c, issues, fmt.Sprintf("/article/edit/%d", article.ID))
+	}
 	return c.Render(200, "success", nil)
 }
 
+// processArticleForm returns the format, markdown source and sanitized html sent by the article form
+func processArticleForm(c echo.Context) (string, string, string, error) {
+	if c.FormValue("format") == model.ARTICLE_FORMAT_MARKDOWN {
+		source := c.FormValue("source")
+		processedHTML, err := processMarkdown(source)
+		return model.ARTICLE_FORMAT_MARKDOWN, source, processedHTML, err
+	}
+	processedHTML, err := processHTML(c.FormValue("text"))
+	return model.ARTICLE_FORMAT_HTML, "", processedHTML, err
+}
+
+// PreviewMarkdown renders the markdown being written without uploading its images
+func PreviewMarkdown(c echo.Context) error {
+	_, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	return c.HTML(200, sanitizeHTML(renderMarkdown([]byte(c.FormValue("source")))))
+}
+
 func GetMyArticles(c echo.Context) error {
 	which := c.QueryParam("which")
 	if which == "part" {
@@ -246,12 +329,14 @@ func convertArticlesToDataMap(articles []model.Article) []map[string]interface{}
 	articles_content := make([]map[string]interface{}, len(articles))
 	for i := range articles {
 		articles_content[i] = map[string]any{
-			"id":        articles[i].ID,
-			"title":     articles[i].Title,
-			"author":    articles[i].Author,
-			"createdAt": articles[i].CreatedAt.Format("2006-01-02 15:04:05"),
-			"updatedAt": articles[i].UpdatedAt.Format("2006-01-02 15:04:05"),
-			"published": articles[i].Published,
+			"id":         articles[i].ID,
+			"path":       postPath("article", articles[i].ID, articles[i].Slug),
+			"title":      articles[i].Title,
+			"author":     articles[i].Author,
+			"createdAt":  articles[i].CreatedAt.Format("2006-01-02 15:04:05"),
+			"updatedAt":  articles[i].UpdatedAt.Format("2006-01-02 15:04:05"),
+			"published":  articles[i].Published,
+			"visibility": articles[i].Visibility,
 		}
 	}
 	return articles_content
@@ -259,74 +344,110 @@ func convertArticlesToDataMap(articles []model.Article) []map[string]interface{}
 
 func GetArticleByIDPart(c echo.Context) error {
 	locale := utils.GetLocale(c)
-	id_str := c.Param("id")
-	id, err := strconv.ParseUint(id_str, 10, 64)
+	article, err := findArticleOfURL(c)
 	if err != nil {
-		return c.String(400, "Bad Request")
-	}
-	article, err := database.FindArticleByID(id)
-	if err != nil {
-		return c.String(500, "Internal Server Error")
+		return c.String(404, "Not Found")
 	}
 	user, err := GetUserOfSession(c)
-	if !article.Published && (err != nil || user.Username != article.Author) {
-		return c.String(401, "Unauthorized")
+	if !canSeePost(user.Username, "article", article.ID, article.BasePost) {
+		return c.String(404, "Not Found")
 	}
 	isAuthor := user.Username == article.Author
+	canEdit := canEditPost(user.Username, "article", article.ID, article.Author)
+	countPostView(c, article.ID, "article")
+	content, toc := articleContent(article.Content)
 	data := map[string]any{
-		"id":        article.ID,
-		"title":     article.Title,
-		"author":    article.Author,
-		"createdAt": article.CreatedAt.Format("2006-01-02 15:04:05"),
-		"updatedAt": article.UpdatedAt.Format("2006-01-02 15:04:05"),
-		"content":   template.HTML(article.Content), //skipcq  GSC-G203
-		"published": article.Published,
-		"locale":    locale,
-		"isAuthor":  isAuthor,
-		"isActive":  user.Active,
+		"id":           article.ID,
+		"title":        article.Title,
+		"author":       article.Author,
+		"coauthors":    coAuthorNames("article", article.ID),
+		"createdAt":    article.CreatedAt.Format("2006-01-02 15:04:05"),
+		"updatedAt":    article.UpdatedAt.Format("2006-01-02 15:04:05"),
+		"content":      content,
+		"toc":          toc,
+		"published":    article.Published,
+		"visibility":   article.Visibility,
+		"visibilities": visibilityOptions(article.Visibility, true),
+		"locale":       locale,
+		"isAuthor":     isAuthor,
+		"canEdit":      canEdit,
+		"isActive":     user.Active,
 	}
 	return c.Render(200, "article", data)
 }
 
 func GetArticleByIDFull(c echo.Context) error {
 	locale := utils.GetLocale(c)
-	id_str := c.Param("id")
-	id, err := strconv.ParseUint(id_str, 10, 64)
-	if err != nil {
-		return c.String(400, "Bad Request")
-	}
-	article, err := database.FindArticleByID(id)
+	article, err := findArticleOfURL(c)
 	if err != nil {
-		return c.String(500, "Internal Server Error")
+		return c.String(404, "Not Found")
 	}
 	user, err := GetUserOfSession(c)
-	if !article.Published && (err != nil || user.Username != article.Author) {
-		return c.String(401, "Unauthorized")
+	if !canSeePost(user.Username, "article", article.ID, article.BasePost) {
+		return c.String(404, "Not Found")
 	}
 	isAuthor := user.Username == article.Author
+	canEdit := canEditPost(user.Username, "article", article.ID, article.Author)
+	countPostView(c, article.ID, "article")
 	isAuthenticated := err == nil
 	isModerator := isAuthenticated && user.Authority.Level == model.AUTH_MODERATOR.Level
 	isAdmin := isAuthenticated && user.Authority.Level == model.AUTH_ADMIN.Level
+	content, toc := articleContent(article.Content)
 	data := map[string]any{
 		"id":              article.ID,
 		"title":           article.Title,
-		"content":         template.HTML(article.Content), //skipcq  GSC-G203
+		"content":         content,
+		"toc":             toc,
 		"author":          article.Author,
+		"coauthors":       coAuthorNames("article", article.ID),
 		"createdAt":       article.CreatedAt,
 		"updatedAt":       article.UpdatedAt,
 		"published":       article.Published,
+		"visibility":      article.Visibility,
+		"visibilities":    visibilityOptions(article.Visibility, true),
 		"locale":          locale,
 		"isAuthor":        isAuthor,
+		"canEdit":         canEdit,
 		"isActive":        user.Active,
 		"IsAuthenticated": isAuthenticated,
 		"IsModerator":     isModerator,
 		"IsAdmin":         isAdmin,
 		"app_title":       "Portfol.io",
 	}
+	if article.IsPublic() {
+		description, image := summarizeHTML(article.Content)
+		meta := pageMeta(c, "article", article.Title, description, postPath("article", article.ID, article.Slug), image)
+		meta["author"] = article.Author
+		meta["published_time"] = article.CreatedAt.UTC().Format(time.RFC3339)
+		data["meta"] = meta
+	}
 	return c.Render(200, "article_full", data)
 }
 
+// findArticleOfURL accepts both the slug and the id of the article
+func findArticleOfURL(c echo.Context) (model.Article, error) {
+	if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+		return database.FindArticleByID(id)
+	}
+	return database.FindArticleBySlug(c.Param("id"))
+}
+
 func GetArticleByID(c echo.Context) error {
+	//Links by id keep working but the slug is the address of a published article
+	//The slug is only revealed to those who can see the article
+	if _, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+		article, err := findArticleOfURL(c)
+		if err != nil {
+			return c.String(404, "Not Found")
+		}
+		user, _ := GetUserOfSession(c)
+		if !canSeePost(user.Username, "article", article.ID, article.BasePost) {
+			return c.String(404, "Not Found")
+		}
+		if !article.IsDraft() && article.Slug != "" {
+			return redirectToSlug(c, "/article/"+article.Slug)
+		}
+	}
 	which := c.QueryParam("which")
 	if which == "part" {
 		return GetArticleByIDPart(c)
@@ -345,15 +466,23 @@ func EditArticleForm(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !canEditPost(user.Username, "article", article.ID, article.Author) {
+		return c.String(401, "Unauthorized")
+	}
 	formValues := map[string]any{
-		"title": article.Title,
-		"text":  template.HTML(article.Content), //skipcq  GSC-G203
+		"title":      article.Title,
+		"text":       template.HTML(article.Content), //skipcq  GSC-G203
+		"source":     article.Source,
+		"isMarkdown": article.IsMarkdown(),
 	}
 	data := map[string]any{
 		"id":         article.ID,
+		"version":    article.Version,
 		"formValues": formValues,
 		"locale":     locale,
 	}
+	withArticleAutosave(c, data, article.ID, user.Username)
 	return c.Render(200, "article_form", data)
 }
 
@@ -376,7 +505,7 @@ func EditArticle(c echo.Context) error {
 	if !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	processedHTML, err := processHTML(text)
+	format, source, processedHTML, err := processArticleForm(c)
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
@@ -384,15 +513,25 @@ func EditArticle(c echo.Context) error {
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
-	if article.Author != user.Username {
+	if !canEditPost(user.Username, "article", article.ID, article.Author) {
 		return c.String(401, "Unauthorized")
 	}
+	version, err := strconv.ParseUint(c.FormValue("version"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
 	article.Title = title
 	article.Content = processedHTML
-	err = database.UpdateArticle(&article)
+	article.Format = format
+	article.Source = source
+	err = database.UpdateArticleContent(&article, version)
+	if errors.Is(err, database.ErrArticleConflict) {
+		return renderArticleConflict(c, articleAutosaveOf(c, article.ID, user.Username, version), processedHTML)
+	}
 	if err != nil {
 		return c.Render(200, "article_form", data)
 	}
+	database.DeleteArticleAutosave(article.ID, user.Username)
 	return c.Render(200, "success", nil)
 }
 
@@ -413,8 +552,16 @@ func PublishArticle(c echo.Context) error {
 	if article.Author != user.Username {
 		return c.String(401, "Unauthorized")
 	}
-	article.Published = true
-	err = database.UpdateArticle(&article)
+	visibility, ok := publishVisibility(c)
+	if !ok {
+		return c.String(400, "Bad Request")
+	}
+	issues := checkArticleAccessibility(article.Content)
+	if len(issues) > 0 && (c.FormValue("force") != "true" || blocksPublishing(issues)) {
+		return renderAccessibilityCheck(c, issues, fmt.Sprintf("/article/publish/%d?visibility=%s", article.ID, visibility), fmt.Sprintf("/article/edit/%d", article.ID))
+	}
+	article.SetVisibility(visibility)
+	err = database.UpdateArticleVisibility(&article)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -438,10 +585,6 @@ func DeleteArticle(c echo.Context) error {
 	if article.Author != user.Username {
 		return c.String(401, "Unauthorized")
 	}
-	err = database.RemoveAllVotesForArticle(&article)
-	if err != nil {
-		return c.String(500, "Internal Server Error")
-	}
 	err = database.DeleteArticle(&article)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
@@ -464,11 +607,12 @@ func CreateGalleryPart(c echo.Context) error {
 		return c.String(500, "Internal Server Error")
 	}
 	data := map[string]any{
-		"locale":      utils.GetLocale(c),
-		"id":          gallery.ID,
-		"isZero":      true,
-		"isLimit":     false,
-		"isPublished": gallery.Published,
+		"locale":       utils.GetLocale(c),
+		"id":           gallery.ID,
+		"isZero":       true,
+		"isLimit":      false,
+		"isPublished":  gallery.Published,
+		"visibilities": visibilityOptions("", false),
 	}
 	return c.Render(200, "gallery_form", data)
 }
@@ -513,44 +657,75 @@ func AddImageToGallery(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	if len(gallery.Images) >= 10 {
+	if len(gallery.Images) >= galleryMaxImages {
 		return c.String(400, "Bad Request")
 	}
-	if gallery.Author != user.Username {
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
 		return c.String(401, "Unauthorized")
 	}
-	var image model.Image
-	file, err := c.FormFile("image")
-	if err != nil {
-		return c.String(400, "Bad Request")
+	locale := utils.GetLocale(c)
+	footer, alt := c.FormValue("footer"), strings.TrimSpace(c.FormValue("alt"))
+	form_data := map[string]any{
+		"id":           gallery.ID,
+		"locale":       locale,
+		"isLimit":      false,
+		"isZero":       len(gallery.Images) == 0,
+		"isPublished":  gallery.Published,
+		"isCoAuthor":   gallery.Author != user.Username,
+		"visibilities": visibilityOptions("", false),
+		"formValues":   map[string]string{"footer": footer, "alt": alt},
+	}
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["image"]) == 0 {
+		form_data["errors"] = map[string]string{"image": utils.Translate(locale, "upload_image_no_file_error")}
+		return c.Render(200, "upload_image", form_data)
+	}
+	images := collectBulkImages(form.File["image"], footer, alt)
+	//Images that do not fit in the gallery are not even processed
+	room := galleryMaxImages - len(gallery.Images)
+	for i := range images {
+		if images[i].Err == nil {
+			if room == 0 {
+				images[i].Err = ErrGalleryFull
+				continue
+			}
+			room--
+		}
 	}
-	file_bytes, err := convertFileToBytes(file)
-	if err != nil {
-		return c.String(500, "Internal Server Error")
+	uploadBulkImages(images)
+	added := 0
+	results := make([]map[string]any, len(images))
+	for i, bulk := range images {
+		if bulk.Err == nil {
+			image := model.Image{GalleryID: gallery.ID, Owner: user.Username, Footer: bulk.Footer, Alt: bulk.Alt}
+			setImageVariants(&image, bulk.Variants)
+			bulk.Err = database.CreateImage(&image)
+		}
+		results[i] = map[string]any{"name": bulk.Name, "ok": bulk.Err == nil, "missingAlt": bulk.Alt == ""}
+		if bulk.Err != nil {
+			results[i]["error"] = utils.Translate(locale, imageErrorKey(bulk.Err))
+			continue
+		}
+		added++
 	}
-	image.GalleryID = gallery_id
-	url_map, err := uploadImageToImgbb(file_bytes)
-	if err != nil {
-		return c.Render(500, "error", nil)
+	//A single image that fails keeps the old form with its error
+	if added == 0 && len(images) == 1 {
+		form_data["errors"] = map[string]string{"image": results[0]["error"].(string)}
+		return c.Render(200, "upload_image", form_data)
 	}
-	image.ImageURL = url_map["image_url"]
-	image.ThumbURL = url_map["thumb_url"]
-	image.DeleteURL = url_map["delete_url"]
-	image.Footer = c.FormValue("footer")
-	image.Owner = user.Username
-	err = database.CreateImage(&image)
-	if err != nil {
-		return c.String(500, "Internal Server Error")
+	amount := len(gallery.Images) + added
+	if added > 0 {
+		c.Response().Header().Set("HX-Trigger", "gallery-reload")
 	}
-	amount := len(gallery.Images) + 1
-	isLimit := amount >= 10
-	c.Response().Header().Set("HX-Trigger", "gallery-reload")
 	data := map[string]any{
-		"id":          gallery.ID,
-		"locale":      utils.GetLocale(c),
-		"isLimit":     isLimit,
-		"isZero":      false,
-		"isPublished": gallery.Published,
+		"id":           gallery.ID,
+		"locale":       locale,
+		"isLimit":      amount >= galleryMaxImages,
+		"isZero":       amount == 0,
+		"isPublished":  gallery.Published,
+		"isCoAuthor":   gallery.Author != user.Username,
+		"visibilities": visibilityOptions("", false),
+		"results":      results,
 	}
 	return c.Render(200, "upload_image", data)
 }
@@ -569,6 +744,9 @@ func GetChangeTitleOfGallery(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
+		return c.String(401, "Unauthorized")
+	}
 	data := map[string]any{
 		"id":          gallery.ID,
 		"locale":      utils.GetLocale(c),
@@ -591,7 +769,7 @@ func ChangeTitleOfGallery(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	if gallery.Author != user.Username {
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
 		return c.String(401, "Unauthorized")
 	}
 	title := c.FormValue("title")
@@ -625,8 +803,16 @@ func PublishGallery(c echo.Context) error {
 	if gallery.Author != user.Username {
 		return c.String(401, "Unauthorized")
 	}
-	gallery.Published = true
-	err = database.UpdateGallery(&gallery)
+	visibility, ok := publishVisibility(c)
+	if !ok {
+		return c.String(400, "Bad Request")
+	}
+	issues := checkGalleryAccessibility(gallery)
+	if len(issues) > 0 && (c.FormValue("force") != "true" || blocksPublishing(issues)) {
+		return renderAccessibilityCheck(c, issues, fmt.Sprintf("/gallery/%d/publish?visibility=%s", gallery.ID, visibility), fmt.Sprintf("/gallery/edit/%d", gallery.ID))
+	}
+	gallery.SetVisibility(visibility)
+	err = database.UpdateGalleryVisibility(&gallery)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -647,7 +833,7 @@ func DeleteImage(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	if image.Owner != user.Username {
+	if !canEditImage(user.Username, image) {
 		return c.String(401, "Unauthorized")
 	}
 	err = database.DeleteImage(&image)
@@ -673,17 +859,19 @@ func GetImageUploadForm(c echo.Context) error {
 		return c.String(500, "Internal Server Error")
 	}
 	user, err := GetUserOfSession(c)
-	if err != nil || !user.Active || gallery.Author != user.Username {
+	if err != nil || !user.Active || !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
 		return c.String(401, "Unauthorized")
 	}
-	isLimit := len(gallery.Images) >= 10
+	isLimit := len(gallery.Images) >= galleryMaxImages
 	isZero := len(gallery.Images) == 0
 	data := map[string]any{
-		"id":          gallery.ID,
-		"locale":      locale,
-		"isLimit":     isLimit,
-		"isZero":      isZero,
-		"isPublished": gallery.Published,
+		"id":           gallery.ID,
+		"locale":       locale,
+		"isLimit":      isLimit,
+		"isZero":       isZero,
+		"isPublished":  gallery.Published,
+		"isCoAuthor":   gallery.Author != user.Username,
+		"visibilities": visibilityOptions("", false),
 	}
 	return c.Render(200, "upload_image", data)
 }
@@ -699,16 +887,158 @@ func GetImagesOfGallery(c echo.Context) error {
 		return c.String(500, "Internal Server Error")
 	}
 	user, _ := GetUserOfSession(c)
-	images := convertImagesToDataMap(gallery.Images, "isAuthor", user.Username == gallery.Author)
+	if !canSeePost(user.Username, "gallery", gallery.ID, gallery.BasePost) {
+		return c.String(404, "Not Found")
+	}
+	isAuthor := canEditPost(user.Username, "gallery", gallery.ID, gallery.Author)
+	images := convertImagesToDataMap(gallery.Images, gallery.CoverID, "isAuthor", isAuthor)
 	data := map[string]any{
-		"id":     gallery.ID,
-		"images": images,
-		"locale": utils.GetLocale(c),
+		"id":       gallery.ID,
+		"images":   images,
+		"locale":   utils.GetLocale(c),
+		"editable": isAuthor && user.Active,
 	}
 	return c.Render(200, "images", data)
 }
 
-func convertImagesToDataMap(images []model.Image, optional_values ...any) []map[string]interface{} {
+func ReorderGalleryImages(c echo.Context) error {
+	idstr := c.Param("id")
+	gallery_id, err := strconv.ParseUint(idstr, 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	gallery, err := database.FindGalleryByID(gallery_id)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
+		return c.String(401, "Unauthorized")
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	ids := make([]uint64, 0, len(form["image"]))
+	for _, value := range form["image"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.String(400, "Bad Request")
+		}
+		ids = append(ids, id)
+	}
+	err = database.ReorderGalleryImages(gallery.ID, ids)
+	if errors.Is(err, database.ErrInvalidImageOrder) {
+		return c.String(400, "Bad Request")
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	data := map[string]string{
+		"message": "Images reordered successfully!",
+	}
+	return c.JSON(200, data)
+}
+
+func SetGalleryCover(c echo.Context) error {
+	idstr := c.Param("id")
+	gallery_id, err := strconv.ParseUint(idstr, 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	image_id, err := strconv.ParseUint(c.FormValue("image"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	gallery, err := database.FindGalleryByID(gallery_id)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
+		return c.String(401, "Unauthorized")
+	}
+	found := false
+	for _, image := range gallery.Images {
+		found = found || image.ID == image_id
+	}
+	if !found {
+		return c.String(400, "Bad Request")
+	}
+	err = database.SetGalleryCover(&gallery, image_id)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	c.Response().Header().Set("HX-Trigger", "gallery-reload")
+	data := map[string]string{
+		"message": "Cover changed successfully!",
+	}
+	return c.JSON(200, data)
+}
+
+func GetImageEditForm(c echo.Context) error {
+	idstr := c.Param("id")
+	image_id, err := strconv.ParseUint(idstr, 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	image, err := database.FindImageByID(image_id)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if !canEditImage(user.Username, image) {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"id":         image.ID,
+		"locale":     utils.GetLocale(c),
+		"thumb_url":  image.ThumbURL,
+		"formValues": map[string]string{"footer": image.Footer, "alt": image.Alt},
+	}
+	return c.Render(200, "image_edit_form", data)
+}
+
+func EditImage(c echo.Context) error {
+	idstr := c.Param("id")
+	image_id, err := strconv.ParseUint(idstr, 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	image, err := database.FindImageByID(image_id)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	if !canEditImage(user.Username, image) {
+		return c.String(401, "Unauthorized")
+	}
+	image.Footer = c.FormValue("footer")
+	image.Alt = strings.TrimSpace(c.FormValue("alt"))
+	err = database.UpdateImage(&image)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	c.Response().Header().Set("HX-Trigger", "gallery-reload")
+	data := map[string]string{
+		"message": "Image edited successfully!",
+	}
+	return c.JSON(200, data)
+}
+
+func convertImagesToDataMap(images []model.Image, coverID uint64, optional_values ...any) []map[string]interface{} {
 	//Optional are key value pairs to be added to every image
 	values := make(map[string]any, len(optional_values)/2)
 	if len(optional_values)%2 == 0 {
@@ -722,8 +1052,13 @@ func convertImagesToDataMap(images []model.Image, optional_values ...any) []map[
 			"id":        images[i].ID,
 			"image_url": images[i].ImageURL,
 			"thumb_url": images[i].ThumbURL,
+			"srcset":    imageSrcset(images[i].Variants),
+			"width":     images[i].Width,
+			"height":    images[i].Height,
 			"footer":    images[i].Footer,
+			"alt":       images[i].Alt,
 			"author":    images[i].Owner,
+			"isCover":   images[i].ID == coverID || (coverID == 0 && i == 0),
 			"options":   values,
 		}
 	}
@@ -732,76 +1067,114 @@ func convertImagesToDataMap(images []model.Image, optional_values ...any) []map[
 
 func GetGalleryByIDPart(c echo.Context) error {
 	locale := utils.GetLocale(c)
-	id_str := c.Param("id")
-	id, err := strconv.ParseUint(id_str, 10, 64)
-	if err != nil {
-		return c.String(400, "Bad Request")
-	}
-	gallery, err := database.FindGalleryByID(id)
+	gallery, err := findGalleryOfURL(c)
 	if err != nil {
-		return c.String(500, "Internal Server Error")
+		return c.String(404, "Not Found")
 	}
 	user, err := GetUserOfSession(c)
-	if !gallery.Published && (err != nil || user.Username != gallery.Author) {
-		return c.String(401, "Unauthorized")
+	if !canSeePost(user.Username, "gallery", gallery.ID, gallery.BasePost) {
+		return c.String(404, "Not Found")
 	}
 	isAuthor := user.Username == gallery.Author
-	images := convertImagesToDataMap(gallery.Images)
+	canEdit := canEditPost(user.Username, "gallery", gallery.ID, gallery.Author)
+	countPostView(c, gallery.ID, "gallery")
+	images := convertImagesToDataMap(gallery.Images, gallery.CoverID)
 	data := map[string]any{
-		"id":        gallery.ID,
-		"title":     gallery.Title,
-		"author":    gallery.Author,
-		"createdAt": gallery.CreatedAt,
-		"updatedAt": gallery.UpdatedAt,
-		"published": gallery.Published,
-		"images":    images,
-		"locale":    locale,
-		"isAuthor":  isAuthor,
-		"isActive":  user.Active,
+		"id":           gallery.ID,
+		"title":        gallery.Title,
+		"author":       gallery.Author,
+		"coauthors":    coAuthorNames("gallery", gallery.ID),
+		"createdAt":    gallery.CreatedAt,
+		"updatedAt":    gallery.UpdatedAt,
+		"published":    gallery.Published,
+		"visibility":   gallery.Visibility,
+		"visibilities": visibilityOptions(gallery.Visibility, true),
+		"images":       images,
+		"locale":       locale,
+		"isAuthor":     isAuthor,
+		"canEdit":      canEdit,
+		"isActive":     user.Active,
 	}
 	return c.Render(200, "gallery", data)
 }
 
 func GetGalleryByIDFull(c echo.Context) error {
 	locale := utils.GetLocale(c)
-	id_str := c.Param("id")
-	id, err := strconv.ParseUint(id_str, 10, 64)
-	if err != nil {
-		return c.String(400, "Bad Request")
-	}
-	gallery, err := database.FindGalleryByID(id)
+	gallery, err := findGalleryOfURL(c)
 	if err != nil {
-		return c.String(500, "Internal Server Error")
+		return c.String(404, "Not Found")
 	}
 	user, err := GetUserOfSession(c)
-	if !gallery.Published && (err != nil || user.Username != gallery.Author) {
-		return c.String(401, "Unauthorized")
+	if !canSeePost(user.Username, "gallery", gallery.ID, gallery.BasePost) {
+		return c.String(404, "Not Found")
 	}
 	isAuthor := user.Username == gallery.Author
+	canEdit := canEditPost(user.Username, "gallery", gallery.ID, gallery.Author)
+	countPostView(c, gallery.ID, "gallery")
 	isAuthenticated := err == nil
 	isModerator := isAuthenticated && user.Authority.Level == model.AUTH_MODERATOR.Level
 	isAdmin := isAuthenticated && user.Authority.Level == model.AUTH_ADMIN.Level
-	images := convertImagesToDataMap(gallery.Images)
+	images := convertImagesToDataMap(gallery.Images, gallery.CoverID)
 	data := map[string]any{
 		"id":              gallery.ID,
 		"title":           gallery.Title,
 		"author":          gallery.Author,
+		"coauthors":       coAuthorNames("gallery", gallery.ID),
 		"createdAt":       gallery.CreatedAt,
 		"updatedAt":       gallery.UpdatedAt,
 		"published":       gallery.Published,
+		"visibility":      gallery.Visibility,
+		"visibilities":    visibilityOptions(gallery.Visibility, true),
 		"images":          images,
 		"locale":          locale,
 		"isAuthor":        isAuthor,
+		"canEdit":         canEdit,
 		"isActive":        user.Active,
 		"IsAuthenticated": isAuthenticated,
 		"IsModerator":     isModerator,
 		"IsAdmin":         isAdmin,
 		"app_title":       "Portfol.io",
 	}
+	if gallery.IsPublic() {
+		image, description := "", fmt.Sprintf(utils.Translate(locale, "seo_gallery_description"), len(gallery.Images), gallery.Author)
+		if cover, ok := gallery.Cover(); ok {
+			image = cover.ImageURL
+			if cover.Footer != "" {
+				description = shortenText(cover.Footer, metaDescriptionLength)
+			}
+		}
+		meta := pageMeta(c, "article", gallery.Title, description, postPath("gallery", gallery.ID, gallery.Slug), image)
+		meta["author"] = gallery.Author
+		meta["published_time"] = gallery.CreatedAt.UTC().Format(time.RFC3339)
+		data["meta"] = meta
+	}
 	return c.Render(200, "gallery_full", data)
 }
 
+// findGalleryOfURL accepts both the slug and the id of the gallery
+func findGalleryOfURL(c echo.Context) (model.Gallery, error) {
+	if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+		return database.FindGalleryByID(id)
+	}
+	return database.FindGalleryBySlug(c.Param("id"))
+}
+
 func GetGalleryByID(c echo.Context) error {
+	//Links by id keep working but the slug is the address of a published gallery
+	//The slug is only revealed to those who can see the gallery
+	if _, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+		gallery, err := findGalleryOfURL(c)
+		if err != nil {
+			return c.String(404, "Not Found")
+		}
+		user, _ := GetUserOfSession(c)
+		if !canSeePost(user.Username, "gallery", gallery.ID, gallery.BasePost) {
+			return c.String(404, "Not Found")
+		}
+		if !gallery.IsDraft() && gallery.Slug != "" {
+			return redirectToSlug(c, "/gallery/"+gallery.Slug)
+		}
+	}
 	which := c.QueryParam("which")
 	if which == "part" {
 		return GetGalleryByIDPart(c)
@@ -884,10 +1257,6 @@ func DeleteGallery(c echo.Context) error {
 	if gallery.Author != user.Username {
 		return c.String(401, "Unauthorized")
 	}
-	err = database.RemoveAllVotesForGallery(&gallery)
-	if err != nil {
-		return c.String(500, "Internal Server Error")
-	}
 	err = database.DeleteGallery(&gallery)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
@@ -900,19 +1269,21 @@ func convertGalleriesToDataMap(galleries_db []model.Gallery, showBadge bool) []m
 	for i := range galleries_db {
 		amount := len(galleries_db[i].Images)
 		url := ""
-		if amount > 0 {
-			url = galleries_db[i].Images[0].ThumbURL
+		if cover, ok := galleries_db[i].Cover(); ok {
+			url = cover.ThumbURL
 		}
 		galleries[i] = map[string]any{
-			"id":        galleries_db[i].ID,
-			"title":     galleries_db[i].Title,
-			"author":    galleries_db[i].Author,
-			"createdAt": galleries_db[i].CreatedAt,
-			"updatedAt": galleries_db[i].UpdatedAt,
-			"published": galleries_db[i].Published,
-			"url":       url,
-			"amount":    amount,
-			"showBadge": showBadge,
+			"id":         galleries_db[i].ID,
+			"title":      galleries_db[i].Title,
+			"author":     galleries_db[i].Author,
+			"createdAt":  galleries_db[i].CreatedAt,
+			"updatedAt":  galleries_db[i].UpdatedAt,
+			"published":  galleries_db[i].Published,
+			"visibility": galleries_db[i].Visibility,
+			"path":       postPath("gallery", galleries_db[i].ID, galleries_db[i].Slug),
+			"url":        url,
+			"amount":     amount,
+			"showBadge":  showBadge,
 		}
 	}
 	return galleries
@@ -929,15 +1300,21 @@ func EditGalleryForm(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	isLimit := len(gallery.Images) >= 10
+	user, err := GetUserOfSession(c)
+	if err != nil || !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
+		return c.String(401, "Unauthorized")
+	}
+	isLimit := len(gallery.Images) >= galleryMaxImages
 	isZero := len(gallery.Images) == 0
 	data := map[string]any{
-		"id":          gallery.ID,
-		"locale":      locale,
-		"value_title": gallery.Title,
-		"isLimit":     isLimit,
-		"isZero":      isZero,
-		"isPublished": gallery.Published,
+		"id":           gallery.ID,
+		"locale":       locale,
+		"value_title":  gallery.Title,
+		"isLimit":      isLimit,
+		"isZero":       isZero,
+		"isPublished":  gallery.Published,
+		"isCoAuthor":   gallery.Author != user.Username,
+		"visibilities": visibilityOptions("", false),
 	}
 	return c.Render(200, "gallery_form", data)
 }
@@ -961,7 +1338,7 @@ func EditGallery(c echo.Context) error {
 	if err != nil {
 		return c.Render(200, "gallery_form", data)
 	}
-	if gallery.Author != user.Username {
+	if !canEditPost(user.Username, "gallery", gallery.ID, gallery.Author) {
 		return c.String(401, "Unauthorized")
 	}
 	gallery.Title = title
@@ -980,7 +1357,7 @@ func GalleriesByTagPaginated(c echo.Context) error {
 	if err != nil {
 		return c.String(400, "Bad Request")
 	}
-	galleries_db, err := database.FindAllGalleriesByTagPaginated(tagName, page, 12)
+	galleries_db, err := database.FindAllGalleriesByTagPaginated(viewerOf(c), tagName, page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -989,7 +1366,7 @@ func GalleriesByTagPaginated(c echo.Context) error {
 	more := len(galleries_db) == 12
 	next_page_loader := ""
 	if more {
-		next_page_loader = fmt.Sprintf("/gallery/tag/%s?page=%d", tagName, next_page)
+		next_page_loader = fmt.Sprintf("/gallery/tag/%s?page=%d", url.PathEscape(tagName), next_page)
 	}
 	data := map[string]any{
 		"galleries": galleries,
@@ -1017,15 +1394,25 @@ func CreateTag(c echo.Context) error {
 	locale := utils.GetLocale(c)
 	postType := c.QueryParam("post-type")
 	postIDstr := c.QueryParam("post-id")
-	name := c.FormValue("query")
-	_, err := database.FindTagByName(name)
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"locale":   locale,
+		"postType": postType,
+		"postID":   postIDstr,
+	}
+	name := model.NormalizeTagName(c.FormValue("query"))
+	if name == "" {
+		data["error"] = utils.Translate(locale, "tag_invalid_name")
+		return c.Render(200, "tag_form", data)
+	}
+	existing, err := database.FindTagByName(name)
 	if err == nil {
-
-		data := map[string]any{
-			"locale":   locale,
-			"error":    utils.Translate("tag_already_exists", locale),
-			"postType": postType,
-			"postID":   postIDstr,
+		data["error"] = utils.Translate(locale, "tag_already_exists")
+		if existing.Banned {
+			data["error"] = utils.Translate(locale, "tag_banned")
 		}
 		return c.Render(200, "tag_form", data)
 	}
@@ -1034,11 +1421,6 @@ func CreateTag(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	data := map[string]any{
-		"locale":   locale,
-		"postType": postType,
-		"postID":   postIDstr,
-	}
 	return c.Render(200, "tag_form", data)
 }
 
@@ -1051,7 +1433,7 @@ func FindTags(c echo.Context) error {
 	if postType != "" {
 		isAdd = true
 	}
-	tags_db, err := database.FindTagLikeName(query, 25)
+	tags_db, err := database.FindTagLikeName(model.NormalizeTagName(query), 25)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1102,7 +1484,7 @@ func ArticlesByTagPaginated(c echo.Context) error {
 	if err != nil {
 		return c.String(400, "Bad Request")
 	}
-	articles_db, err := database.FindAllArticlesByTagPaginated(tagName, page, 12)
+	articles_db, err := database.FindAllArticlesByTagPaginated(viewerOf(c), tagName, page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1111,7 +1493,7 @@ func ArticlesByTagPaginated(c echo.Context) error {
 	more := len(articles_db) == 12
 	next_page_loader := ""
 	if more {
-		next_page_loader = fmt.Sprintf("/article/tag/%s?page=%d", tagName, next_page)
+		next_page_loader = fmt.Sprintf("/article/tag/%s?page=%d", url.PathEscape(tagName), next_page)
 	}
 	data := map[string]any{
 		"articles":  articles,
@@ -1133,6 +1515,51 @@ func GetPostsMain(c echo.Context) error {
 	return c.Render(200, "posts_main", data)
 }
 
+// GetFeed lists the posts of the trending, top or new feed, top can be limited to the last week or month
+func GetFeed(c echo.Context) error {
+	locale := utils.GetLocale(c)
+	feed := c.Param("feed")
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	period := c.QueryParam("period")
+	viewer := viewerOf(c)
+	var postsDB []model.Post
+	switch feed {
+	case "trending":
+		postsDB, err = database.FindPostsOfFeedPaginated(viewer, database.FEED_TRENDING, page, 12)
+	case "top":
+		if period != database.FEED_MONTH && period != database.FEED_ALL_TIME {
+			period = database.FEED_WEEK
+		}
+		postsDB, err = database.FindPostsOfFeedPaginated(viewer, period, page, 12)
+	case "new":
+		postsDB, err = database.FindNewPostsPaginated(viewer, page, 12)
+	default:
+		return c.String(404, "Not Found")
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	posts := convertPostsToDataMap(postsDB)
+	more := len(postsDB) == 12
+	nextPageLoader := ""
+	if more {
+		nextPageLoader = fmt.Sprintf("/posts/feed/%s?page=%d&period=%s", feed, page+1, period)
+	}
+	data := map[string]any{
+		"locale":   locale,
+		"feed":     feed,
+		"period":   period,
+		"posts":    posts,
+		"more":     more,
+		"nextPage": nextPageLoader,
+		"first":    page == 1,
+	}
+	return c.Render(200, "feed", data)
+}
+
 func PostsMainPage(c echo.Context) error {
 	locale := utils.GetLocale(c)
 	data := map[string]any{
@@ -1149,7 +1576,7 @@ func PostsSearchPaginated(c echo.Context) error {
 	if err != nil {
 		page = 1
 	}
-	posts_db, err := database.FindPostsByQueryPaginated(query, page, 12)
+	posts_db, err := database.FindPostsByQueryPaginated(viewerOf(c), query, page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1185,7 +1612,7 @@ func ArticleSearchPaginated(c echo.Context) error {
 	if err != nil {
 		page = 1
 	}
-	articles_db, err := database.FindArticlesByQueryPaginated(query, page, 12)
+	articles_db, err := database.FindArticlesByQueryPaginated(viewerOf(c), query, page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1221,7 +1648,7 @@ func GallerySearchPaginated(c echo.Context) error {
 	if err != nil {
 		page = 1
 	}
-	galleries_db, err := database.FindGalleriesByQueryPaginated(query, page, 12)
+	galleries_db, err := database.FindGalleriesByQueryPaginated(viewerOf(c), query, page, 12)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1293,14 +1720,15 @@ func convertPostsToPostList(posts []model.Post) []map[string]any {
 	var postsContent []map[string]any
 	for i := range posts {
 		postsContent = append(postsContent, map[string]any{
-			"postID":    posts[i].ID,
-			"author":    posts[i].Author,
-			"title":     posts[i].Title,
-			"createdAt": posts[i].CreatedAt.Format("2006-01-02 15:04:05"),
-			"updatedAt": posts[i].UpdatedAt.Format("2006-01-02 15:04:05"),
-			"published": posts[i].Published,
-			"type":      posts[i].OwnerType,
-			"id":        posts[i].OwnerID,
+			"postID":     posts[i].ID,
+			"author":     posts[i].Author,
+			"title":      posts[i].Title,
+			"createdAt":  posts[i].CreatedAt.Format("2006-01-02 15:04:05"),
+			"updatedAt":  posts[i].UpdatedAt.Format("2006-01-02 15:04:05"),
+			"published":  posts[i].Published,
+			"visibility": posts[i].Visibility,
+			"type":       posts[i].OwnerType,
+			"id":         posts[i].OwnerID,
 		})
 	}
 	return postsContent
@@ -1323,62 +1751,45 @@ func DeletePostModerators(c echo.Context) error {
 	return c.String(200, "Post deleted successfully!")
 }
 
+// VoteTagForPost votes the tag for the post, or takes the vote back if the user had already voted it
 func VoteTagForPost(c echo.Context) error {
 	tagName := c.QueryParam("tag")
 	ownerIDstr := c.QueryParam("postid")
 	ownerType := c.QueryParam("posttype")
-	var vote model.Vote
 	ownerID, err := strconv.ParseUint(ownerIDstr, 10, 64)
-	if err != nil {
+	if err != nil || !slices.Contains(postTypes, ownerType) {
 		return c.String(400, "Bad Request")
 	}
-
-	article := new(model.Article)
-	gallery := new(model.Gallery)
-	switch ownerType {
-	case "article":
-		articleDB, err := database.FindArticleByID(ownerID)
-		if err != nil {
-			return c.String(500, "Internal Server Error")
-		}
-		article = &articleDB
-	case "gallery":
-		galleryDB, err := database.FindGalleryByID(ownerID)
-		if err != nil {
-			return c.String(500, "Internal Server Error")
-		}
-		gallery = &galleryDB
-	default:
-		return c.String(400, "Bad Request")
+	post, err := database.FindPostByOwner(ownerID, ownerType)
+	if err != nil {
+		return c.String(404, "Not Found")
 	}
 	user, err := GetUserOfSession(c)
 	if err != nil || !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	tag, err := database.FindTagByName(tagName)
+	if !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) {
+		return c.String(403, "Forbidden")
+	}
+	tag, err := database.ResolveTag(tagName)
 	if err != nil {
-		return c.String(500, "Internal Server Error")
+		return c.String(404, "Not Found")
 	}
-	alreadyVoted := database.VoteExistsForTagUserAndPost(tag.ID, user.Username, ownerID, ownerType)
-	if alreadyVoted {
+	if tag.Banned {
 		return c.String(403, "Forbidden")
 	}
-	vote.TagID = tag.ID
-	vote.Voter = user.Username
-	switch ownerType {
-	case "article":
-		err = database.VoteTagForArticle(article, &vote)
-		if err != nil {
-			return c.String(500, "Internal Server Error")
-		}
-	case "gallery":
-		err = database.VoteTagForGallery(gallery, &vote)
-		if err != nil {
-			return c.String(500, "Internal Server Error")
-		}
+	message := "Tag voted successfully!"
+	if database.VoteExistsForTagUserAndPost(tag.ID, user.Username, ownerID, ownerType) {
+		err = database.UnvoteTagForPost(post, tag.ID, user.Username)
+		message = "Vote removed successfully!"
+	} else {
+		err = database.VoteTagForPost(post, &model.Vote{TagID: tag.ID, Voter: user.Username})
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
 	}
 	c.Response().Header().Set("HX-Trigger", "votes-reload")
-	return c.String(200, "Tag voted successfully!")
+	return c.String(200, message)
 }
 
 func FindVotesOfGallery(c echo.Context) error {
@@ -1391,12 +1802,11 @@ func FindVotesOfGallery(c echo.Context) error {
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	votes := convertVotesToDataMap(gallery.Votes)
-	data := map[string]any{
-		"votes":  votes,
-		"locale": utils.GetLocale(c),
+	user, _ := GetUserOfSession(c)
+	if !canSeePost(user.Username, "gallery", gallery.ID, gallery.BasePost) {
+		return c.String(404, "Not Found")
 	}
-	return c.Render(200, "votes", data)
+	return renderVotes(c, gallery.Votes, "gallery", gallery.ID)
 }
 
 func FindVotesOfArticle(c echo.Context) error {
@@ -1405,50 +1815,98 @@ func FindVotesOfArticle(c echo.Context) error {
 	if err != nil {
 		return c.String(400, "Bad Request")
 	}
-	gallery, err := database.FindArticleByID(articleID)
+	article, err := database.FindArticleByID(articleID)
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
-	votes := convertVotesToDataMap(gallery.Votes)
+	user, _ := GetUserOfSession(c)
+	if !canSeePost(user.Username, "article", article.ID, article.BasePost) {
+		return c.String(404, "Not Found")
+	}
+	return renderVotes(c, article.Votes, "article", article.ID)
+}
+
+func renderVotes(c echo.Context, votes []model.Vote, postType string, postID uint64) error {
+	user, _ := GetUserOfSession(c)
 	data := map[string]any{
-		"votes":  votes,
-		"locale": utils.GetLocale(c),
+		"votes":     convertVotesToDataMap(votes, user.Username),
+		"locale":    utils.GetLocale(c),
+		"post_type": postType,
+		"post_id":   postID,
+		"canVote":   user.Active,
 	}
 	return c.Render(200, "votes", data)
 }
 
-func convertVotesToDataMap(votes []model.Vote) []map[string]any {
-	tagByNumberOfVotes := make(map[string][]any)
+// convertVotesToDataMap groups the votes by tag, mine tells if the user is one of the voters
+func convertVotesToDataMap(votes []model.Vote, username string) []map[string]any {
 	var votesContent []map[string]any
+	byTag := make(map[string]map[string]any)
 	for i := range votes {
-		if _, ok := tagByNumberOfVotes[votes[i].Tag.Name]; !ok {
-			tagByNumberOfVotes[votes[i].Tag.Name] = []any{1, votes[i].Tag.ColorOfTag()}
-		} else {
-			tagByNumberOfVotes[votes[i].Tag.Name][0] = tagByNumberOfVotes[votes[i].Tag.Name][0].(int) + 1
+		tagVotes, ok := byTag[votes[i].Tag.Name]
+		if !ok {
+			tagVotes = map[string]any{
+				"tag":   votes[i].Tag.Name,
+				"votes": 0,
+				"color": votes[i].Tag.ColorOfTag(),
+				"mine":  false,
+			}
+			byTag[votes[i].Tag.Name] = tagVotes
+			votesContent = append(votesContent, tagVotes)
+		}
+		tagVotes["votes"] = tagVotes["votes"].(int) + 1
+		if username != "" && votes[i].Voter == username {
+			tagVotes["mine"] = true
 		}
 	}
-	for tagName, tagInfo := range tagByNumberOfVotes {
-		votesContent = append(votesContent, map[string]any{
-			"tag":   tagName,
-			"votes": tagInfo[0],
-			"color": tagInfo[1],
-		})
-	}
-	sort.Slice(votesContent, func(i, j int) bool {
-		return votesContent[i]["votes"].(int) > votesContent[j]["votes"].(int)
+	sort.SliceStable(votesContent, func(i, j int) bool {
+		if votesContent[i]["votes"].(int) != votesContent[j]["votes"].(int) {
+			return votesContent[i]["votes"].(int) > votesContent[j]["votes"].(int)
+		}
+		return votesContent[i]["tag"].(string) < votesContent[j]["tag"].(string)
 	})
 	return votesContent
 }
 
+// convertTagVotesToDataMap keeps the most voted tags of a post for its card
+func convertTagVotesToDataMap(tagVotes []database.TagVotes, limit int) []map[string]any {
+	if len(tagVotes) > limit {
+		tagVotes = tagVotes[:limit]
+	}
+	tags := make([]map[string]any, len(tagVotes))
+	for i, tag := range tagVotes {
+		tags[i] = map[string]any{
+			"name":  tag.Name,
+			"votes": tag.Votes,
+			"color": (&model.Tag{Name: tag.Name}).ColorOfTag(),
+		}
+	}
+	return tags
+}
+
 func FindPostsByTagPaginatedPart(c echo.Context) error {
 	locale := utils.GetLocale(c)
 	tagName := c.Param("name")
 	page_str := c.QueryParam("page")
 	page, err := strconv.Atoi(page_str)
-	if err != nil {
+	if err != nil || page < 1 {
 		page = 1
 	}
-	posts_db, err := database.FindPaginatedPostsByTagOrderedByNumberOfVotes(tagName, page, 12)
+	//Aliases show the posts of the tag they stand for
+	description := ""
+	if tag, err := database.ResolveTag(tagName); err == nil {
+		tagName = tag.Name
+		description = tag.Description
+	}
+	sortBy := c.QueryParam("sort")
+	viewer := viewerOf(c)
+	var posts_db []model.Post
+	if sortBy == "recent" {
+		posts_db, err = database.FindPaginatedPostsByTagOrderedByDate(viewer, tagName, page, 12)
+	} else {
+		sortBy = "votes"
+		posts_db, err = database.FindPaginatedPostsByTagOrderedByNumberOfVotes(viewer, tagName, page, 12)
+	}
 	if err != nil {
 		return c.String(500, "Internal Server Error")
 	}
@@ -1457,16 +1915,27 @@ func FindPostsByTagPaginatedPart(c echo.Context) error {
 	more := len(posts_db) == 12
 	next_page_loader := ""
 	if more {
-		next_page_loader = fmt.Sprintf("/posts/all/tag/%s?page=%d", tagName, next_page)
+		next_page_loader = fmt.Sprintf("/posts/all/tag/%s?which=part&sort=%s&page=%d", url.PathEscape(tagName), sortBy, next_page)
 	}
 	data := map[string]any{
-		"posts":    posts_content,
-		"nextPage": template.HTML(next_page_loader), //skipcq  GSC-G203
-		"more":     more,
-		"locale":   locale,
-		"tag":      tagName,
+		"posts":       posts_content,
+		"nextPage":    next_page_loader,
+		"more":        more,
+		"locale":      locale,
+		"tag":         tagName,
+		"sort":        sortBy,
+		"first":       page == 1,
+		"description": description,
+		"feed_url":    "/posts/all/tag/" + url.PathEscape(tagName) + "/feed",
+	}
+	if page == 1 {
+		postsCount, votesCount, err := database.CountPostsAndVotesOfTag(tagName)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		data["summary"] = fmt.Sprintf(utils.Translate(locale, "tag_page_summary"), postsCount, votesCount)
 	}
-	return c.Render(200, "posts", data)
+	return c.Render(200, "tag_page", data)
 }
 
 func FindPostsByTagPaginatedFull(c echo.Context) error {
@@ -1484,7 +1953,7 @@ func FindPostsByTagPaginatedFull(c echo.Context) error {
 	}
 	isModerator := IsModerator(c)
 	isAdmin := IsAdmin(c)
-	pageToLoad := fmt.Sprintf("/posts/all/tag/%s?which=part&page=%d", tagName, page)
+	pageToLoad := fmt.Sprintf("/posts/all/tag/%s?which=part&page=%d&sort=%s", url.PathEscape(tagName), page, url.QueryEscape(c.QueryParam("sort")))
 	data := map[string]any{
 		"app_title":       "Portfol.io",
 		"locale":          locale,
@@ -1494,6 +1963,15 @@ func FindPostsByTagPaginatedFull(c echo.Context) error {
 		"isActive":        user.Active,
 		"page_to_load":    pageToLoad,
 	}
+	//The posts come later, crawlers at least get to know what the page is about
+	if tag, err := database.ResolveTag(tagName); err == nil && !tag.Banned {
+		description := tag.Description
+		if description == "" {
+			description = fmt.Sprintf(utils.Translate(locale, "feeds_tag_title"), tag.Name)
+		}
+		data["meta"] = pageMeta(c, "website", "#"+tag.Name, shortenText(description, metaDescriptionLength),
+			"/posts/all/tag/"+url.PathEscape(tag.Name), "")
+	}
 	return c.Render(200, "full_page_load", data)
 }
 
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+	xhtml "golang.org/x/net/html"
+)
+
+const (
+	previewFeedbackMaxLength = 2000
+	previewNameMaxLength     = 50
+)
+
+func newPreviewToken() (string, error) {
+	token := make([]byte, 24)
+	_, err := rand.Read(token)
+	return base64.RawURLEncoding.EncodeToString(token), err
+}
+
+// findDraftOfAuthor returns the post in the url if the user of the session wrote it, only drafts can be previewed
+func findDraftOfAuthor(c echo.Context) (model.Post, model.User, error) {
+	post, err := findPostOfURL(c)
+	if err != nil || post.OwnerType == "project" {
+		return post, model.User{}, echo.ErrNotFound
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active || user.Username != post.Author {
+		return post, user, echo.ErrUnauthorized
+	}
+	return post, user, nil
+}
+
+func renderPreviewLinks(c echo.Context, post model.Post, form_errors map[string]string) error {
+	locale := utils.GetLocale(c)
+	links, err := database.FindPreviewLinksOfPost(post.ID)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	feedback, err := database.FindFeedbackOfPost(post.ID)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	images, err := imagesOfPreview(post)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	base := siteURL(c)
+	linksData := make([]map[string]any, len(links))
+	for i, link := range links {
+		linksData[i] = map[string]any{
+			"id":            link.ID,
+			"url":           base + "/preview/" + link.Token,
+			"expiresAt":     link.ExpiresAt.Format("2006-01-02 15:04"),
+			"expired":       link.Expired(),
+			"allowFeedback": link.AllowFeedback,
+		}
+	}
+	expirations := make([]map[string]any, len(model.PREVIEW_EXPIRATIONS))
+	for i, days := range model.PREVIEW_EXPIRATIONS {
+		expirations[i] = map[string]any{
+			"days":     days,
+			"label":    "previews_expires_" + strconv.Itoa(days),
+			"selected": i == 1,
+		}
+	}
+	data := map[string]any{
+		"locale":      locale,
+		"type":        post.OwnerType,
+		"owner_id":    post.OwnerID,
+		"links":       linksData,
+		"feedback":    convertFeedbackToDataMap(feedback, locale, images),
+		"expirations": expirations,
+		"canCreate":   post.IsDraft() && len(links) < model.PREVIEW_LINKS_MAX,
+		"errors":      form_errors,
+	}
+	return c.Render(200, "preview_links", data)
+}
+
+// convertFeedbackToDataMap shows each entry next to what it is about, images are the ones of the gallery
+func convertFeedbackToDataMap(feedback []model.PreviewFeedback, locale string, images []model.Image) []map[string]any {
+	feedbackData := make([]map[string]any, len(feedback))
+	for i, entry := range feedback {
+		name := entry.Name
+		if name == "" {
+			name = utils.Translate(locale, "previews_feedback_anonymous")
+		}
+		feedbackData[i] = map[string]any{
+			"id":        entry.ID,
+			"name":      name,
+			"quote":     entry.Quote,
+			"locale":    locale,
+			"content":   entry.Content,
+			"createdAt": entry.CreatedAt.Format("2006-01-02 15:04"),
+		}
+		for position, image := range images {
+			if image.ID == entry.ImageID {
+				feedbackData[i]["image_id"] = image.ID
+				feedbackData[i]["image_url"] = image.ThumbURL
+				feedbackData[i]["image_position"] = position + 1
+			}
+		}
+	}
+	return feedbackData
+}
+
+// imagesOfPreview returns the images feedback can point to, articles have none
+func imagesOfPreview(post model.Post) ([]model.Image, error) {
+	if post.OwnerType != "gallery" {
+		return nil, nil
+	}
+	gallery, err := database.FindGalleryByID(post.OwnerID)
+	return gallery.Images, err
+}
+
+// previewFeedbackAnchor checks that the quote is a passage of the article or the image one of the gallery,
+// whitespace is ignored since the browser does not keep the one of the html
+func previewFeedbackAnchor(post model.Post, quote, image string) (string, uint64, bool) {
+	quote = strings.Join(strings.Fields(quote), " ")
+	switch post.OwnerType {
+	case "article":
+		if quote == "" {
+			return "", 0, true
+		}
+		if len([]rune(quote)) > model.PREVIEW_FEEDBACK_QUOTE_MAX {
+			return quote, 0, false
+		}
+		article, err := database.FindArticleByID(post.OwnerID)
+		if err != nil {
+			return quote, 0, false
+		}
+		doc, err := xhtml.Parse(strings.NewReader(article.Content))
+		if err != nil {
+			return quote, 0, false
+		}
+		text := strings.Join(strings.Fields(textContent(doc)), "")
+		return quote, 0, strings.Contains(text, strings.Join(strings.Fields(quote), ""))
+	case "gallery":
+		if image == "" {
+			return "", 0, true
+		}
+		id, err := strconv.ParseUint(image, 10, 64)
+		if err != nil {
+			return "", 0, false
+		}
+		images, err := imagesOfPreview(post)
+		if err != nil {
+			return "", 0, false
+		}
+		for _, galleryImage := range images {
+			if galleryImage.ID == id {
+				return "", id, true
+			}
+		}
+		return "", 0, false
+	}
+	return "", 0, true
+}
+
+// GetPreviewLinks lists the links the author shared and the feedback left through them
+func GetPreviewLinks(c echo.Context) error {
+	post, _, err := findDraftOfAuthor(c)
+	if err != nil {
+		return c.NoContent(200)
+	}
+	return renderPreviewLinks(c, post, nil)
+}
+
+func CreatePreviewLink(c echo.Context) error {
+	post, user, err := findDraftOfAuthor(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	if !post.IsDraft() {
+		return c.String(400, "Bad Request")
+	}
+	days, err := strconv.Atoi(c.FormValue("expires"))
+	if err != nil || !slices.Contains(model.PREVIEW_EXPIRATIONS, days) {
+		return c.String(400, "Bad Request")
+	}
+	token, err := newPreviewToken()
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	link := model.PreviewLink{
+		PostID:        post.ID,
+		Token:         token,
+		AllowFeedback: c.FormValue("feedback") == "on",
+		CreatedBy:     user.Username,
+		ExpiresAt:     time.Now().AddDate(0, 0, days),
+	}
+	err = database.CreatePreviewLink(&link)
+	if err == database.ErrTooManyPreviewLinks {
+		locale := utils.GetLocale(c)
+		return renderPreviewLinks(c, post, map[string]string{"other": utils.Translate(locale, "previews_too_many_error")})
+	}
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPreviewLinks(c, post, nil)
+}
+
+// RevokePreviewLink removes the link, whoever has it can no longer open the draft
+func RevokePreviewLink(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	link, err := database.FindPreviewLinkByID(id)
+	if err != nil || link.Post.Author != user.Username {
+		return c.String(404, "Not Found")
+	}
+	err = database.DeletePreviewLink(&link)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPreviewLinks(c, link.Post, nil)
+}
+
+func DeletePreviewFeedback(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	feedback, err := database.FindPreviewFeedbackByID(id)
+	if err != nil || feedback.Post.Author != user.Username {
+		return c.String(404, "Not Found")
+	}
+	err = database.DeletePreviewFeedback(&feedback)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderPreviewLinks(c, feedback.Post, nil)
+}
+
+// GetPreview shows the draft to whoever has a valid link. Once the post is published the link takes to it and
+// its visibility decides who can read it.
+func GetPreview(c echo.Context) error {
+	link, err := database.FindValidPreviewLink(c.Param("token"))
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	post := link.Post
+	if !post.IsDraft() {
+		return c.Redirect(302, postPath(post.OwnerType, post.OwnerID, post.Slug))
+	}
+	locale := utils.GetLocale(c)
+	user, err := GetUserOfSession(c)
+	isAuthenticated := err == nil
+	data := map[string]any{
+		"locale":          locale,
+		"type":            post.OwnerType,
+		"title":           post.Title,
+		"author":          post.Author,
+		"coauthors":       coAuthorNames(post.OwnerType, post.OwnerID),
+		"expiresAt":       link.ExpiresAt.Format("2006-01-02 15:04"),
+		"IsAuthenticated": isAuthenticated,
+		"IsModerator":     isAuthenticated && user.Authority.Level == model.AUTH_MODERATOR.Level,
+		"IsAdmin":         isAuthenticated && user.Authority.Level == model.AUTH_ADMIN.Level,
+		"isActive":        user.Active,
+		"app_title":       "Portfol.io",
+	}
+	switch post.OwnerType {
+	case "article":
+		article, err := database.FindArticleByID(post.OwnerID)
+		if err != nil {
+			return c.String(404, "Not Found")
+		}
+		data["content"], data["toc"] = articleContent(article.Content)
+	case "gallery":
+		gallery, err := database.FindGalleryByID(post.OwnerID)
+		if err != nil {
+			return c.String(404, "Not Found")
+		}
+		data["images"] = convertImagesToDataMap(gallery.Images, gallery.CoverID, "feedback", link.AllowFeedback)
+	default:
+		return c.String(404, "Not Found")
+	}
+	if link.AllowFeedback {
+		feedback, err := previewFeedbackData(c, link, nil, nil)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		data["feedback"] = feedback
+	}
+	c.Response().Header().Set("X-Robots-Tag", "noindex, nofollow")
+	return c.Render(200, "preview_full", data)
+}
+
+func previewFeedbackData(c echo.Context, link model.PreviewLink, form_errors, formValues map[string]string) (map[string]any, error) {
+	locale := utils.GetLocale(c)
+	feedback, err := database.FindFeedbackOfPreviewLink(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	images, err := imagesOfPreview(link.Post)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"locale":     locale,
+		"token":      link.Token,
+		"type":       link.Post.OwnerType,
+		"quoteMax":   model.PREVIEW_FEEDBACK_QUOTE_MAX,
+		"entries":    convertFeedbackToDataMap(feedback, locale, images),
+		"errors":     form_errors,
+		"formValues": formValues,
+	}, nil
+}
+
+// LeavePreviewFeedback stores a comment on the draft, reviewers do not need to sign in
+func LeavePreviewFeedback(c echo.Context) error {
+	link, err := database.FindValidPreviewLink(c.Param("token"))
+	if err != nil || !link.AllowFeedback || !link.Post.IsDraft() {
+		return c.String(404, "Not Found")
+	}
+	locale := utils.GetLocale(c)
+	name, content := strings.TrimSpace(c.FormValue("name")), strings.TrimSpace(c.FormValue("content"))
+	quote, imageID, ok := previewFeedbackAnchor(link.Post, c.FormValue("quote"), c.FormValue("image"))
+	formValues := map[string]string{"name": name, "content": content, "quote": quote, "image": c.FormValue("image")}
+	form_errors := make(map[string]string)
+	if !ok {
+		form_errors["anchor"] = utils.Translate(locale, "previews_feedback_anchor_error")
+	}
+	if len([]rune(name)) > previewNameMaxLength {
+		form_errors["name"] = utils.Translate(locale, "previews_feedback_name_too_long_error")
+	}
+	if content == "" {
+		form_errors["content"] = utils.Translate(locale, "previews_feedback_empty_error")
+	} else if len([]rune(content)) > previewFeedbackMaxLength {
+		form_errors["content"] = utils.Translate(locale, "previews_feedback_too_long_error")
+	}
+	if len(form_errors) == 0 {
+		err = database.CreatePreviewFeedback(&model.PreviewFeedback{
+			PostID:        link.PostID,
+			PreviewLinkID: link.ID,
+			Name:          name,
+			Quote:         quote,
+			ImageID:       imageID,
+			Content:       content,
+		})
+		switch {
+		case err == database.ErrTooMuchPreviewFeedback:
+			form_errors["content"] = utils.Translate(locale, "previews_feedback_limit_error")
+		case err != nil:
+			return c.String(500, "Internal Server Error")
+		default:
+			form_errors, formValues = nil, nil
+		}
+	}
+	data, err := previewFeedbackData(c, link, form_errors, formValues)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return c.Render(200, "preview_feedback", data)
+}
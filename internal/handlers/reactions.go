@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+var reactionEmojis = map[string]string{
+	model.REACTION_LIKE:       "👍",
+	model.REACTION_INSIGHTFUL: "💡",
+	model.REACTION_INSPIRING:  "✨",
+	model.REACTION_FUNNY:      "😄",
+}
+
+// convertReactionCountsToDataMap lists the reactions a post received, in the usual order and skipping the empty ones
+func convertReactionCountsToDataMap(counts map[string]int64) []map[string]any {
+	var reactions []map[string]any
+	for _, kind := range model.REACTIONS {
+		if counts[kind] == 0 {
+			continue
+		}
+		reactions = append(reactions, map[string]any{
+			"kind":  kind,
+			"emoji": reactionEmojis[kind],
+			"label": "reactions_" + kind,
+			"count": counts[kind],
+		})
+	}
+	return reactions
+}
+
+func GetReactions(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, _ := GetUserOfSession(c)
+	if !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) {
+		return c.String(401, "Unauthorized")
+	}
+	return renderReactions(c, post, user)
+}
+
+func renderReactions(c echo.Context, post model.Post, user model.User) error {
+	counts, err := database.CountReactionsOfPosts([]uint64{post.ID})
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	var mine []string
+	saved := false
+	if user.Username != "" {
+		mine, err = database.FindReactionKindsOfUser(user.Username, post.ID)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		saved, err = database.IsPostSaved(user.Username, post.ID)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+	}
+	reactions := make([]map[string]any, len(model.REACTIONS))
+	for i, kind := range model.REACTIONS {
+		reactions[i] = map[string]any{
+			"kind":  kind,
+			"emoji": reactionEmojis[kind],
+			"label": "reactions_" + kind,
+			"count": counts[post.ID][kind],
+			"mine":  slices.Contains(mine, kind),
+		}
+	}
+	data := map[string]any{
+		"locale":          utils.GetLocale(c),
+		"type":            post.OwnerType,
+		"owner_id":        post.OwnerID,
+		"reactions":       reactions,
+		"isAuthenticated": user.Username != "",
+		"canReact":        user.Username != "" && !post.IsDraft(),
+		"saved":           saved,
+	}
+	return c.Render(200, "reactions", data)
+}
+
+func ToggleReaction(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	if post.IsDraft() || !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) {
+		return c.String(403, "Forbidden")
+	}
+	kind := c.FormValue("kind")
+	if !slices.Contains(model.REACTIONS, kind) {
+		return c.String(400, "Bad Request")
+	}
+	_, err = database.ToggleReaction(user.Username, post.ID, kind)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderReactions(c, post, user)
+}
+
+func ToggleSavedPost(c echo.Context) error {
+	post, err := findPostOfURL(c)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	if !canSeePost(user.Username, post.OwnerType, post.OwnerID, post.BasePost) {
+		return c.String(403, "Forbidden")
+	}
+	_, err = database.ToggleSavedPost(user.Username, post.ID)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderReactions(c, post, user)
+}
+
+func SavedPostsPaginated(c echo.Context) error {
+	which := c.QueryParam("which")
+	if which == "part" {
+		return SavedPostsPaginatedPart(c)
+	}
+	return SavedPostsPaginatedFull(c)
+}
+
+func SavedPostsPaginatedFull(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"app_title":       "Portfol.io",
+		"locale":          utils.GetLocale(c),
+		"IsAuthenticated": true,
+		"IsModerator":     IsModerator(c),
+		"IsAdmin":         IsAdmin(c),
+		"isActive":        user.Active,
+		"page_to_load":    "/saved?which=part",
+	}
+	return c.Render(200, "full_page_load", data)
+}
+
+func SavedPostsPaginatedPart(c echo.Context) error {
+	locale := utils.GetLocale(c)
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil {
+		page = 1
+	}
+	postsDB, err := database.FindSavedPostsPaginated(user, page, 12)
+	if err != nil {
+		return c.String(404, "Not found")
+	}
+	posts := convertPostsToDataMap(postsDB)
+	more := len(posts) == 12
+	nextPageLoader := ""
+	if more {
+		nextPageLoader = fmt.Sprintf("/saved?page=%d&which=part", page+1)
+	}
+	data := map[string]any{
+		"locale":   locale,
+		"username": user.Username,
+		"posts":    posts,
+		"more":     more,
+		"nextPage": nextPageLoader,
+		"first":    page == 1,
+	}
+	return c.Render(200, "saved_posts", data)
+}
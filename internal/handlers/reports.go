@@ -129,5 +129,11 @@ func GetReport(c echo.Context) error {
 		"description": report.Description,
 		"createdAt":   report.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
+	//The reported comment may have been deleted already
+	if report.CommentID != 0 {
+		if _, err := database.FindCommentByID(report.CommentID); err == nil {
+			data["comment_id"] = report.CommentID
+		}
+	}
 	return c.Render(200, "report", data)
 }
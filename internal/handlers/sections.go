@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// validateSection checks the fields of the section forms, current is nil when the section is being created
+func validateSection(locale string, user model.User, name, description, visibility string, current *model.Section) map[string]string {
+	form_errors := make(map[string]string)
+	if utf8.RuneCountInString(name) < model.SECTION_NAME_MIN_LEN {
+		form_errors["name"] = utils.Translate(locale, "section_new_name_short_error") + ". "
+	}
+	if name == user.Username {
+		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_new_name_invalid_error") + ". "
+	}
+	if slices.Contains(model.RESERVED_SECTION_NAMES, strings.ToLower(name)) {
+		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_name_reserved_error") + ". "
+	}
+	if strings.ContainsAny(name, "/?#") {
+		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_name_characters_error") + ". "
+	}
+	existing, err := database.FindSectionByUsernameAndName(user.Username, name)
+	if err == nil && (current == nil || existing.ID != current.ID) {
+		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_new_name_taken_error") + ". "
+	}
+	if utf8.RuneCountInString(description) > model.SECTION_DESCRIPTION_MAX {
+		form_errors["description"] = fmt.Sprintf(utils.Translate(locale, "section_description_too_long"), model.SECTION_DESCRIPTION_MAX)
+	}
+	if !slices.Contains(model.SECTION_VISIBILITIES, visibility) {
+		form_errors["visibility"] = utils.Translate(locale, "section_visibility_invalid")
+	}
+	return form_errors
+}
+
+func sectionVisibilityOptions(selected string) []map[string]any {
+	if selected == "" {
+		selected = model.SECTION_PUBLIC
+	}
+	options := make([]map[string]any, len(model.SECTION_VISIBILITIES))
+	for i, visibility := range model.SECTION_VISIBILITIES {
+		options[i] = map[string]any{
+			"name":        visibility,
+			"label":       "section_visibility_" + visibility,
+			"description": "section_visibility_" + visibility + "_description",
+			"selected":    visibility == selected,
+		}
+	}
+	return options
+}
+
+func sectionsListData(username string) ([]map[string]any, error) {
+	sections, err := database.FindSectionsByUser(username)
+	if err != nil {
+		return nil, err
+	}
+	sections_list := make([]map[string]any, len(sections))
+	for i, section := range sections {
+		sections_list[i] = map[string]any{
+			"name":        section.Name,
+			"description": section.Description,
+			"visibility":  section.Visibility,
+			"listed":      section.IsListed(),
+			"first":       i == 0,
+			"last":        i == len(sections)-1,
+		}
+	}
+	return sections_list, nil
+}
+
+// sectionPostsOrderData lists the posts of the section in the order visitors see them
+func sectionPostsOrderData(locale, username string, section model.Section) (map[string]any, error) {
+	posts, err := database.FindPostsInSectionOrdered(&section, model.SECTION_POSTS_ORDER_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	postsData := make([]map[string]any, len(posts))
+	for i, post := range posts {
+		postsData[i] = map[string]any{
+			"id":        post.ID,
+			"title":     post.Title,
+			"type":      post.OwnerType,
+			"published": post.Published,
+			"first":     i == 0,
+			"last":      i == len(posts)-1,
+		}
+	}
+	return map[string]any{
+		"locale":   locale,
+		"username": username,
+		"name":     section.Name,
+		"posts":    postsData,
+	}, nil
+}
+
+func renderSectionEdit(c echo.Context, user model.User, section model.Section, form map[string]any) error {
+	locale := utils.GetLocale(c)
+	order, err := sectionPostsOrderData(locale, user.Username, section)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	data := map[string]any{
+		"locale":       locale,
+		"username":     user.Username,
+		"name":         section.Name,
+		"new_name":     section.Name,
+		"description":  section.Description,
+		"visibilities": sectionVisibilityOptions(section.Visibility),
+		"order":        order,
+	}
+	for key, value := range form {
+		data[key] = value
+	}
+	return c.Render(200, "section_edit", data)
+}
+
+// findSectionOfOwner resolves the section in the url for its owner, old names are accepted too
+func findSectionOfOwner(c echo.Context) (model.User, model.Section, error) {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active || user.Username != c.Param("username") {
+		return user, model.Section{}, echo.ErrUnauthorized
+	}
+	section, _, err := database.FindSectionByNameOrAlias(user.Username, c.Param("section"))
+	if err != nil {
+		return user, section, echo.ErrNotFound
+	}
+	return user, section, nil
+}
+
+func sectionErrorResponse(c echo.Context, err error) error {
+	if err == echo.ErrUnauthorized {
+		return c.String(401, "Unauthorized")
+	}
+	return c.String(404, "Not found")
+}
+
+// EditSection renames the section and changes its description and visibility, links with the old name keep working
+func EditSection(c echo.Context) error {
+	locale := utils.GetLocale(c)
+	user, section, err := findSectionOfOwner(c)
+	if err != nil {
+		return sectionErrorResponse(c, err)
+	}
+	name := strings.TrimSpace(c.FormValue("name"))
+	description := strings.TrimSpace(c.FormValue("description"))
+	visibility := c.FormValue("visibility")
+	form_errors := validateSection(locale, user, name, description, visibility, &section)
+	if len(form_errors) > 0 {
+		return renderSectionEdit(c, user, section, map[string]any{
+			"new_name":     name,
+			"description":  description,
+			"visibilities": sectionVisibilityOptions(visibility),
+			"errors":       form_errors,
+		})
+	}
+	oldName := section.Name
+	section.Name = name
+	section.Description = description
+	section.Visibility = visibility
+	err = database.UpdateSection(&section, oldName)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	if oldName != name {
+		c.Response().Header().Set("HX-Push-Url", fmt.Sprintf("/profile/%s/edit/sections/%s", user.Username, url.PathEscape(name)))
+	}
+	return renderSectionEdit(c, user, section, map[string]any{"saved": true})
+}
+
+// BulkEditSectionPosts adds or removes every checked post at once
+func BulkEditSectionPosts(c echo.Context) error {
+	user, section, err := findSectionOfOwner(c)
+	if err != nil {
+		return sectionErrorResponse(c, err)
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return c.String(400, "Bad request")
+	}
+	var postIDs []uint64
+	for _, value := range form["post"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		postIDs = append(postIDs, id)
+		if len(postIDs) == model.SECTION_BULK_MAX_POSTS {
+			break
+		}
+	}
+	switch c.FormValue("action") {
+	case "add":
+		err = database.AddPostsToSection(&section, postIDs)
+	case "remove":
+		err = database.RemovePostsFromSection(&section, postIDs)
+	default:
+		return c.String(400, "Bad request")
+	}
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return renderSectionEdit(c, user, section, nil)
+}
+
+func MoveSectionPost(c echo.Context) error {
+	user, section, err := findSectionOfOwner(c)
+	if err != nil {
+		return sectionErrorResponse(c, err)
+	}
+	postID, err := strconv.ParseUint(c.FormValue("post"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad request")
+	}
+	offset, err := strconv.Atoi(c.FormValue("offset"))
+	if err != nil || (offset != -1 && offset != 1) {
+		return c.String(400, "Bad request")
+	}
+	err = database.MovePostInSection(&section, postID, offset)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	data, err := sectionPostsOrderData(utils.GetLocale(c), user.Username, section)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return c.Render(http.StatusOK, "section_posts_order", data)
+}
+
+// MoveProfileSection changes the order of the sections on the profile, the portfolio shares it
+func MoveProfileSection(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active || user.Username != c.Param("username") {
+		return c.String(401, "Unauthorized")
+	}
+	offset, err := strconv.Atoi(c.FormValue("offset"))
+	if err != nil || (offset != -1 && offset != 1) {
+		return c.String(400, "Bad request")
+	}
+	err = database.MoveSection(user.Username, c.FormValue("section"), offset)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	sections, err := sectionsListData(user.Username)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	data := map[string]any{
+		"locale":   utils.GetLocale(c),
+		"username": user.Username,
+		"sections": sections,
+		"isActive": user.Active,
+	}
+	return c.Render(200, "sections_list", data)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/labstack/echo/v4"
+	xhtml "golang.org/x/net/html"
+)
+
+const metaDescriptionLength = 160
+
+// Pages only meant for the signed in user, crawlers have nothing to find there
+var robotsDisallowed = []string{
+	"/admin/", "/moderation/", "/profile/mine", "/profile/my/", "/saved", "/following",
+	"/article/create", "/article/edit/", "/article/mine", "/gallery/create", "/gallery/edit/", "/gallery/mine",
+	"/gallery/image-upload-form/", "/tag/create", "/login", "/register", "/logout", "/preview/",
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// postPath is the address of an article or gallery, by slug when it has one
+func postPath(postType string, id uint64, slug string) string {
+	if slug == "" {
+		return fmt.Sprintf("/%s/%d", postType, id)
+	}
+	return fmt.Sprintf("/%s/%s", postType, url.PathEscape(slug))
+}
+
+func redirectToSlug(c echo.Context, path string) error {
+	if query := c.QueryString(); query != "" {
+		path += "?" + query
+	}
+	return c.Redirect(http.StatusMovedPermanently, path)
+}
+
+// pageMeta fills the Open Graph and Twitter tags of a page, the image may be empty
+func pageMeta(c echo.Context, kind, title, description, path, image string) map[string]any {
+	return pageMetaAt(siteURL(c), kind, title, description, path, image)
+}
+
+// pageMetaAt is pageMeta for pages served from somewhere else than this site, like exported ones
+func pageMetaAt(base, kind, title, description, path, image string) map[string]any {
+	if strings.HasPrefix(image, "/") {
+		image = base + image
+	}
+	return map[string]any{
+		"type":        kind,
+		"title":       title,
+		"description": description,
+		"url":         base + path,
+		"image":       image,
+	}
+}
+
+// summarizeHTML returns the first words of the text of the content and the first image in it
+func summarizeHTML(content string) (string, string) {
+	doc, err := xhtml.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", ""
+	}
+	image := ""
+	walkElements(doc, "img", func(img *xhtml.Node) {
+		if image == "" {
+			image = attributeOf(img, "src")
+		}
+	})
+	return shortenText(textContent(doc), metaDescriptionLength), image
+}
+
+func shortenText(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > length {
+		return strings.TrimSpace(string(runes[:length-1])) + "…"
+	}
+	return text
+}
+
+func GetSitemap(c echo.Context) error {
+	base := siteURL(c)
+	sitemap := sitemapURLSet{URLs: []sitemapURL{{Loc: base + "/"}}}
+	posts, err := database.FindPostsForSitemap()
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	for _, post := range posts {
+		sitemap.URLs = append(sitemap.URLs, sitemapURL{
+			Loc:     base + postPath(post.OwnerType, post.OwnerID, post.Slug),
+			LastMod: post.UpdatedAt.UTC().Format(time.DateOnly),
+		})
+	}
+	profiles, err := database.FindPublicProfilesForSitemap()
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	for _, profile := range profiles {
+		lastMod := ""
+		if len(profile.UpdatedAt) >= len(time.DateOnly) {
+			lastMod = profile.UpdatedAt[:len(time.DateOnly)]
+		}
+		sitemap.URLs = append(sitemap.URLs, sitemapURL{
+			Loc:     fmt.Sprintf("%s/profile/%s", base, url.PathEscape(profile.Username)),
+			LastMod: lastMod,
+		})
+	}
+	body, err := xml.MarshalIndent(sitemap, "", "  ")
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return c.Blob(200, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+func GetRobots(c echo.Context) error {
+	var robots strings.Builder
+	robots.WriteString("User-agent: *\n")
+	for _, path := range robotsDisallowed {
+		robots.WriteString("Disallow: " + path + "\n")
+	}
+	robots.WriteString("Allow: /\n\nSitemap: " + siteURL(c) + "/sitemap.xml\n")
+	return c.String(200, robots.String())
+}
@@ -0,0 +1,572 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	xhtml "golang.org/x/net/html"
+)
+
+const staticDir = "web/static"
+
+// Stylesheets the portfolio templates link to, they are copied into the assets of the exported site
+var staticSiteAssets = []string{"bootstrap.min.css", "highlight.css", "content.css", "portfolio.css"}
+
+var staticSiteDirs = map[string]string{
+	"article": "articles",
+	"gallery": "galleries",
+	"project": "projects",
+}
+
+// StaticSiteOptions tells the exporter where the site is going to be published and where the live one is
+type StaticSiteOptions struct {
+	Locale  string
+	SiteURL string
+	LiveURL string
+}
+
+// staticSite is a self-contained copy of a portfolio inside a zip, every link between its pages is relative
+type staticSite struct {
+	zip       *zip.Writer
+	renderer  echo.Renderer
+	user      model.User
+	portfolio model.Portfolio
+	options   StaticSiteOptions
+	pages     map[uint64]string
+	images    map[string]string
+	sitemap   []sitemapURL
+}
+
+func GetSiteExport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	return renderSiteExport(c, user)
+}
+
+func renderSiteExport(c echo.Context, user model.User) error {
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+	}
+	export, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_SITE)
+	if err == nil {
+		data["status"] = export.Status
+		data["isPending"] = export.Status == model.EXPORT_PENDING
+		data["isReady"] = export.Status == model.EXPORT_READY
+		data["isFailed"] = export.Status == model.EXPORT_FAILED
+		data["requestedAt"] = export.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	return c.Render(200, "site_export", data)
+}
+
+// RequestSiteExport starts building the static site in the background, only one may be pending at a time
+func RequestSiteExport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	latest, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_SITE)
+	hasPrevious := err == nil
+	if hasPrevious && latest.Status == model.EXPORT_PENDING {
+		return renderSiteExport(c, user)
+	}
+	export := model.DataExport{Owner: user.Username, Kind: model.EXPORT_KIND_SITE, Status: model.EXPORT_PENDING}
+	err = database.CreateDataExport(&export)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	//Only the latest site is kept around
+	if hasPrevious {
+		removeDataExportFile(latest)
+	}
+	options := StaticSiteOptions{
+		Locale:  utils.GetLocale(c),
+		SiteURL: siteURL(c) + "/u/" + user.Username,
+		LiveURL: siteURL(c),
+	}
+	if portfolio.Domain != "" && portfolio.DomainVerified {
+		options.SiteURL = c.Scheme() + "://" + portfolio.Domain
+	}
+	go buildSiteExport(export, user, c.Echo().Renderer, options)
+	return renderSiteExport(c, user)
+}
+
+func DownloadSiteExport(c echo.Context) error {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return c.String(401, "Unauthorized")
+	}
+	export, err := database.FindLatestDataExportByOwner(user.Username, model.EXPORT_KIND_SITE)
+	if err != nil || export.Status != model.EXPORT_READY {
+		return c.String(404, "Not Found")
+	}
+	return c.Attachment(filepath.Join(ExportsDir, export.FileName), user.Username+"_site.zip")
+}
+
+func buildSiteExport(export model.DataExport, user model.User, renderer echo.Renderer, options StaticSiteOptions) {
+	export.FileName = fmt.Sprintf("%s_site_%d.zip", user.Username, time.Now().Unix())
+	err := writeSiteExport(filepath.Join(ExportsDir, export.FileName), renderer, user, options)
+	export.Status = model.EXPORT_READY
+	if err != nil {
+		log.Errorf("Error exporting the site of %s: %v", user.Username, err)
+		removeDataExportFile(export)
+		export.Status = model.EXPORT_FAILED
+		export.FileName = ""
+	}
+	err = database.UpdateDataExport(&export)
+	if err != nil {
+		log.Errorf("Error updating site export of %s: %v", user.Username, err)
+	}
+}
+
+func writeSiteExport(name string, renderer echo.Renderer, user model.User, options StaticSiteOptions) error {
+	err := os.MkdirAll(ExportsDir, 0775)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteStaticSite(file, renderer, user, options)
+}
+
+// WriteStaticSite renders the portfolio of the user with the templates of the live site, only published posts are included
+func WriteStaticSite(w io.Writer, renderer echo.Renderer, user model.User, options StaticSiteOptions) error {
+	portfolio, err := database.FindPortfolioByOwner(user.Username)
+	if err != nil {
+		return err
+	}
+	options.SiteURL = strings.TrimSuffix(options.SiteURL, "/")
+	options.LiveURL = strings.TrimSuffix(options.LiveURL, "/")
+	site := &staticSite{
+		zip:       zip.NewWriter(w),
+		renderer:  renderer,
+		user:      user,
+		portfolio: portfolio,
+		options:   options,
+		pages:     make(map[uint64]string),
+		images:    make(map[string]string),
+	}
+	var posts []model.Post
+	for page := 1; ; page++ {
+		batch, err := database.FindPostsByUserPaginated("", user.Username, page, 50)
+		if err != nil {
+			return err
+		}
+		posts = append(posts, batch...)
+		if len(batch) < 50 {
+			break
+		}
+	}
+	for _, post := range posts {
+		name := post.Slug
+		if name == "" {
+			name = fmt.Sprint(post.OwnerID)
+		}
+		site.pages[post.ID] = fmt.Sprintf("%s/%s.html", staticSiteDirs[post.OwnerType], name)
+	}
+	for _, asset := range staticSiteAssets {
+		err = site.copyStatic(asset, "assets/"+asset)
+		if err != nil {
+			return err
+		}
+	}
+	sections, err := site.writeSections()
+	if err != nil {
+		return err
+	}
+	err = site.writeIndex(sections)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		err = site.writePost(post)
+		if err != nil {
+			return err
+		}
+	}
+	err = site.writeFeeds(posts)
+	if err != nil {
+		return err
+	}
+	err = site.writeSitemap()
+	if err != nil {
+		return err
+	}
+	return site.zip.Close()
+}
+
+func (s *staticSite) copyStatic(name, target string) error {
+	src, err := os.Open(filepath.Join(staticDir, filepath.Clean("/"+name)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := s.zip.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	return err
+}
+
+// image returns the copy of the image in the archive. Only the images of the static folder and of the ImageHosts
+// are copied, the original url is kept for any other or if it could not be downloaded.
+func (s *staticSite) image(url, root string) string {
+	if url == "" {
+		return ""
+	}
+	if name, ok := s.images[url]; ok {
+		return root + name
+	}
+	base := fmt.Sprintf("images/%d", len(s.images)+1)
+	var name string
+	var err error
+	switch {
+	case strings.HasPrefix(url, "/static/") && strings.HasPrefix(mime.TypeByExtension(path.Ext(url)), "image/"):
+		name = base + path.Ext(url)
+		err = s.copyStatic(strings.TrimPrefix(url, "/static/"), name)
+	case strings.HasPrefix(url, "/"):
+		//The application serves no other image itself
+		return url
+	default:
+		name, err = downloadImageToZip(s.zip, base, url)
+	}
+	if errors.Is(err, errImageHostNotAllowed) {
+		return url
+	}
+	if err != nil {
+		log.Errorf("Error copying image %s into the site of %s: %v", url, s.user.Username, err)
+		return url
+	}
+	s.images[url] = name
+	return root + name
+}
+
+// localizeImages points the images inside the html of a post to their copies in the archive
+func (s *staticSite) localizeImages(content, root string) string {
+	doc, err := xhtml.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+	var sources []string
+	walkElements(doc, "img", func(img *xhtml.Node) {
+		sources = append(sources, attributeOf(img, "src"))
+	})
+	for _, src := range sources {
+		local := s.image(src, root)
+		if local == src {
+			continue
+		}
+		content = strings.ReplaceAll(content, `src="`+src+`"`, `src="`+local+`"`)
+		content = strings.ReplaceAll(content, `src="`+html.EscapeString(src)+`"`, `src="`+local+`"`)
+	}
+	return content
+}
+
+// pageData holds what every page of the site shows, root leads from the page back to the top of the site
+func (s *staticSite) pageData(root, kind, path, title, description, image string) map[string]any {
+	theme := s.portfolio.Theme
+	if !slices.Contains(model.THEMES, theme) {
+		theme = model.THEME_CLASSIC
+	}
+	if local := s.image(image, ""); local != image {
+		image = s.options.SiteURL + "/" + local
+	}
+	home_path := ""
+	if root != "" {
+		home_path = root + "index.html"
+	}
+	return map[string]any{
+		"static":     true,
+		"app_title":  "Portfol.io",
+		"locale":     s.options.Locale,
+		"username":   s.user.Username,
+		"name":       displayName(s.user),
+		"avatar":     s.image(s.user.Profile.PfPUrl, root),
+		"headline":   s.portfolio.Headline,
+		"theme":      theme,
+		"static_url": root + "assets",
+		"feed_url":   root + "feed",
+		"home_url":   s.options.LiveURL,
+		"home_path":  home_path,
+		"meta":       pageMetaAt(s.options.SiteURL, kind, title, description, "/"+path, image),
+	}
+}
+
+// relinkCards makes the cards of the posts point to the pages and images of the site
+func (s *staticSite) relinkCards(cards []map[string]any, root string) []map[string]any {
+	var result []map[string]any
+	for _, card := range cards {
+		if card == nil {
+			continue
+		}
+		postID, _ := card["post_id"].(uint64)
+		page, ok := s.pages[postID]
+		if !ok {
+			continue
+		}
+		card["path"] = root + page
+		if url, _ := card["url"].(string); url != "" {
+			card["url"] = s.image(url, root)
+		}
+		result = append(result, card)
+	}
+	return result
+}
+
+// render writes a page of the site and lists it in the sitemap
+func (s *staticSite) render(name, template string, data map[string]any, lastMod time.Time) error {
+	loc := s.options.SiteURL + "/"
+	if name != "index.html" {
+		loc += name
+	}
+	entry := sitemapURL{Loc: loc}
+	if !lastMod.IsZero() {
+		entry.LastMod = lastMod.UTC().Format(time.DateOnly)
+	}
+	s.sitemap = append(s.sitemap, entry)
+	f, err := s.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	return s.renderer.Render(f, template, data, nil)
+}
+
+// writeSections gives each section its own page with all of its posts, returns the page of each section
+func (s *staticSite) writeSections() (map[string]string, error) {
+	sections, err := database.FindSectionsByUser(s.user.Username)
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]string)
+	used := make(map[string]bool)
+	for i, section := range sections {
+		if !section.IsListed() {
+			continue
+		}
+		var posts []model.Post
+		for page := 1; ; page++ {
+			batch, err := database.FindPostsByUserAndSectionPaginated("", s.user.Username, section.Name, page, 50)
+			if err != nil {
+				return nil, err
+			}
+			posts = append(posts, batch...)
+			if len(batch) < 50 {
+				break
+			}
+		}
+		if len(posts) == 0 {
+			continue
+		}
+		name := model.Slugify(section.Name)
+		if name == "" {
+			name = "section"
+		}
+		if used[name] {
+			name = fmt.Sprintf("%s-%d", name, i+1)
+		}
+		used[name] = true
+		page := "sections/" + name + ".html"
+		pages[section.Name] = page
+		description := fmt.Sprintf(utils.Translate(s.options.Locale, "seo_profile_description"), displayName(s.user))
+		data := s.pageData("../", "website", page, section.Name, description, "")
+		data["sections"] = []map[string]any{{
+			"name":  section.Name,
+			"posts": s.relinkCards(convertPostsToDataMap(posts), "../"),
+		}}
+		err := s.render(page, "portfolio", data, posts[0].UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+func (s *staticSite) writeIndex(sectionPages map[string]string) error {
+	data, err := portfolioData(s.user, s.portfolio, s.options.Locale)
+	if err != nil {
+		return err
+	}
+	for key, value := range s.pageData("", "profile", "", displayName(s.user), portfolioDescription(s.user, s.portfolio, s.options.Locale), s.user.Profile.PfPUrl) {
+		data[key] = value
+	}
+	data["featured"] = s.relinkCards(data["featured"].([]map[string]any), "")
+	data["latest"] = s.relinkCards(data["latest"].([]map[string]any), "")
+	sections, _ := data["sections"].([]map[string]any)
+	for _, section := range sections {
+		section["posts"] = s.relinkCards(section["posts"].([]map[string]any), "")
+		section["path"] = sectionPages[section["name"].(string)]
+	}
+	return s.render("index.html", "portfolio", data, s.portfolio.UpdatedAt)
+}
+
+// writePost renders the post with the same templates as its live page, without the parts that need the server
+func (s *staticSite) writePost(post model.Post) error {
+	page := s.pages[post.ID]
+	var data map[string]any
+	view := "article_full"
+	switch post.OwnerType {
+	case "article":
+		article, err := database.FindArticleByID(post.OwnerID)
+		if err != nil {
+			return err
+		}
+		description, image := summarizeHTML(article.Content)
+		data = s.pageData("../", "article", page, article.Title, description, image)
+		content, toc := articleContent(article.Content)
+		data["content"] = template.HTML(s.localizeImages(string(content), "../")) //skipcq  GSC-G203
+		data["toc"] = toc
+		data["coauthors"] = coAuthorNames("article", article.ID)
+		tags, err := database.GetFirstFiftyMostVotedTagsForArticle(article.ID)
+		if err != nil {
+			return err
+		}
+		data["tags"] = tagNames(tags)
+	case "gallery":
+		gallery, err := database.FindGalleryByID(post.OwnerID)
+		if err != nil {
+			return err
+		}
+		cover := ""
+		if image, ok := gallery.Cover(); ok {
+			cover = image.ImageURL
+		}
+		description := fmt.Sprintf(utils.Translate(s.options.Locale, "seo_gallery_description"), len(gallery.Images), gallery.Author)
+		data = s.pageData("../", "article", page, gallery.Title, description, cover)
+		images := convertImagesToDataMap(gallery.Images, gallery.CoverID)
+		for _, image := range images {
+			image["image_url"] = s.image(image["image_url"].(string), "../")
+			//The variants are not copied, the browser gets the original
+			image["srcset"] = ""
+		}
+		data["images"] = images
+		data["coauthors"] = coAuthorNames("gallery", gallery.ID)
+		tags, err := database.GetFirstFiftyMostVotedTagsForGallery(gallery.ID)
+		if err != nil {
+			return err
+		}
+		data["tags"] = tagNames(tags)
+		view = "gallery_full"
+	case "project":
+		project, err := database.FindProjectByID(post.OwnerID)
+		if err != nil {
+			return err
+		}
+		data = s.pageData("../", "article", page, project.Title, shortenText(project.Description, metaDescriptionLength), "")
+		content := "<p>" + html.EscapeString(project.Description) + "</p>"
+		if project.Link != "" {
+			link := html.EscapeString(project.Link)
+			content += `<p><a href="` + link + `" target="_blank" rel="noopener">` + link + "</a></p>"
+		}
+		data["content"] = template.HTML(content) //skipcq  GSC-G203
+	default:
+		return nil
+	}
+	data["id"] = post.OwnerID
+	data["title"] = post.Title
+	data["author"] = post.Author
+	data["createdAt"] = post.CreatedAt
+	data["updatedAt"] = post.UpdatedAt
+	data["published"] = true
+	return s.render(page, view, data, post.UpdatedAt)
+}
+
+func tagNames(tags []model.Tag) []string {
+	names := make([]string, len(tags))
+	for i := range tags {
+		names[i] = tags[i].Name
+	}
+	return names
+}
+
+// writeFeeds writes the same three formats the live site offers, pointing to the pages of the site
+func (s *staticSite) writeFeeds(posts []model.Post) error {
+	if len(posts) > feedSize {
+		posts = posts[:feedSize]
+	}
+	feed := syndicationFeed{
+		Title:       fmt.Sprintf(utils.Translate(s.options.Locale, "feeds_user_title"), displayName(s.user)),
+		Description: s.user.Profile.Bio,
+		HomeURL:     s.options.SiteURL + "/",
+		Entries:     feedEntriesOfPosts(s.options.SiteURL, posts),
+	}
+	pages := make(map[string]string)
+	for _, post := range posts {
+		if post.UpdatedAt.After(feed.Updated) {
+			feed.Updated = post.UpdatedAt
+		}
+		pages[fmt.Sprintf("%s/%s/%d", s.options.SiteURL, post.OwnerType, post.OwnerID)] = s.pages[post.ID]
+	}
+	for i := range feed.Entries {
+		feed.Entries[i].URL = s.options.SiteURL + "/" + pages[feed.Entries[i].ID]
+		feed.Entries[i].AuthorURL = s.options.SiteURL + "/"
+		for j, enclosure := range feed.Entries[i].Enclosures {
+			if name, ok := s.images[enclosure.URL]; ok {
+				feed.Entries[i].Enclosures[j].URL = s.options.SiteURL + "/" + name
+			}
+		}
+	}
+	for _, format := range []string{FEED_FORMAT_RSS, FEED_FORMAT_ATOM, FEED_FORMAT_JSON} {
+		feed.FeedURL = s.options.SiteURL + "/feed." + format
+		var body []byte
+		var err error
+		switch format {
+		case FEED_FORMAT_RSS:
+			body, err = feed.rss()
+		case FEED_FORMAT_ATOM:
+			body, err = feed.atom()
+		default:
+			body, err = feed.json()
+		}
+		if err != nil {
+			return err
+		}
+		f, err := s.zip.Create("feed." + format)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *staticSite) writeSitemap() error {
+	body, err := xml.MarshalIndent(sitemapURLSet{URLs: s.sitemap}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := s.zip.Create("sitemap.xml")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append([]byte(xml.Header), body...))
+	return err
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const tagDescriptionMaxLength = 500
+
+var ErrTagNotAllowed = errors.New("tag name not allowed")
+
+func isActiveModerator(c echo.Context) bool {
+	user, err := GetUserOfSession(c)
+	return err == nil && user.Active && isModeratorUser(user)
+}
+
+// renderTagsFeedback tells the moderator how the last action went, the list is reloaded when it changed something
+func renderTagsFeedback(c echo.Context, key string, success bool, args ...any) error {
+	locale := utils.GetLocale(c)
+	if success {
+		c.Response().Header().Set("HX-Trigger", "tags-reload")
+	}
+	data := map[string]any{
+		"locale":  locale,
+		"message": fmt.Sprintf(utils.Translate(locale, key), args...),
+		"success": success,
+	}
+	return c.Render(200, "tags_moderation_feedback", data)
+}
+
+func GetTagsModerationTab(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+	}
+	return c.Render(200, "tags_moderation", data)
+}
+
+func GetTagsForModeration(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil {
+		page = 1
+	}
+	query := model.NormalizeTagName(c.QueryParam("query"))
+	tagsDB, err := database.FindTagsForModerationPaginated(query, page, 20)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	tags := make([]map[string]any, len(tagsDB))
+	for i, tag := range tagsDB {
+		tags[i] = map[string]any{
+			"id":          tag.ID,
+			"name":        tag.Name,
+			"description": tag.Description,
+			"votes":       tag.Votes,
+			"banned":      tag.Banned,
+			"aliasOf":     tag.AliasOfName,
+			"color":       tag.ColorOfTag(),
+		}
+	}
+	more := len(tagsDB) == 20
+	nextPageLoader := ""
+	if more {
+		nextPageLoader = fmt.Sprintf("/moderation/tags/list?page=%d&query=%s", page+1, url.QueryEscape(query))
+	}
+	data := map[string]any{
+		"locale": utils.GetLocale(c),
+		"tags":   tags,
+		"more":   more,
+		"next":   nextPageLoader,
+	}
+	return c.Render(200, "tags_moderation_list", data)
+}
+
+// AliasTag makes name stand for target. If name was already a tag its votes are merged into target.
+func AliasTag(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	name := model.NormalizeTagName(c.FormValue("name"))
+	targetName := model.NormalizeTagName(c.FormValue("target"))
+	if name == "" || targetName == "" {
+		return renderTagsFeedback(c, "tags_moderation_invalid_name", false)
+	}
+	target, err := database.ResolveTag(targetName)
+	if err != nil {
+		return renderTagsFeedback(c, "tags_moderation_target_not_found", false, targetName)
+	}
+	if target.Banned {
+		return renderTagsFeedback(c, "tags_moderation_target_banned", false, target.Name)
+	}
+	if target.Name == name {
+		return renderTagsFeedback(c, "tags_moderation_same_tag", false)
+	}
+	source, err := database.FindTagByName(name)
+	if err != nil {
+		alias := model.Tag{Name: name, AliasOfID: target.ID}
+		err = database.CreateTag(&alias)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+		return renderTagsFeedback(c, "tags_moderation_alias_created", true, name, target.Name)
+	}
+	err = database.MergeTags(&source, &target)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderTagsFeedback(c, "tags_moderation_merged", true, name, target.Name)
+}
+
+// BanTagName bans the name even when no one has used it yet
+func BanTagName(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	name := model.NormalizeTagName(c.FormValue("name"))
+	if name == "" {
+		return renderTagsFeedback(c, "tags_moderation_invalid_name", false)
+	}
+	tag, err := database.FindTagByName(name)
+	if err != nil {
+		tag = model.Tag{Name: name}
+		err = database.CreateTag(&tag)
+		if err != nil {
+			return c.String(500, "Internal Server Error")
+		}
+	}
+	if tag.AliasOfID != 0 {
+		return renderTagsFeedback(c, "tags_moderation_is_alias", false, name)
+	}
+	err = database.BanTag(&tag)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderTagsFeedback(c, "tags_moderation_banned", true, name)
+}
+
+func UnbanTagName(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	tag, err := database.FindTagByName(model.NormalizeTagName(c.FormValue("name")))
+	if err != nil {
+		return renderTagsFeedback(c, "tags_moderation_target_not_found", false, c.FormValue("name"))
+	}
+	err = database.UnbanTag(&tag)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderTagsFeedback(c, "tags_moderation_unbanned", true, tag.Name)
+}
+
+func ChangeTagDescription(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	tag, err := database.FindTagByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	if tag.AliasOfID != 0 {
+		return renderTagsFeedback(c, "tags_moderation_is_alias", false, tag.Name)
+	}
+	description := strings.TrimSpace(c.FormValue("description"))
+	if len([]rune(description)) > tagDescriptionMaxLength {
+		return renderTagsFeedback(c, "tags_moderation_description_too_long", false, tagDescriptionMaxLength)
+	}
+	err = database.UpdateTagDescription(&tag, description)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderTagsFeedback(c, "tags_moderation_description_saved", true, tag.Name)
+}
+
+func DeleteTagAlias(c echo.Context) error {
+	if !isActiveModerator(c) {
+		return c.String(401, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	tag, err := database.FindTagByID(id)
+	if err != nil || tag.AliasOfID == 0 {
+		return c.String(404, "Not Found")
+	}
+	err = database.DeleteTagAlias(&tag)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return renderTagsFeedback(c, "tags_moderation_alias_deleted", true, tag.Name)
+}
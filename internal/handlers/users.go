@@ -7,9 +7,11 @@ import (
 	"io"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
@@ -367,6 +369,8 @@ func DeleteProfile(c echo.Context) error {
 	if err != nil {
 		return c.Render(401, "error", nil)
 	}
+	removeDataExports(user.Username)
+	removeStagedImports(user.Username)
 	err = database.DeleteUser(&user)
 	if err != nil {
 		return c.Render(500, "error", nil)
@@ -486,9 +490,14 @@ func EditProfile(c echo.Context) error {
 		if err != nil {
 			form_errors["avatar"] = utils.Translate(locale, "profile_edit_avatar_server_error")
 		}
-		urls, err = uploadImageToImgbb(avatar_bytes)
+		avatar_bytes, err = processSingleImage(avatar_bytes, avatarWidths)
 		if err != nil {
-			form_errors["avatar"] = utils.Translate(locale, "profile_edit_avatar_server_error")
+			form_errors["avatar"] = utils.Translate(locale, imageErrorKey(err))
+		} else {
+			urls, err = uploadImageToImgbb(avatar_bytes)
+			if err != nil {
+				form_errors["avatar"] = utils.Translate(locale, "profile_edit_avatar_server_error")
+			}
 		}
 	}
 	if len(form_errors) > 0 {
@@ -576,6 +585,7 @@ func GetUserProfilePart(c echo.Context) error {
 		}
 	}
 	is_following := isFollowing(user_follow_list, user)
+	countView(c, user.Username, 0)
 	data := map[string]any{
 		"username":        user.Username,
 		"fullname":        user.FullName,
@@ -584,8 +594,10 @@ func GetUserProfilePart(c echo.Context) error {
 		"avatar":          user.Profile.PfPUrl,
 		"is_current_user": is_current_user,
 		"is_following":    is_following,
+		"feed_url":        "/profile/" + user.Username + "/feed",
 		"isActive":        user.Active,
 	}
+	addRelationData(data, session_user.Username, user.Username)
 	return c.Render(200, "profile", data)
 }
 
@@ -609,6 +621,7 @@ func GetUserProfileFull(c echo.Context) error {
 		}
 	}
 	is_following := isFollowing(user_follow_list, user)
+	countView(c, user.Username, 0)
 	data := map[string]any{
 		"app_title":       "Portfol.io",
 		"username":        user.Username,
@@ -618,11 +631,21 @@ func GetUserProfileFull(c echo.Context) error {
 		"avatar":          user.Profile.PfPUrl,
 		"is_current_user": is_current_user,
 		"is_following":    is_following,
+		"feed_url":        "/profile/" + user.Username + "/feed",
 		"isActive":        session_user.Active,
 		"IsAuthenticated": isAuthenticated,
 		"IsModerator":     isModerator,
 		"IsAdmin":         isAdmin,
 	}
+	addRelationData(data, session_user.Username, user.Username)
+	if user.Active {
+		description := user.Profile.Bio
+		if description == "" {
+			description = fmt.Sprintf(utils.Translate(utils.GetLocale(c), "seo_profile_description"), displayName(user))
+		}
+		data["meta"] = pageMeta(c, "profile", displayName(user), shortenText(description, metaDescriptionLength),
+			"/profile/"+user.Username, user.Profile.PfPUrl)
+	}
 	return c.Render(200, "profile_full", data)
 }
 
@@ -641,9 +664,19 @@ func GetUserSections(c echo.Context) error {
 	if err != nil {
 		return c.Render(404, "error", nil)
 	}
-	sections_list := []string{mainSection}
+	//Owners see all of their sections, visitors only the public ones
+	session_user, _ := GetUserOfSession(c)
+	sections_list := []map[string]any{{"name": mainSection}}
 	for _, section := range sections {
-		sections_list = append(sections_list, section.Name)
+		if !section.IsListed() && session_user.Username != username {
+			continue
+		}
+		sections_list = append(sections_list, map[string]any{
+			"name":        section.Name,
+			"description": section.Description,
+			"visibility":  section.Visibility,
+			"listed":      section.IsListed(),
+		})
 	}
 	data := map[string]any{
 		"locale":   locale,
@@ -664,7 +697,7 @@ func GetUserSectionPaginated(c echo.Context) error {
 	locale := utils.GetLocale(c)
 	mainSection := username
 	if section_name == mainSection {
-		postsDB, err := database.FindPostsByUserPaginated(username, page, 12)
+		postsDB, err := database.FindPostsByUserPaginated(viewerOf(c), username, page, 12)
 		if err != nil {
 			return c.String(404, "Not found")
 		}
@@ -672,7 +705,7 @@ func GetUserSectionPaginated(c echo.Context) error {
 		more := len(posts) == 12
 		nextPageLoader := ""
 		if more {
-			nextPageLoader = fmt.Sprintf("/profile/%s/section/%s?page=%d", username, section_name, page+1)
+			nextPageLoader = fmt.Sprintf("/profile/%s/sections/%s?page=%d", username, url.PathEscape(section_name), page+1)
 		}
 		data := map[string]any{
 			"locale":   locale,
@@ -684,7 +717,18 @@ func GetUserSectionPaginated(c echo.Context) error {
 
 		return c.Render(200, "posts", data)
 	}
-	postsDB, err := database.FindPostsByUserAndSectionPaginated(username, section_name, page, 12)
+	section, renamed, err := database.FindSectionByNameOrAlias(username, section_name)
+	if err != nil {
+		return c.String(404, "Not found")
+	}
+	session_user, _ := GetUserOfSession(c)
+	if !section.IsVisibleTo(session_user.Username) {
+		return c.String(404, "Not found")
+	}
+	if renamed {
+		return redirectToSlug(c, fmt.Sprintf("/profile/%s/sections/%s", username, url.PathEscape(section.Name)))
+	}
+	postsDB, err := database.FindPostsByUserAndSectionPaginated(session_user.Username, username, section.Name, page, 12)
 	if err != nil {
 		return c.String(404, "Not found")
 	}
@@ -692,7 +736,7 @@ func GetUserSectionPaginated(c echo.Context) error {
 	more := len(posts) == 12
 	nextPageLoader := ""
 	if more {
-		nextPageLoader = fmt.Sprintf("/profile/%s/section/%s?page=%d", username, section_name, page+1)
+		nextPageLoader = fmt.Sprintf("/profile/%s/sections/%s?page=%d", username, url.PathEscape(section.Name), page+1)
 	}
 	data := map[string]any{
 		"locale":   locale,
@@ -740,8 +784,9 @@ func CreateNewSectionFormPart(c echo.Context) error {
 		return c.String(401, "Unauthorized")
 	}
 	data := map[string]any{
-		"locale":   locale,
-		"username": user.Username,
+		"locale":       locale,
+		"username":     user.Username,
+		"visibilities": sectionVisibilityOptions(model.SECTION_PUBLIC),
 	}
 	return c.Render(200, "section_new", data)
 }
@@ -752,44 +797,38 @@ func CreateNewSection(c echo.Context) error {
 	if err != nil || !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	section_name := c.FormValue("name")
-	form_errors := make(map[string]string)
-	if len(section_name) < 5 {
-		form_errors["name"] = utils.Translate(locale, "section_new_name_short_error") + ". "
-	}
-	if section_name == user.Username {
-		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_new_name_invalid_error") + ". "
-	}
-	section, err := database.FindSectionByUsernameAndName(user.Username, section_name)
-	if err == nil {
-		form_errors["name"] = form_errors["name"] + utils.Translate(locale, "section_new_name_taken_error") + ". "
+	section_name := strings.TrimSpace(c.FormValue("name"))
+	description := strings.TrimSpace(c.FormValue("description"))
+	visibility := c.FormValue("visibility")
+	if visibility == "" {
+		visibility = model.SECTION_PUBLIC
 	}
+	form_errors := validateSection(locale, user, section_name, description, visibility, nil)
 	if len(form_errors) > 0 {
 		data := map[string]any{
-			"locale":   locale,
-			"username": user.Username,
-			"name":     section_name,
-			"errors":   form_errors,
+			"locale":       locale,
+			"username":     user.Username,
+			"name":         section_name,
+			"description":  description,
+			"visibilities": sectionVisibilityOptions(visibility),
+			"errors":       form_errors,
 		}
 		return c.Render(200, "section_new", data)
 	}
-	section = model.Section{Name: section_name, Owner: user.Username}
+	section := model.Section{Name: section_name, Owner: user.Username, Description: description, Visibility: visibility}
 	err = database.CreateSection(&section)
 	if err != nil {
 		data := map[string]any{
-			"locale":   locale,
-			"username": user.Username,
-			"name":     section_name,
-			"errors":   map[string]string{"other": utils.Translate(locale, "section_new_error")},
+			"locale":       locale,
+			"username":     user.Username,
+			"name":         section_name,
+			"description":  description,
+			"visibilities": sectionVisibilityOptions(visibility),
+			"errors":       map[string]string{"other": utils.Translate(locale, "section_new_error")},
 		}
 		return c.Render(200, "section_new", data)
 	}
-	data := map[string]any{
-		"locale":   locale,
-		"username": user.Username,
-		"name":     section_name,
-	}
-	return c.Render(200, "section_edit", data)
+	return renderSectionEdit(c, user, section, nil)
 }
 
 func AddPostToSection(c echo.Context) error {
@@ -797,11 +836,11 @@ func AddPostToSection(c echo.Context) error {
 	if err != nil || !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	section_name := c.Param("section")
-	section, err := database.FindSectionByUsernameAndName(user.Username, section_name)
+	section, _, err := database.FindSectionByNameOrAlias(user.Username, c.Param("section"))
 	if err != nil {
 		return c.String(404, "Not found")
 	}
+	section_name := section.Name
 	postIDstr := c.Param("post")
 	postID, err := strconv.ParseUint(postIDstr, 10, 64)
 	if err != nil {
@@ -832,11 +871,11 @@ func RemovePostFromSection(c echo.Context) error {
 	if err != nil || !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	section_name := c.Param("section")
-	section, err := database.FindSectionByUsernameAndName(user.Username, section_name)
+	section, _, err := database.FindSectionByNameOrAlias(user.Username, c.Param("section"))
 	if err != nil {
 		return c.String(404, "Not found")
 	}
+	section_name := section.Name
 	postIDstr := c.Param("post")
 	postID, err := strconv.ParseUint(postIDstr, 10, 64)
 	if err != nil {
@@ -872,13 +911,17 @@ func GetMySectionPostsPaginated(c echo.Context) error {
 	if user.Username != username {
 		return c.String(401, "Unauthorized")
 	}
-	section_name := c.Param("section")
+	section, _, err := database.FindSectionByNameOrAlias(username, c.Param("section"))
+	if err != nil {
+		return c.String(404, "Not found")
+	}
+	section_name := section.Name
 	pageStr := c.QueryParam("page")
 	page, err := strconv.Atoi(pageStr)
 	if err != nil {
 		page = 1
 	}
-	posts, err := database.FindPostsByUserPaginated(username, page, 12)
+	posts, err := database.FindPostsByUserPaginated(username, username, page, 12)
 	if err != nil {
 		return c.String(404, "Not found")
 	}
@@ -908,7 +951,7 @@ func GetMySectionPostsPaginated(c echo.Context) error {
 	more := len(postsData) == 12
 	nextPageLoader := ""
 	if more {
-		nextPageLoader = fmt.Sprintf("/profile/%s/section/%s?page=%d", username, section_name, page+1)
+		nextPageLoader = fmt.Sprintf("/profile/%s/section/%s/edit/posts?page=%d", username, url.PathEscape(section_name), page+1)
 	}
 	data := map[string]any{
 		"locale":   locale,
@@ -932,20 +975,17 @@ func DeleteSection(c echo.Context) error {
 	}
 	err = database.DeleteSectionByUsernameAndName(username, section)
 	if err != nil {
-		return c.String(500, "Internal server error")
+		return c.String(404, "Not found")
 	}
-	sections, err := database.FindSectionsByUser(username)
+	sections_lists, err := sectionsListData(username)
 	if err != nil {
 		return c.String(404, "Not found")
 	}
-	sections_lists := make([]string, len(sections))
-	for i, section := range sections {
-		sections_lists[i] = section.Name
-	}
 	data := map[string]any{
 		"locale":   utils.GetLocale(c),
 		"username": username,
 		"sections": sections_lists,
+		"isActive": user.Active,
 	}
 	return c.Render(200, "sections_list", data)
 }
@@ -985,14 +1025,10 @@ func GetMySectionsListPart(c echo.Context) error {
 	if err != nil {
 		return c.String(401, "Unauthorized")
 	}
-	sections, err := database.FindSectionsByUser(user.Username)
+	sections_lists, err := sectionsListData(user.Username)
 	if err != nil {
 		return c.String(404, "Not found")
 	}
-	sections_lists := make([]string, len(sections))
-	for i, section := range sections {
-		sections_lists[i] = section.Name
-	}
 	data := map[string]any{
 		"locale":   locale,
 		"username": user.Username,
@@ -1003,22 +1039,15 @@ func GetMySectionsListPart(c echo.Context) error {
 }
 
 func GetSectionEdit(c echo.Context) error {
-	locale := utils.GetLocale(c)
 	user, err := GetUserOfSession(c)
 	if err != nil || !user.Active {
 		return c.String(401, "Unauthorized")
 	}
-	section_name := c.Param("section")
-	section, err := database.FindSectionByUsernameAndName(user.Username, section_name)
+	section, _, err := database.FindSectionByNameOrAlias(user.Username, c.Param("section"))
 	if err != nil {
 		return c.String(404, "Not found")
 	}
-	data := map[string]any{
-		"locale":   locale,
-		"username": user.Username,
-		"name":     section.Name,
-	}
-	return c.Render(200, "section_edit", data)
+	return renderSectionEdit(c, user, section, nil)
 }
 
 func FollowUser(c echo.Context) error {
@@ -1035,6 +1064,9 @@ func FollowUser(c echo.Context) error {
 	if err != nil {
 		return c.String(404, "Not found")
 	}
+	if isBlockedWith(user.Username, username) {
+		return c.String(403, "Forbidden")
+	}
 	user_follow_list, err := database.FindFollowListByUsername(user.Username)
 	if err != nil {
 		user_follow_list = model.FollowList{Owner: user.Username}
@@ -1630,7 +1662,19 @@ func SendCopyOfDB(c echo.Context) error {
 	if err != nil || user.Authority.Level < model.AUTH_ADMIN.Level {
 		return c.String(401, "Unauthorized")
 	}
-	return c.File("./" + database.DBname)
+	//The live file may be a replica or in the middle of a write, so a temporary snapshot is served instead.
+	//It is not kept, the scheduled snapshots stay within the retention.
+	dir, err := os.MkdirTemp("", "portfolio-download-*")
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, database.NewBackupName())
+	err = database.WriteSnapshot(path)
+	if err != nil {
+		return c.String(500, "Internal server error")
+	}
+	return c.Attachment(path, database.DBname)
 }
 
 func SendCopyOfLogs(c echo.Context) error {
@@ -4,27 +4,67 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"html/template"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/joho/godotenv"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
 	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 var IMGBB_API_KEY string
 
+// Code blocks are highlighted with classes instead of inline styles, the colors live in /static/highlight.css
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(
+		//Same as extension.GFM, but tables use the align attribute since sanitizeHTML drops styles
+		extension.Linkify,
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.TaskList,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle("github"),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+)
+
+var highlightClasses = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
+
+// Hosts that may be embedded in articles with an iframe, EMBED_HOSTS replaces them
+var EmbedHosts = []string{"www.youtube.com", "www.youtube-nocookie.com", "player.vimeo.com"}
+
+// Articles with at least this many headings get a table of contents, 0 disables it
+var TOCMinHeadings = 3
+
+var contentPolicy *bluemonday.Policy
+
 func init() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Error loading .env file")
 	}
 	IMGBB_API_KEY = os.Getenv("IMGBB_API_KEY")
+	if hosts := os.Getenv("EMBED_HOSTS"); hosts != "" {
+		EmbedHosts = strings.Split(hosts, ",")
+	}
+	if minHeadings, err := strconv.Atoi(os.Getenv("TOC_MIN_HEADINGS")); err == nil && minHeadings >= 0 {
+		TOCMinHeadings = minHeadings
+	}
+	contentPolicy = newContentPolicy(EmbedHosts)
 }
 
 func uploadImageToImgbb(img []byte) (map[string]string, error) {
@@ -92,19 +132,156 @@ func convertFileToBytes(file *multipart.FileHeader) ([]byte, error) {
 	return nil
 } */
 
-func sanitizeHTML(htmlstr string) string {
+// newContentPolicy builds the policy used for everything users write in articles
+func newContentPolicy(embedHosts []string) *bluemonday.Policy {
 	p := bluemonday.NewPolicy()
 	p.AllowStandardURLs()
 	p.AllowAttrs("href").OnElements("a")
 	p.AllowElements("p", "h1", "h2", "h3", "h4", "h5", "h6", "strong", "i", "b",
-		"em", "u", "s", "a", "img", "ul", "ol", "li", "blockquote", "code", "pre")
+		"em", "u", "s", "a", "img", "ul", "ol", "li", "blockquote", "code", "pre",
+		"span", "del", "hr", "br", "sup", "sub", "figure", "figcaption",
+		"table", "caption", "colgroup", "col", "thead", "tbody", "tfoot", "tr", "th", "td")
+	p.AllowAttrs("class").Matching(highlightClasses).OnElements("pre", "code", "span")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("colspan", "rowspan").Matching(bluemonday.Integer).OnElements("th", "td")
+	p.AllowAttrs("span").Matching(bluemonday.Integer).OnElements("col", "colgroup")
 	p.AllowAttrs("src").OnElements("img")
-	p.AllowAttrs("alt").OnElements("img")
+	p.AllowAttrs("alt", "title").OnElements("img")
 	p.AllowAttrs("data-filename").OnElements("img")
-	p.AllowAttrs("style").OnElements("img")
+	//Images can be resized and floated in the editor, anything else is left to the stylesheet
+	p.AllowStyles("width").Matching(regexp.MustCompile(`^\d+(\.\d+)?(px|%)$`)).OnElements("img")
+	p.AllowStyles("float").MatchingEnum("left", "right", "none").OnElements("img")
+	if len(embedHosts) > 0 {
+		quoted := make([]string, len(embedHosts))
+		for i, host := range embedHosts {
+			quoted[i] = regexp.QuoteMeta(strings.TrimSpace(host))
+		}
+		embedSrc := regexp.MustCompile(`^(https:)?//(` + strings.Join(quoted, "|") + `)/`)
+		p.AllowElements("iframe")
+		p.AllowAttrs("src").Matching(embedSrc).OnElements("iframe")
+		p.AllowAttrs("width", "height").Matching(bluemonday.Integer).OnElements("iframe")
+		p.AllowAttrs("title").OnElements("iframe")
+		p.AllowAttrs("allowfullscreen").Matching(regexp.MustCompile(`^(allowfullscreen|true)?$`)).OnElements("iframe")
+	}
 	p.RequireParseableURLs(true)
+	return p
+}
+
+func sanitizeHTML(htmlstr string) string {
+	return cleanEmbeds(contentPolicy.Sanitize(htmlstr))
+}
+
+// cleanEmbeds drops the iframes whose source was rejected by the policy and makes the rest use https
+func cleanEmbeds(htmlstr string) string {
+	if !strings.Contains(htmlstr, "<iframe") {
+		return htmlstr
+	}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(htmlstr), &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return htmlstr
+	}
+	var buf strings.Builder
+	for _, n := range nodes {
+		var iframes []*xhtml.Node
+		walkElements(n, "iframe", func(iframe *xhtml.Node) {
+			iframes = append(iframes, iframe)
+		})
+		rejected := false
+		for _, iframe := range iframes {
+			src := attributeOf(iframe, "src")
+			if src != "" {
+				setAttribute(iframe, "src", "https:"+strings.TrimPrefix(src, "https:"))
+				continue
+			}
+			if iframe == n {
+				rejected = true
+			} else {
+				iframe.Parent.RemoveChild(iframe)
+			}
+		}
+		if !rejected {
+			buf.WriteString(htmlNodeToString(n))
+		}
+	}
+	return buf.String()
+}
+
+// addHeadingAnchors gives every heading of the content an id and returns them in order for the table of contents
+func addHeadingAnchors(htmlstr string) (string, []map[string]any) {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(htmlstr), &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return htmlstr, nil
+	}
+	var headings []map[string]any
+	used := make(map[string]bool)
+	var visit func(n *xhtml.Node)
+	visit = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode && len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+			title := strings.TrimSpace(textContent(n))
+			if title == "" {
+				return
+			}
+			slug := headingSlug(title)
+			id := slug
+			for i := 2; used[id]; i++ {
+				id = slug + "-" + strconv.Itoa(i)
+			}
+			used[id] = true
+			setAttribute(n, "id", id)
+			headings = append(headings, map[string]any{
+				"id":    id,
+				"title": title,
+				"level": int(n.Data[1] - '0'),
+			})
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	var buf strings.Builder
+	for _, n := range nodes {
+		visit(n)
+		buf.WriteString(htmlNodeToString(n))
+	}
+	return buf.String(), headings
+}
+
+var slugSeparators = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func headingSlug(title string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		slug = "section"
+	}
+	return "h-" + slug
+}
+
+// articleContent prepares the stored html of an article to be displayed, along with its table of contents
+func articleContent(htmlstr string) (template.HTML, []map[string]any) {
+	content, headings := addHeadingAnchors(htmlstr)
+	if TOCMinHeadings == 0 || len(headings) < TOCMinHeadings {
+		headings = nil
+	}
+	//Levels are made relative to the highest heading so the list does not start indented
+	minLevel := 6
+	for _, heading := range headings {
+		minLevel = min(minLevel, heading["level"].(int))
+	}
+	for _, heading := range headings {
+		heading["indent"] = heading["level"].(int) - minLevel
+	}
+	return template.HTML(content), headings //skipcq  GSC-G203
+}
 
-	return p.Sanitize(htmlstr)
+// renderMarkdown converts markdown to html, raw html in the source is dropped
+func renderMarkdown(source []byte) string {
+	var buf bytes.Buffer
+	err := markdownRenderer.Convert(source, &buf)
+	if err != nil {
+		return ""
+	}
+	return buf.String()
 }
 
 func findAndUploadArticlesImages(htmlstr string) (string, error) {
@@ -135,6 +312,11 @@ func processHTML(htmlstr string) (string, error) {
 	return htmlstr, nil
 }
 
+// processMarkdown renders the markdown and then treats the result as any other article
+func processMarkdown(source string) (string, error) {
+	return processHTML(renderMarkdown([]byte(source)))
+}
+
 func navigateAndUploadImages(n *xhtml.Node) (string, error) {
 	visited := make([]*xhtml.Node, 0)
 	stack := make([]*xhtml.Node, 0)
@@ -150,6 +332,10 @@ func navigateAndUploadImages(n *xhtml.Node) (string, error) {
 					if err != nil {
 						return "", err
 					}
+					decoded_img, err = processSingleImage(decoded_img, articleImageMaxWidths)
+					if err != nil {
+						return "", err
+					}
 					imgbbResponse, err := uploadImageToImgbb(decoded_img)
 					if err != nil {
 						return "", err
@@ -158,10 +344,6 @@ func navigateAndUploadImages(n *xhtml.Node) (string, error) {
 					attr.Val = new_url
 					node.Attr[i] = attr
 				}
-				if attr.Key == "style" {
-					attr.Val = "max-width: 100%;"
-					node.Attr[i] = attr
-				}
 			}
 		}
 		child := node.LastChild
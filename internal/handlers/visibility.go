@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/database"
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// viewerOf returns the username of the session, empty for anonymous visitors
+func viewerOf(c echo.Context) string {
+	user, err := GetUserOfSession(c)
+	if err != nil {
+		return ""
+	}
+	return user.Username
+}
+
+// canSeePost tells whether the viewer may open the article, gallery or project. Co-authors open it whatever its
+// visibility and followers-only posts are open to the followers of any of the people who wrote it. Users blocked
+// with the author or an accepted co-author can not open it at all, as in the listings.
+func canSeePost(viewer, ownerType string, ownerID uint64, post model.BasePost) bool {
+	if viewer == "" || viewer == post.Author {
+		return post.CanBeSeenBy(viewer, false)
+	}
+	if coAuthor, err := database.FindCoAuthorOfOwner(viewer, ownerType, ownerID); err == nil && coAuthor.Accepted {
+		return true
+	}
+	if blocked, err := database.IsBlockedWithWriterOf(viewer, ownerType, ownerID); err != nil || blocked {
+		return false
+	}
+	if post.CanBeSeenBy(viewer, false) {
+		return true
+	}
+	isFollower := false
+	if post.Visibility == model.VISIBILITY_FOLLOWERS {
+		isFollower, _ = database.FollowsWriterOf(viewer, ownerType, ownerID)
+	}
+	return isFollower
+}
+
+// visibilityOptions lists the visibilities for the selects of the author, drafts are only offered when withDraft is set
+func visibilityOptions(selected string, withDraft bool) []map[string]any {
+	if selected == "" {
+		selected = model.VISIBILITY_PUBLIC
+	}
+	var options []map[string]any
+	for _, visibility := range model.VISIBILITIES {
+		if visibility == model.VISIBILITY_DRAFT && !withDraft {
+			continue
+		}
+		options = append(options, map[string]any{
+			"name":     visibility,
+			"label":    "visibility_" + visibility,
+			"selected": visibility == selected,
+		})
+	}
+	return options
+}
+
+// publishVisibility reads the visibility chosen when publishing, public unless another one is given
+func publishVisibility(c echo.Context) (string, bool) {
+	visibility := c.FormValue("visibility")
+	if visibility == "" {
+		return model.VISIBILITY_PUBLIC, true
+	}
+	return visibility, visibility != model.VISIBILITY_DRAFT && slices.Contains(model.VISIBILITIES, visibility)
+}
+
+// SetArticleVisibility changes who can see the article, drafts go through the accessibility check as when publishing
+func SetArticleVisibility(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	article, err := database.FindArticleByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	if article.Author != user.Username {
+		return c.String(401, "Unauthorized")
+	}
+	visibility := c.FormValue("visibility")
+	if !slices.Contains(model.VISIBILITIES, visibility) {
+		return c.String(400, "Bad Request")
+	}
+	if article.IsDraft() && visibility != model.VISIBILITY_DRAFT {
+		return PublishArticle(c)
+	}
+	article.SetVisibility(visibility)
+	err = database.UpdateArticleVisibility(&article)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return c.Render(200, "success", nil)
+}
+
+// SetGalleryVisibility changes who can see the gallery, drafts go through the accessibility check as when publishing
+func SetGalleryVisibility(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(400, "Bad Request")
+	}
+	user, err := GetUserOfSession(c)
+	if err != nil || !user.Active {
+		return c.String(401, "Unauthorized")
+	}
+	gallery, err := database.FindGalleryByID(id)
+	if err != nil {
+		return c.String(404, "Not Found")
+	}
+	if gallery.Author != user.Username {
+		return c.String(401, "Unauthorized")
+	}
+	visibility := c.FormValue("visibility")
+	if !slices.Contains(model.VISIBILITIES, visibility) {
+		return c.String(400, "Bad Request")
+	}
+	if gallery.IsDraft() && visibility != model.VISIBILITY_DRAFT {
+		return PublishGallery(c)
+	}
+	gallery.SetVisibility(visibility)
+	err = database.UpdateGalleryVisibility(&gallery)
+	if err != nil {
+		return c.String(500, "Internal Server Error")
+	}
+	return c.Render(200, "success", nil)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/JuanJoCasamitjana/portfol.io/internal/model"
+	"gorm.io/gorm"
+)
+
+// createCoWrittenPost stores a draft article of writer, co-written by helper while invitee has not accepted yet,
+// and returns its id. fan follows writer and cofan follows helper.
+func createCoWrittenPost(t *testing.T, tx *gorm.DB) uint64 {
+	t.Helper()
+	createUsers(t, tx, "writer", "helper", "invitee", "fan", "cofan")
+	article := model.Article{BasePost: model.BasePost{Title: "post", Author: "writer", Visibility: model.VISIBILITY_DRAFT}}
+	if err := tx.Create(&article).Error; err != nil {
+		t.Fatal(err)
+	}
+	var post model.Post
+	if err := tx.Where("owner_type = ? AND owner_id = ?", "article", article.ID).First(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	coAuthors := []model.CoAuthor{
+		{PostID: post.ID, Username: "helper", Accepted: true, InvitedBy: "writer"},
+		{PostID: post.ID, Username: "invitee", InvitedBy: "writer"},
+	}
+	if err := tx.Create(&coAuthors).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, follow := range [][2]string{{"fan", "writer"}, {"cofan", "helper"}} {
+		if err := tx.Exec("INSERT INTO follows (owner, username) VALUES (?, ?)", follow[0], follow[1]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return article.ID
+}
+
+func TestCanSeePost(t *testing.T) {
+	tx := rollbackDB(t)
+	id := createCoWrittenPost(t, tx)
+	params := []struct {
+		viewer     string
+		visibility string
+		expected   bool
+	}{
+		{"", model.VISIBILITY_PUBLIC, true},
+		{"", model.VISIBILITY_UNLISTED, true},
+		{"", model.VISIBILITY_FOLLOWERS, false},
+		{"", model.VISIBILITY_PRIVATE, false},
+		{"nobody", model.VISIBILITY_FOLLOWERS, false},
+		{"fan", model.VISIBILITY_FOLLOWERS, true},
+		{"cofan", model.VISIBILITY_FOLLOWERS, true},
+		{"fan", model.VISIBILITY_PRIVATE, false},
+		{"helper", model.VISIBILITY_PRIVATE, true},
+		{"helper", model.VISIBILITY_DRAFT, true},
+		{"invitee", model.VISIBILITY_PRIVATE, false},
+		{"writer", model.VISIBILITY_PRIVATE, true},
+		{"writer", model.VISIBILITY_DRAFT, true},
+	}
+	for _, p := range params {
+		post := model.BasePost{ID: id, Author: "writer", Visibility: p.visibility, Published: p.visibility != model.VISIBILITY_DRAFT}
+		seen := canSeePost(p.viewer, "article", id, post)
+		if seen != p.expected {
+			t.Errorf("viewer %q on a %s post: expected %v, got %v", p.viewer, p.visibility, p.expected, seen)
+		}
+	}
+}
+
+func TestCanSeePostBlocked(t *testing.T) {
+	params := []struct {
+		name     string
+		block    [2]string
+		viewer   string
+		expected bool
+	}{
+		{"blocked_by_author", [2]string{"writer", "fan"}, "fan", false},
+		{"blocked_author", [2]string{"fan", "writer"}, "fan", false},
+		{"author_blocked_someone", [2]string{"writer", "fan"}, "writer", true},
+		{"blocked_by_co_author", [2]string{"helper", "fan"}, "fan", false},
+		{"blocked_co_author", [2]string{"cofan", "helper"}, "cofan", false},
+		{"blocked_invitee", [2]string{"fan", "invitee"}, "fan", true},
+		{"co_author_blocked_author", [2]string{"helper", "writer"}, "helper", true},
+		{"block_between_others", [2]string{"fan", "cofan"}, "fan", true},
+	}
+	for _, p := range params {
+		t.Run(p.name, func(t *testing.T) {
+			tx := rollbackDB(t)
+			id := createCoWrittenPost(t, tx)
+			if err := tx.Create(&model.Block{Owner: p.block[0], Username: p.block[1]}).Error; err != nil {
+				t.Fatal(err)
+			}
+			post := model.BasePost{ID: id, Author: "writer", Visibility: model.VISIBILITY_PUBLIC, Published: true}
+			seen := canSeePost(p.viewer, "article", id, post)
+			if seen != p.expected {
+				t.Errorf("expected %v, got %v", p.expected, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// View is one visit to a post or, when PostID is 0, to the profile of Author.
+// Visitor is a hash salted with a key that changes every day, it is only kept to ignore repeated visits.
+type View struct {
+	ID        uint64
+	PostID    uint64 `gorm:"index"`
+	Author    string `gorm:"index"`
+	Visitor   string `gorm:"index"`
+	Referrer  string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// FollowEvent records when Username gained (Delta 1) or lost (Delta -1) a follower
+type FollowEvent struct {
+	ID        uint64
+	Username  string `gorm:"index"`
+	Delta     int
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// ArticleAutosave keeps what a user was writing in the article editor until it is saved. There is one per user and
+// article, ArticleID is zero for the article being created. Version is the version of the article the changes
+// were made on.
+type ArticleAutosave struct {
+	ID        uint64
+	ArticleID uint64 `gorm:"uniqueIndex:idx_autosave"`
+	Owner     string `gorm:"uniqueIndex:idx_autosave"`
+	User      User   `gorm:"foreignKey:Owner;references:Username"`
+	Title     string
+	Format    string
+	Source    string
+	Content   string
+	Version   uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (a ArticleAutosave) IsMarkdown() bool {
+	return a.Format == ARTICLE_FORMAT_MARKDOWN
+}
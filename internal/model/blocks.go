@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Block keeps Owner and Username apart both ways: they can not follow each other, comment, vote or react on the
+// other's posts, and their posts are hidden from each other
+type Block struct {
+	ID        uint64
+	Owner     string `gorm:"uniqueIndex:idx_block"`
+	Username  string `gorm:"uniqueIndex:idx_block;index"`
+	CreatedAt time.Time
+}
+
+// Mute hides the posts of Username from the feeds and searches of Owner, Username is not told
+type Mute struct {
+	ID        uint64
+	Owner     string `gorm:"uniqueIndex:idx_mute"`
+	Username  string `gorm:"uniqueIndex:idx_mute;index"`
+	CreatedAt time.Time
+}
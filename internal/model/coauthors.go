@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles of a co-author. Editors can change the content of the post, viewers can only read it before it is published.
+// Publishing, deleting and inviting stay with the author.
+const (
+	COAUTHOR_EDITOR = "editor"
+	COAUTHOR_VIEWER = "viewer"
+)
+
+var COAUTHOR_ROLES = []string{COAUTHOR_EDITOR, COAUTHOR_VIEWER}
+
+const COAUTHORS_MAX = 10
+
+// CoAuthor is an invitation to write a post together, it counts once Accepted. Like reactions it has no User
+// relation, gorm would put its foreign key on users.
+type CoAuthor struct {
+	ID        uint64
+	PostID    uint64 `gorm:"uniqueIndex:idx_coauthor"`
+	Post      Post
+	Username  string `gorm:"uniqueIndex:idx_coauthor;index"`
+	Role      string
+	Accepted  bool `gorm:"default:false"`
+	InvitedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (c CoAuthor) CanEdit() bool {
+	return c.Accepted && c.Role == COAUTHOR_EDITOR
+}
+
+// AfterUpdate tells the followers of the co-author about the post once the invitation is accepted.
+// Followers of the author were already told when the post was created.
+func (c *CoAuthor) AfterUpdate(tx *gorm.DB) error {
+	if !c.Accepted {
+		return nil
+	}
+	var post Post
+	err := tx.First(&post, c.PostID).Error
+	if err != nil || (post.Visibility != VISIBILITY_PUBLIC && post.Visibility != VISIBILITY_FOLLOWERS) {
+		return nil
+	}
+	var emails []string
+	tx.Model(&User{}).Where("username IN (SELECT owner FROM follows WHERE username = ?)", c.Username).
+		Where("username NOT IN (SELECT owner FROM follows WHERE username = ?) AND username <> ?", post.Author, post.Author).
+		Pluck("email", &emails)
+	data := map[string]any{
+		"title":  post.Title,
+		"author": c.Username,
+		"type":   post.OwnerType,
+	}
+	go sendNotification(emails, data)
+	return nil
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	COMMENTS_OPEN      = "open"
+	COMMENTS_MODERATED = "moderated"
+	COMMENTS_CLOSED    = "closed"
+)
+
+// A Comment belongs to the post index, so articles, galleries and projects share them.
+// ParentID is zero for comments that do not reply to another one.
+type Comment struct {
+	ID        uint64
+	PostID    uint64
+	Post      Post
+	ParentID  uint64
+	Author    string
+	User      User `gorm:"foreignKey:Author;references:Username"`
+	Content   string
+	Approved  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+const (
+	EXPORT_PENDING = "pending"
+	EXPORT_READY   = "ready"
+	EXPORT_FAILED  = "failed"
+)
+
+const (
+	EXPORT_KIND_DATA = "data"
+	EXPORT_KIND_SITE = "site"
+)
+
+// DataExport tracks the archive a user requested, either with all of their content or with their portfolio as a static site
+type DataExport struct {
+	ID        uint64
+	Owner     string
+	User      User   `gorm:"foreignKey:Owner;references:Username"`
+	Kind      string `gorm:"default:data"`
+	Status    string
+	FileName  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// Migration marks a data migration as done so it only runs once, Name identifies the migration
+type Migration struct {
+	Name      string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
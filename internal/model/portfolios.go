@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+const (
+	THEME_CLASSIC = "classic"
+	THEME_MINIMAL = "minimal"
+	THEME_DARK    = "dark"
+	THEME_WARM    = "warm"
+)
+
+// THEMES keeps the order in which themes are offered
+var THEMES = []string{THEME_CLASSIC, THEME_MINIMAL, THEME_DARK, THEME_WARM}
+
+const (
+	FEATURED_POSTS_MAX       = 6
+	PORTFOLIO_HEADLINE_MAX   = 120
+	PORTFOLIO_ABOUT_MAX      = 5000
+	PORTFOLIO_SECTION_POSTS  = 6
+	PORTFOLIO_DOMAIN_MAX_LEN = 253
+)
+
+// Portfolio is the public site of a user, served at /u/:username and at Domain once it is verified.
+// The owner proves the domain is theirs with a TXT record holding DomainToken.
+type Portfolio struct {
+	ID             uint64
+	Owner          string `gorm:"unique"`
+	User           User   `gorm:"foreignKey:Owner;references:Username"`
+	Theme          string `gorm:"default:classic"`
+	Headline       string
+	About          string
+	AboutSource    string
+	Domain         string `gorm:"index"`
+	DomainToken    string
+	DomainVerified bool `gorm:"default:false"`
+	UpdatedAt      time.Time
+}
+
+// FeaturedPost pins a post of the owner at the top of the portfolio
+type FeaturedPost struct {
+	ID        uint64
+	Owner     string `gorm:"uniqueIndex:idx_featured_post"`
+	PostID    uint64 `gorm:"uniqueIndex:idx_featured_post"`
+	Post      Post
+	Position  int
+	CreatedAt time.Time
+}
@@ -3,41 +3,89 @@ package model
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/JuanJoCasamitjana/portfol.io/internal/utils"
 	"gorm.io/gorm"
 )
 
 type BasePost struct {
-	ID        uint64
-	Title     string
-	Author    string
-	User      User `gorm:"foreignKey:Author;references:Username"`
-	Published bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID         uint64
+	Title      string
+	Slug       string `gorm:"index"`
+	Author     string
+	User       User `gorm:"foreignKey:Author;references:Username"`
+	Published  bool
+	Visibility string `gorm:"index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
+// Names are stored normalized. An alias points to the tag it stands for with AliasOfID,
+// banned names can not be created nor voted.
 type Tag struct {
-	ID   uint64
-	Name string `gorm:"unique"`
+	ID          uint64
+	Name        string `gorm:"unique"`
+	Description string
+	AliasOfID   uint64 `gorm:"default:0"`
+	Banned      bool   `gorm:"default:false"`
+}
+
+const TAG_MAX_LENGTH = 40
+
+// NormalizeTagName lowercases the name and joins its words with dashes, dropping any symbol but #, + and .
+// so that names like c# and c++ stay apart from c.
+func NormalizeTagName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '#' || r == '+' || r == '.':
+			b.WriteRune(r)
+			dash = false
+		case (unicode.IsSpace(r) || r == '-' || r == '_') && b.Len() > 0 && !dash:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	normalized := []rune(b.String())
+	if len(normalized) > TAG_MAX_LENGTH {
+		normalized = normalized[:TAG_MAX_LENGTH]
+	}
+	return strings.Trim(string(normalized), "-")
 }
 
 // A user can vote for a specific tag on a post
 type Vote struct {
-	ID    uint64
-	Voter string
-	User  User `gorm:"foreignKey:Voter;references:Username"`
-	TagID uint64
-	Tag   Tag `gorm:"foreignKey:TagID;references:ID"`
+	ID        uint64
+	Voter     string
+	User      User `gorm:"foreignKey:Voter;references:Username"`
+	TagID     uint64
+	Tag       Tag `gorm:"foreignKey:TagID;references:ID"`
+	CreatedAt time.Time
 }
 
+const (
+	ARTICLE_FORMAT_HTML     = "html"
+	ARTICLE_FORMAT_MARKDOWN = "markdown"
+)
+
+// Content always holds the sanitized html, Source keeps the markdown of articles written in that format
 type Article struct {
 	BasePost
 	Votes   []Vote `gorm:"many2many:article_votes;"`
 	Content string
+	Format  string `gorm:"default:html"`
+	Source  string
+	// Version grows with every edit of the content, an edit made on an older version is a conflict
+	Version uint64
+}
+
+func (a Article) IsMarkdown() bool {
+	return a.Format == ARTICLE_FORMAT_MARKDOWN
 }
 
 type Project struct {
@@ -52,24 +100,63 @@ type Image struct {
 	Owner     string
 	User      User `gorm:"foreignKey:Owner;references:Username"`
 	Footer    string
+	Alt       string
+	Position  int
 	ImageURL  string
 	ThumbURL  string
 	DeleteURL string
 	GalleryID uint64
 	Gallery   Gallery
+	Width     int
+	Height    int
+	Variants  []ImageVariant
+}
+
+// ImageVariant is a resized copy of an image, used to build its srcset
+type ImageVariant struct {
+	ID        uint64
+	ImageID   uint64
+	Width     int
+	Height    int
+	URL       string
+	DeleteURL string
 }
 
+// Images are kept ordered by Position, CoverID is zero while the author has not chosen a cover
 type Gallery struct {
 	BasePost
-	Votes  []Vote `gorm:"many2many:gallery_votes;"`
-	Images []Image
+	Votes   []Vote `gorm:"many2many:gallery_votes;"`
+	Images  []Image
+	CoverID uint64
+}
+
+// Cover returns the image that represents the gallery, the first one unless another was chosen
+func (g Gallery) Cover() (Image, bool) {
+	if len(g.Images) == 0 {
+		return Image{}, false
+	}
+	for _, image := range g.Images {
+		if image.ID == g.CoverID {
+			return image, true
+		}
+	}
+	return g.Images[0], true
 }
 
 type Post struct {
 	BasePost
-	Votes     []Vote `gorm:"many2many:post_votes;"`
-	OwnerID   uint64
-	OwnerType string
+	Votes        []Vote `gorm:"many2many:post_votes;"`
+	OwnerID      uint64
+	OwnerType    string
+	CommentsMode string `gorm:"default:open"`
+}
+
+func (p Post) CommentsOpen() bool {
+	return p.CommentsMode != COMMENTS_CLOSED
+}
+
+func (p Post) CommentsModerated() bool {
+	return p.CommentsMode == COMMENTS_MODERATED
 }
 
 // Postable is an interface that all posts must implement
@@ -121,13 +208,21 @@ func (p Post) GetVotes() []Vote {
 
 // AfterCreate is a hook that creates a post after creating an article
 // It helps indexing posts arbitrarily
+func (a *Article) BeforeSave(tx *gorm.DB) (err error) {
+	a.syncVisibility()
+	a.Slug, err = slugOnSave(tx, "articles", "article", a.ID, a.Title, a.Slug, a.Published)
+	return err
+}
+
 func (a *Article) AfterCreate(tx *gorm.DB) error {
 	var post Post
 	post.OwnerID = a.ID
 	post.OwnerType = "article"
 	post.Author = a.Author
 	post.Title = a.Title
+	post.Slug = a.Slug
 	post.Published = a.Published
+	post.Visibility = a.Visibility
 	tx.Transaction(func(tx *gorm.DB) error {
 		tx.Create(&post)
 		return nil
@@ -135,6 +230,11 @@ func (a *Article) AfterCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (p *Project) BeforeSave(tx *gorm.DB) error {
+	p.syncVisibility()
+	return nil
+}
+
 func (p *Project) AfterCreate(tx *gorm.DB) error {
 	var post Post
 	post.OwnerID = p.ID
@@ -142,6 +242,7 @@ func (p *Project) AfterCreate(tx *gorm.DB) error {
 	post.Author = p.Author
 	post.Title = p.Title
 	post.Published = p.Published
+	post.Visibility = p.Visibility
 	tx.Transaction(func(tx *gorm.DB) error {
 		tx.Create(&post)
 		return nil
@@ -149,13 +250,21 @@ func (p *Project) AfterCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (g *Gallery) BeforeSave(tx *gorm.DB) (err error) {
+	g.syncVisibility()
+	g.Slug, err = slugOnSave(tx, "galleries", "gallery", g.ID, g.Title, g.Slug, g.Published)
+	return err
+}
+
 func (g *Gallery) AfterCreate(tx *gorm.DB) error {
 	var post Post
 	post.OwnerID = g.ID
 	post.OwnerType = "gallery"
 	post.Author = g.Author
 	post.Title = g.Title
+	post.Slug = g.Slug
 	post.Published = g.Published
+	post.Visibility = g.Visibility
 	tx.Transaction(func(tx *gorm.DB) error {
 		tx.Create(&post)
 		return nil
@@ -167,8 +276,10 @@ func (a *Article) AfterSave(tx *gorm.DB) error {
 	var post Post
 	tx.Where("owner_id = ? AND owner_type = ?", a.ID, "article").Preload("Votes").First(&post)
 	post.Title = a.Title
+	post.Slug = a.Slug
 	post.Author = a.Author
 	post.Published = a.Published
+	post.Visibility = a.Visibility
 	post.Votes = a.Votes
 	return tx.Transaction(func(tx *gorm.DB) error {
 		return tx.Save(&post).Error
@@ -181,6 +292,7 @@ func (p *Project) AfterSave(tx *gorm.DB) error {
 	post.Title = p.Title
 	post.Author = p.Author
 	post.Published = p.Published
+	post.Visibility = p.Visibility
 	post.Votes = p.Votes
 	return tx.Transaction(func(tx *gorm.DB) error {
 		return tx.Save(&post).Error
@@ -191,18 +303,23 @@ func (g *Gallery) AfterSave(tx *gorm.DB) error {
 	var post Post
 	tx.Where("owner_id = ? AND owner_type = ?", g.ID, "gallery").Preload("Votes").First(&post)
 	post.Title = g.Title
+	post.Slug = g.Slug
 	post.Author = g.Author
 	post.Published = g.Published
+	post.Visibility = g.Visibility
 	post.Votes = g.Votes
 	return tx.Transaction(func(tx *gorm.DB) error {
 		return tx.Save(&post).Error
 	})
 }
 
+// AfterCreate tells the followers of the author about the post, unless they are not allowed to see it
 func (p *Post) AfterCreate(tx *gorm.DB) error {
-	owner := p.User
+	if p.Visibility != VISIBILITY_PUBLIC && p.Visibility != VISIBILITY_FOLLOWERS {
+		return nil
+	}
 	var users_to_notify []User
-	tx.Model(&User{}).Where("username IN (SELECT username FROM follows WHERE owner = ?)", owner.Username).
+	tx.Model(&User{}).Where("username IN (SELECT owner FROM follows WHERE username = ?)", p.Author).
 		Find(&users_to_notify)
 	var emails []string
 	for _, user := range users_to_notify {
@@ -221,7 +338,11 @@ func (a *Article) BeforeDelete(tx *gorm.DB) error {
 	var post Post
 	tx.Where("owner_id = ? AND owner_type = ?", a.ID, "article").First(&post)
 	return tx.Transaction(func(tx *gorm.DB) error {
-		err := tx.Model(&post).Association("Votes").Clear()
+		err := deletePostActivity(tx, post)
+		if err != nil {
+			return err
+		}
+		err = tx.Where("article_id = ?", a.ID).Delete(&ArticleAutosave{}).Error
 		if err != nil {
 			return err
 		}
@@ -233,7 +354,7 @@ func (p *Project) BeforeDelete(tx *gorm.DB) error {
 	var post Post
 	tx.Where("owner_id = ? AND owner_type = ?", p.ID, "project").First(&post)
 	return tx.Transaction(func(tx *gorm.DB) error {
-		err := tx.Model(&post).Association("Votes").Clear()
+		err := deletePostActivity(tx, post)
 		if err != nil {
 			return err
 		}
@@ -245,7 +366,7 @@ func (g *Gallery) BeforeDelete(tx *gorm.DB) error {
 	var post Post
 	tx.Where("owner_id = ? AND owner_type = ?", g.ID, "gallery").First(&post)
 	return tx.Transaction(func(tx *gorm.DB) error {
-		err := tx.Model(&post).Association("Votes").Clear()
+		err := deletePostActivity(tx, post)
 		if err != nil {
 			return err
 		}
@@ -253,6 +374,73 @@ func (g *Gallery) BeforeDelete(tx *gorm.DB) error {
 	})
 }
 
+// deletePostActivity removes what other users left on the post, votes included
+func deletePostActivity(tx *gorm.DB, post Post) error {
+	if post.ID == 0 {
+		return nil
+	}
+	var voteIDs []uint64
+	err := tx.Table("post_votes").Where("post_id = ?", post.ID).Pluck("vote_id", &voteIDs).Error
+	if err != nil {
+		return err
+	}
+	var ownVoteIDs []uint64
+	err = tx.Table(post.OwnerType+"_votes").Where(post.OwnerType+"_id = ?", post.OwnerID).Pluck("vote_id", &ownVoteIDs).Error
+	if err != nil {
+		return err
+	}
+	voteIDs = append(voteIDs, ownVoteIDs...)
+	if len(voteIDs) > 0 {
+		for _, table := range []string{post.OwnerType + "_votes", "post_votes"} {
+			err = tx.Exec("DELETE FROM "+table+" WHERE vote_id IN ?", voteIDs).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Where("id IN ?", voteIDs).Delete(&Vote{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&Comment{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&Reaction{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&PostScore{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&View{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&FeaturedPost{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&SectionPost{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&CoAuthor{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&PreviewFeedback{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("post_id = ?", post.ID).Delete(&PreviewLink{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("post_id = ?", post.ID).Delete(&SavedPost{}).Error
+}
+
 func (t *Tag) ColorOfTag() string {
 	colors := []string{"#C84630", "#FFB627", "#219797", "#6113CD", "#1A5E63"}
 	sum := 0
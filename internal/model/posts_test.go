@@ -0,0 +1,31 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTagName(t *testing.T) {
+	params := []struct {
+		name     string
+		expected string
+	}{
+		{"Go", "go"},
+		{"  Go Lang  ", "go-lang"},
+		{"web__dev--tools", "web-dev-tools"},
+		{"-lead & trail-", "lead-trail"},
+		{"C#", "c#"},
+		{"C++", "c++"},
+		{"Node.js", "node.js"},
+		{"Canción", "canción"},
+		{"!!!", ""},
+		{strings.Repeat("a", TAG_MAX_LENGTH+10), strings.Repeat("a", TAG_MAX_LENGTH)},
+		{strings.Repeat("a", TAG_MAX_LENGTH-1) + " b", strings.Repeat("a", TAG_MAX_LENGTH-1)},
+	}
+	for _, p := range params {
+		normalized := NormalizeTagName(p.name)
+		if normalized != p.expected {
+			t.Errorf("NormalizeTagName(%q): expected %q, got %q", p.name, p.expected, normalized)
+		}
+	}
+}
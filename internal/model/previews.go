@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Days a preview link can last, the author picks one when sharing the draft
+var PREVIEW_EXPIRATIONS = []int{1, 7, 30}
+
+const (
+	PREVIEW_LINKS_MAX = 10
+	//Feedback needs no account, each link takes a limited amount
+	PREVIEW_FEEDBACK_MAX       = 100
+	PREVIEW_FEEDBACK_QUOTE_MAX = 300
+)
+
+// PreviewLink gives whoever has the token access to a draft until it expires or the author revokes it
+type PreviewLink struct {
+	ID            uint64
+	PostID        uint64 `gorm:"index"`
+	Post          Post
+	Token         string `gorm:"uniqueIndex"`
+	AllowFeedback bool
+	CreatedBy     string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+func (l PreviewLink) Expired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
+
+// PreviewFeedback is left on a draft through a preview link, reviewers do not need an account so Name is
+// whatever they typed. It stays with the post after the link is revoked.
+// Quote is the passage of the article the feedback is about and ImageID the image of the gallery, both are
+// empty when it is about the whole post.
+type PreviewFeedback struct {
+	ID            uint64
+	PostID        uint64 `gorm:"index"`
+	Post          Post
+	PreviewLinkID uint64 `gorm:"index"`
+	Name          string
+	Quote         string
+	ImageID       uint64
+	Content       string
+	CreatedAt     time.Time
+}
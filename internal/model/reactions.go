@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	REACTION_LIKE       = "like"
+	REACTION_INSIGHTFUL = "insightful"
+	REACTION_INSPIRING  = "inspiring"
+	REACTION_FUNNY      = "funny"
+)
+
+// REACTIONS keeps the order in which reactions are shown
+var REACTIONS = []string{REACTION_LIKE, REACTION_INSIGHTFUL, REACTION_INSPIRING, REACTION_FUNNY}
+
+// A user can leave each kind of reaction once on a post. Username has no User relation: with the same field name
+// on both sides gorm takes it as a relation owned by users and puts the foreign key on that table.
+type Reaction struct {
+	ID        uint64
+	PostID    uint64 `gorm:"uniqueIndex:idx_reaction"`
+	Post      Post
+	Username  string `gorm:"uniqueIndex:idx_reaction"`
+	Kind      string `gorm:"uniqueIndex:idx_reaction"`
+	CreatedAt time.Time
+}
+
+// SavedPost is a bookmark only visible to the user who saved it
+type SavedPost struct {
+	ID        uint64
+	Username  string `gorm:"uniqueIndex:idx_saved_post"`
+	PostID    uint64 `gorm:"uniqueIndex:idx_saved_post"`
+	Post      Post
+	CreatedAt time.Time
+}
@@ -2,8 +2,10 @@ package model
 
 import "time"
 
+// CommentID is set when the report was sent from a comment
 type Report struct {
 	ID          uint64
 	Description string
+	CommentID   uint64
 	CreatedAt   time.Time
 }
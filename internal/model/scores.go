@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// PostScore caches how a post ranks in the feeds, a background job recomputes it from the engagement it gets
+type PostScore struct {
+	PostID    uint64  `gorm:"primaryKey;autoIncrement:false"`
+	Trending  float64 `gorm:"index"`
+	Week      float64 `gorm:"index"`
+	Month     float64 `gorm:"index"`
+	AllTime   float64 `gorm:"index"`
+	UpdatedAt time.Time
+}
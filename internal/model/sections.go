@@ -0,0 +1,46 @@
+package model
+
+const (
+	SECTION_PUBLIC   = "public"
+	SECTION_UNLISTED = "unlisted"
+	SECTION_PRIVATE  = "private"
+)
+
+// SECTION_VISIBILITIES keeps the order in which visibilities are offered
+var SECTION_VISIBILITIES = []string{SECTION_PUBLIC, SECTION_UNLISTED, SECTION_PRIVATE}
+
+const (
+	SECTION_NAME_MIN_LEN     = 5
+	SECTION_DESCRIPTION_MAX  = 500
+	SECTION_BULK_MAX_POSTS   = 100
+	SECTION_POSTS_ORDER_SIZE = 50
+)
+
+// RESERVED_SECTION_NAMES are taken by the routes that live next to the sections of a user
+var RESERVED_SECTION_NAMES = []string{"move"}
+
+// SectionPost is the join table of sections and posts, Position keeps the order chosen by the owner.
+// Posts added before positions existed have 0 and go first, newest first.
+type SectionPost struct {
+	SectionID uint64 `gorm:"primaryKey"`
+	PostID    uint64 `gorm:"primaryKey"`
+	Position  int
+}
+
+// SectionAlias is an old name of a renamed section, links using it still lead to the section
+type SectionAlias struct {
+	ID        uint64
+	SectionID uint64 `gorm:"index"`
+	Owner     string `gorm:"uniqueIndex:idx_section_alias"`
+	Name      string `gorm:"uniqueIndex:idx_section_alias"`
+}
+
+// IsListed tells whether the section is shown to visitors in the profile and the portfolio
+func (s Section) IsListed() bool {
+	return s.Visibility == "" || s.Visibility == SECTION_PUBLIC
+}
+
+// IsVisibleTo tells whether the section can be opened by the given user, private ones only by their owner
+func (s Section) IsVisibleTo(username string) bool {
+	return s.Visibility != SECTION_PRIVATE || s.Owner == username
+}
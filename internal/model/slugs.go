@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+const SLUG_MAX_LENGTH = 80
+
+// Slugs can not take the place of the fixed routes under /article and /gallery
+var reservedSlugs = []string{"create", "publish", "preview", "mine", "edit", "delete", "tag", "image-upload-form"}
+
+// Slugify turns a title into lowercase ascii words joined by dashes, accents are dropped so "Canción" becomes "cancion"
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > SLUG_MAX_LENGTH {
+		slug = slug[:SLUG_MAX_LENGTH]
+	}
+	return strings.Trim(slug, "-")
+}
+
+// UniqueSlug finds the first free slug for the title in the table, adding a number when it is taken.
+// Slugs made only of digits get the kind in front so they are not mistaken for ids.
+func UniqueSlug(tx *gorm.DB, table, kind string, id uint64, title string) (string, error) {
+	base := Slugify(title)
+	if strings.Trim(base, "0123456789") == "" {
+		base = strings.Trim(kind+"-"+base, "-")
+	}
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		if slices.Contains(reservedSlugs, slug) {
+			continue
+		}
+		var count int64
+		err := tx.Table(table).Where("slug = ? AND id <> ?", slug, id).Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return slug, nil
+		}
+	}
+}
+
+// slugOnSave gives the post a slug from its title the first time it is published. Once assigned it is kept,
+// even if the post goes back to draft, so links to it never break.
+func slugOnSave(tx *gorm.DB, table, kind string, id uint64, title, slug string, published bool) (string, error) {
+	if title == "" || slug != "" || !published {
+		return slug, nil
+	}
+	slug, err := UniqueSlug(tx.Session(&gorm.Session{NewDB: true}), table, kind, id, title)
+	if err != nil {
+		return "", err
+	}
+	tx.Statement.SetColumn("slug", slug)
+	return slug, nil
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	params := []struct {
+		title    string
+		expected string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"Canción de otoño", "cancion-de-otono"},
+		{"  ¿Qué tal?  ", "que-tal"},
+		{"C++ & Go", "c-go"},
+		{"2024", "2024"},
+		{"日本語", ""},
+		{strings.Repeat("a", SLUG_MAX_LENGTH+20), strings.Repeat("a", SLUG_MAX_LENGTH)},
+		{strings.Repeat("a", SLUG_MAX_LENGTH-1) + " b", strings.Repeat("a", SLUG_MAX_LENGTH-1)},
+	}
+	for _, p := range params {
+		slug := Slugify(p.title)
+		if slug != p.expected {
+			t.Errorf("Slugify(%q): expected %q, got %q", p.title, p.expected, slug)
+		}
+	}
+}
@@ -49,11 +49,14 @@ type Profile struct {
 }
 
 type Section struct {
-	ID    uint64
-	Name  string
-	Owner string
-	User  User   `gorm:"foreignKey:Owner;references:Username"`
-	Posts []Post `gorm:"many2many:section_posts;"`
+	ID          uint64
+	Name        string
+	Owner       string
+	User        User   `gorm:"foreignKey:Owner;references:Username"`
+	Posts       []Post `gorm:"many2many:section_posts;"`
+	Position    int
+	Description string
+	Visibility  string `gorm:"default:public"`
 }
 
 type Authority struct {
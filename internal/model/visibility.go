@@ -0,0 +1,55 @@
+package model
+
+// Visibility levels of a post. Drafts and private posts are only seen by their author, unlisted ones by anyone
+// with the link and followers-only ones by the followers of the author. Only public posts reach feeds and search.
+const (
+	VISIBILITY_DRAFT     = "draft"
+	VISIBILITY_PRIVATE   = "private"
+	VISIBILITY_UNLISTED  = "unlisted"
+	VISIBILITY_FOLLOWERS = "followers"
+	VISIBILITY_PUBLIC    = "public"
+)
+
+// VISIBILITIES keeps the order in which visibilities are offered, from the most to the least restricted
+var VISIBILITIES = []string{VISIBILITY_DRAFT, VISIBILITY_PRIVATE, VISIBILITY_UNLISTED, VISIBILITY_FOLLOWERS, VISIBILITY_PUBLIC}
+
+// SetVisibility changes the visibility of the post, Published stays true for anything but drafts
+func (p *BasePost) SetVisibility(visibility string) {
+	p.Visibility = visibility
+	p.Published = visibility != VISIBILITY_DRAFT
+}
+
+// syncVisibility fills the visibility of posts saved before it existed or by code that only sets Published
+func (p *BasePost) syncVisibility() {
+	switch {
+	case p.Visibility == "" && p.Published, p.Visibility == VISIBILITY_DRAFT && p.Published:
+		p.Visibility = VISIBILITY_PUBLIC
+	case p.Visibility == "":
+		p.Visibility = VISIBILITY_DRAFT
+	}
+	p.Published = p.Visibility != VISIBILITY_DRAFT
+}
+
+func (p BasePost) IsDraft() bool {
+	return p.Visibility == VISIBILITY_DRAFT || (p.Visibility == "" && !p.Published)
+}
+
+func (p BasePost) IsPublic() bool {
+	return p.Visibility == VISIBILITY_PUBLIC || (p.Visibility == "" && p.Published)
+}
+
+// CanBeSeenBy tells whether the viewer can open the post, isFollower is whether the viewer follows its author
+func (p BasePost) CanBeSeenBy(viewer string, isFollower bool) bool {
+	if viewer != "" && viewer == p.Author {
+		return true
+	}
+	switch p.Visibility {
+	case VISIBILITY_PUBLIC, VISIBILITY_UNLISTED:
+		return true
+	case VISIBILITY_FOLLOWERS:
+		return isFollower
+	case "":
+		return p.Published
+	}
+	return false
+}
@@ -7,9 +7,12 @@ import (
 
 func SetUpRoutes(e *echo.Echo) {
 	e.Use(handlers.RestraintAccessMiddleware)
+	e.Use(handlers.PortfolioDomainMiddleware)
 	e.GET("/", handlers.RenderIndex)
 	e.GET("/navbar", handlers.RenderNavbar)
 	e.GET("/favicon.ico", handlers.SendFavicon)
+	e.GET("/robots.txt", handlers.GetRobots)
+	e.GET("/sitemap.xml", handlers.GetSitemap)
 	e.GET("/admin/shutdown", handlers.ShutdownServer)
 	setUpUsersRoutes(e)
 	setUpPostsRoutes(e)
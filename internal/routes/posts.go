@@ -8,6 +8,7 @@ import (
 func setUpPostsRoutes(e *echo.Echo) {
 	e.GET("/main", handlers.GetPostsMain)
 	e.GET("/posts", handlers.GetPostsPaginated)
+	e.GET("/posts/feed/:feed", handlers.GetFeed)
 	e.GET("/posts/all", handlers.GetPostsSearch)
 	e.GET("/posts/all/search", handlers.PostsSearchPaginated)
 	e.GET("/posts/articles", handlers.GetArticleSearch)
@@ -22,10 +23,14 @@ func setUpPostsRoutes(e *echo.Echo) {
 	e.GET("/article/create", handlers.CreateArticleForm)
 	e.POST("/article/create", handlers.CreateArticle)
 	e.POST("/article/publish", handlers.CreateAndPublishArticle)
+	e.POST("/article/preview", handlers.PreviewMarkdown)
+	e.POST("/article/autosave", handlers.AutosaveArticle)
+	e.POST("/article/autosave/:id", handlers.AutosaveArticle)
 	e.GET("/article/mine", handlers.GetMyArticles)
 	e.GET("/article/edit/:id", handlers.EditArticleForm)
 	e.POST("/article/edit/:id", handlers.EditArticle)
 	e.POST("/article/publish/:id", handlers.PublishArticle)
+	e.POST("/article/visibility/:id", handlers.SetArticleVisibility)
 	e.DELETE("/article/delete/:id", handlers.DeleteArticle)
 	e.GET("/article/tag/:name", handlers.ArticlesByTagPaginated)
 	//Galleries
@@ -35,8 +40,13 @@ func setUpPostsRoutes(e *echo.Echo) {
 	e.POST("/gallery/:id/title", handlers.ChangeTitleOfGallery)
 	e.GET("/gallery/:id/title", handlers.GetChangeTitleOfGallery)
 	e.POST("/gallery/:id/publish", handlers.PublishGallery)
+	e.POST("/gallery/:id/visibility", handlers.SetGalleryVisibility)
 	e.GET("/gallery/:id", handlers.GetGalleryByID)
+	e.POST("/gallery/:id/order", handlers.ReorderGalleryImages)
+	e.POST("/gallery/:id/cover", handlers.SetGalleryCover)
 	e.DELETE("/image/:id", handlers.DeleteImage)
+	e.GET("/image/:id/edit", handlers.GetImageEditForm)
+	e.POST("/image/:id/edit", handlers.EditImage)
 	e.GET("/gallery/image-upload-form/:id", handlers.GetImageUploadForm)
 	e.GET("/gallery/mine", handlers.GetMyGalleries)
 	e.GET("/gallery/tag/:name", handlers.GalleriesByTagPaginated)
@@ -48,8 +58,42 @@ func setUpPostsRoutes(e *echo.Echo) {
 	e.GET("/tag/create", handlers.CreateTagForm)
 	e.GET("/tag/find", handlers.FindTags)
 	e.GET("/posts/all/tag/:name", handlers.FindPostsByTagPaginated)
+	e.GET("/posts/all/tag/:name/feed.:format", handlers.GetTagFeed)
+	e.GET("/moderation/tags", handlers.GetTagsModerationTab)
+	e.GET("/moderation/tags/list", handlers.GetTagsForModeration)
+	e.POST("/moderation/tags/alias", handlers.AliasTag)
+	e.POST("/moderation/tags/ban", handlers.BanTagName)
+	e.POST("/moderation/tags/unban", handlers.UnbanTagName)
+	e.POST("/moderation/tags/:id/description", handlers.ChangeTagDescription)
+	e.DELETE("/moderation/tags/:id", handlers.DeleteTagAlias)
 	//Votes
 	e.POST("/vote", handlers.VoteTagForPost)
 	e.GET("/vote/gallery/:id", handlers.FindVotesOfGallery)
 	e.GET("/vote/article/:id", handlers.FindVotesOfArticle)
+	//Reactions
+	e.GET("/reactions/:type/:id", handlers.GetReactions)
+	e.POST("/reactions/:type/:id", handlers.ToggleReaction)
+	e.POST("/saved/:type/:id", handlers.ToggleSavedPost)
+	e.GET("/saved", handlers.SavedPostsPaginated)
+	//Comments
+	e.GET("/comments/:type/:id", handlers.GetComments)
+	e.POST("/comments/:type/:id", handlers.CreateComment)
+	e.POST("/comments/:type/:id/mode", handlers.UpdateCommentsMode)
+	e.DELETE("/comment/:id", handlers.DeleteComment)
+	//Co-authors
+	e.GET("/coauthors/invitations", handlers.GetCoAuthorInvitations)
+	e.POST("/coauthors/invitations/:id", handlers.AnswerCoAuthorInvitation)
+	e.GET("/coauthors/:type/:id", handlers.GetCoAuthors)
+	e.POST("/coauthors/:type/:id", handlers.InviteCoAuthor)
+	e.POST("/coauthors/:type/:id/role", handlers.ChangeCoAuthorRole)
+	e.POST("/coauthors/:type/:id/remove", handlers.RemoveCoAuthor)
+	//Previews
+	e.GET("/preview/:token", handlers.GetPreview)
+	e.POST("/preview/:token/feedback", handlers.LeavePreviewFeedback)
+	e.GET("/previews/:type/:id", handlers.GetPreviewLinks)
+	e.POST("/previews/:type/:id", handlers.CreatePreviewLink)
+	e.DELETE("/previews/link/:id", handlers.RevokePreviewLink)
+	e.DELETE("/previews/feedback/:id", handlers.DeletePreviewFeedback)
+	e.POST("/comment/:id/approve", handlers.ApproveComment)
+	e.POST("/comment/:id/report", handlers.ReportComment)
 }
@@ -14,6 +14,7 @@ func setUpUsersRoutes(e *echo.Echo) {
 	e.GET("/following", handlers.FollowingPostsPaginated)
 	e.GET("/users", handlers.GetUserSearch)
 	e.GET("/users/search", handlers.UserSearchPaginated)
+	e.GET("/u/:username", handlers.GetPortfolio)
 	e.GET("/moderation/tools/dashboard", handlers.GetModDashBoard)
 	e.GET("/admin/tools/dashboard", handlers.GetAdminDashBoard)
 	e.GET("/admin/tools/config", handlers.GetConfigChangeForm)
@@ -23,6 +24,11 @@ func setUpUsersRoutes(e *echo.Echo) {
 	e.GET("/admin/tools/restrict", handlers.GetRestraintAccessForm)
 	e.POST("/admin/tools/restrict", handlers.RestrainAccess)
 	e.GET("/admin/tools/database.db", handlers.SendCopyOfDB)
+	e.GET("/admin/tools/backups", handlers.ListBackups)
+	e.POST("/admin/tools/backups", handlers.CreateBackup)
+	e.POST("/admin/tools/backups/upload", handlers.UploadBackup)
+	e.GET("/admin/tools/backups/:name", handlers.DownloadBackup)
+	e.POST("/admin/tools/backups/:name/restore", handlers.RestoreBackup)
 	e.GET("/admin/tools/logs.zip", handlers.SendCopyOfLogs)
 	e.GET("/moderation/users", handlers.GetUsersListPaginated)
 	e.GET("/moderation/users/search", handlers.GetUsersListSearchPaginated)
@@ -33,21 +39,48 @@ func setUpUsersRoutes(e *echo.Echo) {
 	profile.GET("/my/follows", handlers.ListWhoIFollow)
 	profile.POST("/:username/follow", handlers.FollowUser)
 	profile.POST("/:username/unfollow", handlers.UnfollowUser)
+	profile.POST("/:username/block", handlers.BlockUser)
+	profile.POST("/:username/unblock", handlers.UnblockUser)
+	profile.POST("/:username/mute", handlers.MuteUser)
+	profile.POST("/:username/unmute", handlers.UnmuteUser)
 	profile.GET("/mine", handlers.GetMyProfile)
 	profile.GET("/mine/edit", handlers.GetProfileEditForm)
 	profile.GET("/mine/edit/password", handlers.ChangePasswordForm)
 	profile.POST("/mine/edit/password", handlers.ChangePassword)
 	profile.DELETE("/mine", handlers.DeleteProfile)
 	profile.POST("/mine/edit", handlers.EditProfile)
+	profile.GET("/mine/export", handlers.GetDataExport)
+	profile.POST("/mine/export", handlers.RequestDataExport)
+	profile.GET("/mine/export/download", handlers.DownloadDataExport)
+	profile.GET("/mine/accessibility", handlers.GetAccessibilityReport)
+	profile.GET("/mine/analytics", handlers.GetAnalytics)
+	profile.GET("/mine/portfolio", handlers.GetPortfolioSettings)
+	profile.POST("/mine/portfolio", handlers.SavePortfolioSettings)
+	profile.POST("/mine/portfolio/domain/verify", handlers.VerifyPortfolioDomain)
+	profile.POST("/mine/portfolio/featured/:id", handlers.ToggleFeaturedPost)
+	profile.POST("/mine/portfolio/sections", handlers.MovePortfolioSection)
+	profile.GET("/mine/portfolio/export", handlers.GetSiteExport)
+	profile.POST("/mine/portfolio/export", handlers.RequestSiteExport)
+	profile.GET("/mine/portfolio/export/download", handlers.DownloadSiteExport)
+	profile.GET("/mine/import", handlers.GetImportForm)
+	profile.POST("/mine/import", handlers.PreviewImport)
+	profile.POST("/mine/import/:name", handlers.ConfirmImport)
+	profile.DELETE("/mine/import/:name", handlers.DiscardImport)
 	profile.GET("/:username", handlers.GetUserProfile)
+	profile.GET("/:username/feed.:format", handlers.GetUserFeed)
 	profile.GET("/:username/sections", handlers.GetUserSections)
 	profile.GET("/:username/sections/:section", handlers.GetUserSectionPaginated)
+	profile.GET("/:username/sections/:section/feed.:format", handlers.GetSectionFeed)
 	profile.DELETE("/:username/sections/:section", handlers.DeleteSection)
 	profile.GET("/:username/edit/sections", handlers.GetMySectionsList)
+	profile.POST("/:username/edit/sections/move", handlers.MoveProfileSection)
 	profile.GET("/:username/edit/sections/:section", handlers.GetSectionEdit)
+	profile.POST("/:username/edit/sections/:section", handlers.EditSection)
 	profile.GET("/:username/create/section", handlers.CreateNewSectionForm)
 	profile.POST("/:username/create/section", handlers.CreateNewSection)
 	profile.POST("/:username/section/:section/post/:post", handlers.AddPostToSection)
 	profile.DELETE("/:username/section/:section/post/:post", handlers.RemovePostFromSection)
 	profile.GET("/:username/section/:section/edit/posts", handlers.GetMySectionPostsPaginated)
+	profile.POST("/:username/section/:section/posts", handlers.BulkEditSectionPosts)
+	profile.POST("/:username/section/:section/posts/move", handlers.MoveSectionPost)
 }
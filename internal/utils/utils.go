@@ -14,6 +14,7 @@ var (
 	FromEmailPassword []byte
 	SmtpHost          string
 	SmtpPort          string
+	BaseURL           string
 	Shutdown          *chan struct{}
 )
 
@@ -22,6 +23,8 @@ func init() {
 	FromEmail = os.Getenv("FROM_EMAIL")
 	FromEmailPassword = []byte(os.Getenv("FROM_EMAIL_PASSWORD"))
 	SmtpHost = os.Getenv("SMTP_HOST")
+	//BaseURL is used to build absolute links, such as the ones sent by email
+	BaseURL = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
 }
 
 func GetLocale(c echo.Context) string {